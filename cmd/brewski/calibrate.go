@@ -0,0 +1,189 @@
+package main
+
+// Contains the 'calibrate' subcommand, which reads a device live while the
+// user enters reference readings, then fits a calibration through them and
+// writes it into the config file
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nherson/brewski/config"
+	"github.com/nherson/brewski/device"
+)
+
+const calibrateUsage = `usage: brewski calibrate [flags]
+
+Calibrates a tilt color or ds18b20 probe. Put the sensor in something with a
+known value (water at 1.000, a sugar solution, an ice bath) and enter that
+value once the readings settle. Repeat for each reference, then enter a blank
+line to fit a calibration and write it into the config file (the original is
+kept with a .bak extension).
+
+`
+
+func calibrate(args []string) {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	path := fs.String("config", "./config.toml", "Path to brewski config file")
+	deviceName := fs.String("device", "", "Name of the tilt or ds18b20 device to calibrate")
+	sensor := fs.String("sensor", "", "Tilt color or ds18b20 probe id to calibrate (defaults to the probe id of a single ds18b20)")
+	quantity := fs.String("quantity", "temperature", "What to calibrate: 'gravity' or 'temperature' (tilts only)")
+	degree := fs.Int("degree", 1, fmt.Sprintf("Degree of the polynomial to fit, 1 (linear) to %d", device.MaxCalibrationDegree))
+	readings := fs.Int("readings", 3, "Number of readings averaged for each reference value")
+	interval := fs.Duration("interval", 5*time.Second, "Time between readings")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, calibrateUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	b, err := ioutil.ReadFile(*path)
+	if err != nil {
+		exitWithError(err)
+	}
+	conf, err := config.ParseConfig(b)
+	if err != nil {
+		exitWithError(err)
+	}
+	if conf.Global.OnesireSysfsDir != "" {
+		device.SetOnewireSysfsDir(conf.Global.OnesireSysfsDir)
+	}
+	if ds18b20Config, found := conf.Devices.DS18B20s[*deviceName]; found && *sensor == "" {
+		*sensor = ds18b20Config.ID
+	}
+	target := config.CalibrationTarget{
+		Device:   *deviceName,
+		Sensor:   *sensor,
+		Quantity: *quantity,
+	}
+	datapoint, err := conf.Datapoint(target)
+	if err != nil {
+		exitWithError(err)
+	}
+	d, err := conf.UncalibratedDevice(target)
+	if err != nil {
+		exitWithError(err)
+	}
+	c := &calibrator{
+		device:    d,
+		tag:       conf.SensorTag(target),
+		sensor:    target.Sensor,
+		datapoint: datapoint,
+		readings:  *readings,
+		interval:  *interval,
+	}
+
+	fmt.Printf("calibrating %s of '%s' on device '%s'\n", target.Quantity, target.Sensor, target.Device)
+	points := []device.CalibrationPoint{}
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Printf("reference %s (blank to finish): ", target.Quantity)
+		if !in.Scan() {
+			break
+		}
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			break
+		}
+		actual, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			fmt.Printf("'%s' is not a number\n", line)
+			continue
+		}
+		raw, err := c.read()
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		points = append(points, device.CalibrationPoint{Raw: raw, Actual: actual})
+		fmt.Printf("recorded raw %v as %v (%d points)\n", raw, actual, len(points))
+	}
+
+	calibration, err := device.FitCalibration(points, *degree)
+	if err != nil {
+		exitWithError(err)
+	}
+	for _, p := range points {
+		fmt.Printf("raw %v -> %v (reference %v)\n", p.Raw, calibration.Apply(float32(p.Raw)), p.Actual)
+	}
+	updated, err := config.SetCalibrationPoints(b, target, points, *degree)
+	if err != nil {
+		exitWithError(err)
+	}
+	info, err := os.Stat(*path)
+	if err != nil {
+		exitWithError(err)
+	}
+	if err := ioutil.WriteFile(*path+".bak", b, info.Mode()); err != nil {
+		exitWithError(err)
+	}
+	if err := ioutil.WriteFile(*path, updated, info.Mode()); err != nil {
+		exitWithError(err)
+	}
+	fmt.Printf("wrote calibration to %s (previous config saved to %s.bak)\n", *path, *path)
+}
+
+// calibrator reads the raw value being calibrated from a device
+type calibrator struct {
+	device    device.Reader
+	tag       string
+	sensor    string
+	datapoint string
+	readings  int
+	interval  time.Duration
+}
+
+// read returns the average of several fresh readings of the sensor
+func (c *calibrator) read() (float64, error) {
+	// throw away whatever was read before the reference was entered
+	c.device.Read()
+	sum := 0.0
+	count := 0
+	// give up if the sensor hasn't been heard from in a while
+	for attempts := 0; count < c.readings && attempts < c.readings*10; attempts++ {
+		time.Sleep(c.interval)
+		value, found, err := c.readOnce()
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if !found {
+			fmt.Printf("waiting for a reading from '%s'\n", c.sensor)
+			continue
+		}
+		fmt.Printf("  %s = %v\n", c.datapoint, value)
+		sum += value
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no readings from '%s'", c.sensor)
+	}
+	// round off float32 noise so the config file stays readable
+	return strconv.ParseFloat(strconv.FormatFloat(sum/float64(count), 'f', 4, 64), 64)
+}
+
+func (c *calibrator) readOnce() (float64, bool, error) {
+	samples, err := c.device.Read()
+	for _, s := range samples {
+		if s.Tags()[c.tag] != c.sensor {
+			continue
+		}
+		for _, dp := range s.Datapoints() {
+			if dp.Name() == c.datapoint {
+				return float64(dp.Value()), true, nil
+			}
+		}
+	}
+	return 0, false, err
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
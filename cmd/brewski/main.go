@@ -4,15 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"go.uber.org/zap"
 
-	"github.com/BurntSushi/toml"
-
 	"github.com/nherson/brewski/config"
+	"github.com/nherson/brewski/state"
 )
 
 var configPath string
@@ -22,6 +22,10 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "calibrate" {
+		calibrate(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
 	logger, err := zap.NewProduction()
@@ -37,9 +41,8 @@ func main() {
 		mainLogger.Fatal("could not read config file", zap.Error(err))
 	}
 
-	var conf config.Config
-	if _, err := toml.Decode(string(b), &conf); err != nil {
-		// handle error
+	conf, err := config.ParseConfig(b)
+	if err != nil {
 		mainLogger.Fatal("could not parse config file", zap.Error(err))
 	}
 
@@ -52,6 +55,17 @@ func main() {
 		p.Start()
 	}
 
+	if conf.Global.StateAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/state", state.Default)
+		mainLogger.Info("serving latest values on " + conf.Global.StateAddress + "/state")
+		go func() {
+			if err := http.ListenAndServe(conf.Global.StateAddress, mux); err != nil {
+				mainLogger.Fatal("could not serve latest values", zap.Error(err))
+			}
+		}()
+	}
+
 	waitForExit(mainLogger)
 }
 
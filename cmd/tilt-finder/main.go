@@ -1,74 +1,178 @@
 package main
 
 // Use this executable to see if you can find Tilt Hydrometers nearby.
-// Will print to stdout when a Tilt is discovered.
+// Shows a live table of every Tilt heard from, or prints each decoded
+// advertisement as a line of JSON with -json for piping into other tools.
 
 import (
-	"bytes"
-	"context"
-	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"strings"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/go-ble/ble"
-	"github.com/go-ble/ble/examples/lib/dev"
+
+	"github.com/nherson/brewski/device"
+)
+
+// advertisement rates are worked out over this window
+const rateWindow = time.Minute
+
+var (
+	jsonLines   bool
+	interval    time.Duration
+	replay      string
+	replaySpeed float64
 )
 
-// Mapping between hardcoded Tilt Hydrometer UUIDs
-// and the color that the UUID represents
-var colorUUIDMap = map[string]string{
-	"A495BB10C5B14B44B5121370F02D74DE": "red",
-	"A495BB20C5B14B44B5121370F02D74DE": "green",
-	"A495BB30C5B14B44B5121370F02D74DE": "black",
-	"A495BB40C5B14B44B5121370F02D74DE": "purple",
-	"A495BB50C5B14B44B5121370F02D74DE": "orange",
-	"A495BB60C5B14B44B5121370F02D74DE": "blue",
-	"A495BB70C5B14B44B5121370F02D74DE": "yellow",
-	"A495BB80C5B14B44B5121370F02D74DE": "pink",
+func init() {
+	flag.BoolVar(&jsonLines, "json", false, "Print each tilt advertisement as a line of JSON instead of a table")
+	flag.DurationVar(&interval, "interval", time.Second, "How often to collect advertisements (and redraw the table)")
+	flag.StringVar(&replay, "replay", "", "Replay advertisements from a capture file instead of scanning")
+	flag.Float64Var(&replaySpeed, "replay-speed", 1, "Speed up replaying a capture by this factor")
 }
 
 func main() {
-	fmt.Println("Scanning for Tilt Hydrometer devices, use ctrl-C to exit...")
+	flag.Parse()
 
-	// Setup bluetooth scanning device
-	d, err := dev.NewDevice("default")
+	decoder, err := device.LookupBLEDecoder(device.TiltDecoderName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := device.SetBluetoothSettings(device.BluetoothSettings{Replay: replay, ReplaySpeed: replaySpeed}); err != nil {
+		log.Fatal(err)
+	}
+	scanner, err := device.NewBluetoothScanner()
 	if err != nil {
-		log.Fatalf("can't new device : %s", err)
+		log.Fatalf("can't scan for tilts: %s", err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	tilts := make(map[string]*tiltState)
+	if !jsonLines {
+		fmt.Println("Scanning for Tilt Hydrometer devices, use ctrl-C to exit...")
+	}
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for _, a := range scanner.GetAdvertisements() {
+				reading, isTilt := decoder.Decode(a)
+				if !isTilt {
+					continue
+				}
+				if jsonLines {
+					printJSON(now, a, reading)
+					continue
+				}
+				tilt, found := tilts[reading.ID]
+				if !found {
+					tilt = &tiltState{color: reading.ID}
+					tilts[reading.ID] = tilt
+				}
+				tilt.update(now, a, reading)
+			}
+			if !jsonLines {
+				printTable(now, tilts)
+			}
+		}
+	}
+}
+
+// tiltState holds the most recent reading from a single tilt
+type tiltState struct {
+	color       string
+	address     string
+	gravity     float32
+	temperature float32
+	rssi        float32
+	lastSeen    time.Time
+	// times of the advertisements received within the rate window
+	seen []time.Time
+}
+
+func (ts *tiltState) update(now time.Time, a ble.Advertisement, reading *device.BLEReading) {
+	if a.Addr() != nil {
+		ts.address = a.Addr().String()
 	}
-	ble.SetDefaultDevice(d)
+	ts.gravity, _ = reading.Value("gravity")
+	ts.temperature, _ = reading.Value("temperature")
+	ts.rssi, _ = reading.Value("rssi")
+	ts.lastSeen = now
+	ts.seen = append(ts.seen, now)
+}
 
-	// Scan for devices with no timeout
-	ble.Scan(context.Background(), true, advHandler, nil)
+// rate returns the number of advertisements received per minute, over the rate window
+func (ts *tiltState) rate(now time.Time) float64 {
+	recent := ts.seen[:0]
+	for _, t := range ts.seen {
+		if now.Sub(t) <= rateWindow {
+			recent = append(recent, t)
+		}
+	}
+	ts.seen = recent
+	return float64(len(recent)) / rateWindow.Minutes()
 }
 
-// this will be a noop since we can handle all this logic
-func advHandler(a ble.Advertisement) {
-	// First, verify that this could possibly be a Tilt
-	// By ensuring that the message payload is 25 bytes (iBeacon), and
-	// the manufacturer data preamble is the right hex string (0x4c000215)
-	md := a.ManufacturerData()
-	if len(md) != 25 {
-		return
+func printTable(now time.Time, tilts map[string]*tiltState) {
+	colors := []string{}
+	for color := range tilts {
+		colors = append(colors, color)
+	}
+	sort.Strings(colors)
+	// clear the terminal and redraw from the top
+	fmt.Print("\033[H\033[2J")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLOR\tADDRESS\tGRAVITY\tTEMP (F)\tRSSI\tLAST SEEN\tRATE (/min)")
+	for _, color := range colors {
+		ts := tilts[color]
+		fmt.Fprintf(w, "%s\t%s\t%.4f\t%.1f\t%.0f\t%s ago\t%.1f\n",
+			ts.color, ts.address, ts.gravity, ts.temperature, ts.rssi,
+			now.Sub(ts.lastSeen).Truncate(time.Second), ts.rate(now))
 	}
-	var color string
-	// Parse out the constant preamble and the UUID
-	discoveredPreamble := md[0:4]
-	requiredPreamble := []byte{0x4c, 0x00, 0x02, 0x15}
-	uuid := md[4:20]
-	if bytes.Compare(discoveredPreamble, requiredPreamble) != 0 {
-		fmt.Println(discoveredPreamble)
-		fmt.Println(requiredPreamble)
-		fmt.Println("preamble mismatch")
+	if len(colors) == 0 {
+		fmt.Fprintln(w, "no tilts found yet (tilts standing straight up stop advertising)")
 	}
-	discoveredUUID := strings.ToUpper(hex.EncodeToString(uuid))
-	// Do a lookup to determine the color of the found device.
-	// If the UUID is not in the map, then the device must not
-	// be a Tilt Hydrometer
-	color, found := colorUUIDMap[discoveredUUID]
-	if !found {
-		// unknown UUID, so skip
-		return
+	w.Flush()
+}
+
+// a single tilt advertisement, as printed with -json
+type jsonReading struct {
+	Time        time.Time `json:"time"`
+	Color       string    `json:"color"`
+	Address     string    `json:"address"`
+	Gravity     float32   `json:"gravity"`
+	Temperature float32   `json:"temperature"`
+	RSSI        float32   `json:"rssi"`
+	TxPower     float32   `json:"tx-power"`
+}
+
+func printJSON(now time.Time, a ble.Advertisement, reading *device.BLEReading) {
+	jr := jsonReading{
+		Time:  now,
+		Color: reading.ID,
+	}
+	if a.Addr() != nil {
+		jr.Address = a.Addr().String()
+	}
+	jr.Gravity, _ = reading.Value("gravity")
+	jr.Temperature, _ = reading.Value("temperature")
+	jr.RSSI, _ = reading.Value("rssi")
+	jr.TxPower, _ = reading.Value("tx-power")
+	b, err := json.Marshal(jr)
+	if err != nil {
+		log.Fatal(err)
 	}
-	fmt.Printf("Found %s Tilt Hydrometer with address: %s\n", color, a.Addr().String())
+	fmt.Println(string(b))
 }
@@ -0,0 +1,247 @@
+package config
+
+// Contains helpers for calibrating devices interactively: reading them without
+// any existing calibration, and writing new calibration points back into the
+// TOML config file without disturbing the rest of it (comments included)
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nherson/brewski/device"
+)
+
+// CalibrationTarget identifies a single calibratable value: the temperature or
+// gravity of one color of tilt, or the (celsius) temperature of a ds18b20 probe
+type CalibrationTarget struct {
+	Device   string // name of the configured device
+	Sensor   string // tilt color or ds18b20 probe id
+	Quantity string // 'gravity' or 'temperature'
+}
+
+// Datapoint returns the name of the datapoint holding the value being calibrated
+func (c *Config) Datapoint(target CalibrationTarget) (string, error) {
+	if _, found := c.Devices.Tilts[target.Device]; found {
+		if target.Quantity != "gravity" && target.Quantity != "temperature" {
+			return "", fmt.Errorf("tilts can only calibrate 'gravity' or 'temperature', not '%s'", target.Quantity)
+		}
+		return target.Quantity, nil
+	}
+	if _, found := c.Devices.DS18B20s[target.Device]; found {
+		if target.Quantity != "temperature" {
+			return "", fmt.Errorf("ds18b20s can only calibrate 'temperature', not '%s'", target.Quantity)
+		}
+		return "celsius", nil
+	}
+	return "", fmt.Errorf("no tilt or ds18b20 device named '%s'", target.Device)
+}
+
+// SensorTag returns the tag used to identify the target's samples among the
+// others read from its device, e.g. the 'color' tag for tilts
+func (c *Config) SensorTag(target CalibrationTarget) string {
+	if _, found := c.Devices.Tilts[target.Device]; found {
+		return "color"
+	}
+	return "id"
+}
+
+// UncalibratedDevice generates the target's device with all of its calibration
+// removed, so the raw readings to calibrate against can be read from it
+func (c *Config) UncalibratedDevice(target CalibrationTarget) (device.Reader, error) {
+	if _, err := c.Datapoint(target); err != nil {
+		return nil, err
+	}
+	if _, found := c.Devices.Tilts[target.Device]; found {
+		if err := c.checkTiltColor(target); err != nil {
+			return nil, err
+		}
+		raw := &TiltConfig{
+			Colors: map[string]*TiltColorConfig{target.Sensor: {}},
+		}
+		return raw.GenerateDevice(target.Device)
+	}
+	ds18b20Config := c.Devices.DS18B20s[target.Device]
+	if !ds18b20Config.Discover && target.Sensor != ds18b20Config.ID {
+		return nil, fmt.Errorf("ds18b20 device '%s' reads probe '%s', not '%s'", target.Device, ds18b20Config.ID, target.Sensor)
+	}
+	raw := *ds18b20Config
+	raw.Calibrations = nil
+	return raw.GenerateDevice(target.Device)
+}
+
+// checkTiltColor returns an error unless the target is a tilt color with its own
+// block in the config. Calibrations are written into that block, and it can't be
+// added for the user: once any colors are configured only those colors are read,
+// so adding one could silently stop the other colors from being reported
+func (c *Config) checkTiltColor(target CalibrationTarget) error {
+	if !device.IsTiltColor(target.Sensor) {
+		return fmt.Errorf("unknown tilt color '%s'", target.Sensor)
+	}
+	if _, found := c.Devices.Tilts[target.Device].Colors[target.Sensor]; !found {
+		return fmt.Errorf("tilt device '%s' has no [devices.tilt.%s.colors.%s] block to write the calibration into; "+
+			"add it first (once any colors are configured, only those colors are read)", target.Device, target.Device, target.Sensor)
+	}
+	return nil
+}
+
+// SetCalibrationPoints returns the TOML config in b with the calibration points of
+// the target replaced with the given ones. Anything else in the config is kept as is.
+// The result is parsed to make sure it is still a valid config before being returned
+func SetCalibrationPoints(b []byte, target CalibrationTarget, points []device.CalibrationPoint, degree int) ([]byte, error) {
+	c, err := ParseConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Datapoint(target); err != nil {
+		return nil, err
+	}
+	var table string
+	var values []tomlKeyValue
+	var remove []string
+	if _, found := c.Devices.Tilts[target.Device]; found {
+		if err := c.checkTiltColor(target); err != nil {
+			return nil, err
+		}
+		table = fmt.Sprintf("devices.tilt.%s.colors.%s", target.Device, target.Sensor)
+		values = []tomlKeyValue{
+			{target.Quantity + "_calibration_points", formatCalibrationPoints(points)},
+			{target.Quantity + "_calibration_degree", strconv.Itoa(degree)},
+		}
+		// an offset can't be used alongside calibration points
+		remove = []string{target.Quantity + "_calibration"}
+	} else {
+		table = fmt.Sprintf("devices.ds18b20.%s.calibrations.%s", target.Device, target.Sensor)
+		values = []tomlKeyValue{
+			{"points", formatCalibrationPoints(points)},
+			{"degree", strconv.Itoa(degree)},
+		}
+	}
+	updated := setTOMLTableKeys(string(b), table, values, remove)
+	if _, err := ParseConfig([]byte(updated)); err != nil {
+		return nil, fmt.Errorf("updated config is invalid: %s", err)
+	}
+	return []byte(updated), nil
+}
+
+type tomlKeyValue struct {
+	key   string
+	value string
+}
+
+// setTOMLTableKeys sets the keys in the given table of the TOML document, removing
+// any existing values for them along with the keys in remove. The table is appended
+// to the document if it doesn't exist yet (callers make sure that's harmless).
+// Values spanning several lines are only supported for arrays
+func setTOMLTableKeys(doc, table string, values []tomlKeyValue, remove []string) string {
+	drop := make(map[string]bool)
+	for _, kv := range values {
+		drop[kv.key] = true
+	}
+	for _, key := range remove {
+		drop[key] = true
+	}
+	lines := strings.Split(doc, "\n")
+	header := -1
+	depth := 0
+	for i, line := range lines {
+		if name, isHeader := tomlTableHeader(line); depth == 0 && isHeader && name == table {
+			header = i
+			break
+		}
+		depth += tomlBracketDepth(line)
+	}
+	if header == -1 {
+		doc = strings.TrimRight(doc, "\n") + "\n\n[" + table + "]\n"
+		for _, kv := range values {
+			doc += kv.key + " = " + kv.value + "\n"
+		}
+		return doc
+	}
+	indent := lines[header][:len(lines[header])-len(strings.TrimLeft(lines[header], " \t"))]
+	updated := append([]string{}, lines[:header+1]...)
+	for _, kv := range values {
+		updated = append(updated, indent+kv.key+" = "+kv.value)
+	}
+	inTable, dropping := true, false
+	// depth counts the brackets left open by an array spanning several lines,
+	// whose lines are neither keys nor table headers
+	depth = 0
+	for _, line := range lines[header+1:] {
+		if depth == 0 {
+			trimmed := strings.TrimSpace(line)
+			if _, isHeader := tomlTableHeader(line); isHeader {
+				inTable = false
+			}
+			key := strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[0])
+			dropping = inTable && strings.Contains(trimmed, "=") && drop[key]
+		}
+		depth += tomlBracketDepth(line)
+		if !dropping {
+			updated = append(updated, line)
+		}
+	}
+	return strings.Join(updated, "\n")
+}
+
+// tomlTableHeader returns the name of the table a line starts, e.g. 'outputs.log.x'
+// for '[outputs.log.x] # comment', or false if the line doesn't start a table
+func tomlTableHeader(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	end := strings.Index(trimmed, "]")
+	if !strings.HasPrefix(trimmed, "[") || end == -1 {
+		return "", false
+	}
+	rest := strings.TrimSpace(strings.TrimLeft(trimmed[end:], "]"))
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimLeft(trimmed[:end], "[")), true
+}
+
+// tomlBracketDepth returns how many more brackets a line opens than it closes,
+// ignoring those in strings and comments
+func tomlBracketDepth(line string) int {
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case quote == '"' && escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return depth
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// formats calibration points as a TOML array of [raw, actual] float pairs
+func formatCalibrationPoints(points []device.CalibrationPoint) string {
+	pairs := []string{}
+	for _, p := range points {
+		pairs = append(pairs, fmt.Sprintf("[%s, %s]", formatTOMLFloat(p.Raw), formatTOMLFloat(p.Actual)))
+	}
+	return "[" + strings.Join(pairs, ", ") + "]"
+}
+
+// TOML won't decode an integer into a float, so always include a decimal point
+func formatTOMLFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
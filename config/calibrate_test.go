@@ -0,0 +1,171 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/nherson/brewski/device"
+	"github.com/stretchr/testify/assert"
+)
+
+var calibrationConfigText = `# my fermenters
+[global]
+onewire-sysfs-dir = "../testdata/temperature/ds18b20"
+
+[devices.tilt.fermenters]
+    outputs = ["stdout"]
+    [devices.tilt.fermenters.colors.red]
+    alias = "helles" # the lager
+    gravity_calibration = 0.002
+    temperature_calibration = -1.0
+
+[devices.ds18b20.probes]
+discover = true
+
+[outputs.log.stdout]
+`
+
+func TestSetTiltCalibrationPoints(t *testing.T) {
+	target := CalibrationTarget{Device: "fermenters", Sensor: "red", Quantity: "gravity"}
+	points := []device.CalibrationPoint{
+		{Raw: 1.001, Actual: 1},
+		{Raw: 1.052, Actual: 1.05},
+	}
+	b, err := SetCalibrationPoints([]byte(calibrationConfigText), target, points, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, `# my fermenters
+[global]
+onewire-sysfs-dir = "../testdata/temperature/ds18b20"
+
+[devices.tilt.fermenters]
+    outputs = ["stdout"]
+    [devices.tilt.fermenters.colors.red]
+    gravity_calibration_points = [[1.001, 1.0], [1.052, 1.05]]
+    gravity_calibration_degree = 1
+    alias = "helles" # the lager
+    temperature_calibration = -1.0
+
+[devices.ds18b20.probes]
+discover = true
+
+[outputs.log.stdout]
+`, string(b))
+
+	c, err := ParseConfig(b)
+	assert.Nil(t, err)
+	colors, err := c.Devices.Tilts["fermenters"].colorSettings()
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.05, colors["red"].GravityCalibration.Apply(1.052), 1e-6)
+
+	// not enough points for the degree
+	_, err = SetCalibrationPoints(b, target, points, 2)
+	assert.NotNil(t, err)
+
+	// a color without its own block is refused rather than added, since that
+	// would stop the other colors from being read
+	target.Sensor = "blue"
+	_, err = SetCalibrationPoints(b, target, points, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "[devices.tilt.fermenters.colors.blue]")
+	_, err = SetCalibrationPoints([]byte("[devices.tilt.all-colors]\n"), CalibrationTarget{Device: "all-colors", Sensor: "red", Quantity: "gravity"}, points, 1)
+	assert.NotNil(t, err)
+}
+
+func TestSetDS18B20CalibrationPoints(t *testing.T) {
+	target := CalibrationTarget{Device: "probes", Sensor: "28-0123456789abcd", Quantity: "temperature"}
+	points := []device.CalibrationPoint{
+		{Raw: 0.5, Actual: 0},
+		{Raw: 99, Actual: 99.5},
+	}
+	b, err := SetCalibrationPoints([]byte(calibrationConfigText), target, points, 1)
+	assert.Nil(t, err)
+	c, err := ParseConfig(b)
+	assert.Nil(t, err)
+	calibration := c.Devices.DS18B20s["probes"].Calibrations["28-0123456789abcd"]
+	assert.Equal(t, [][]float64{{0.5, 0}, {99, 99.5}}, calibration.Points)
+	assert.Equal(t, 1, calibration.Degree)
+
+	target.Quantity = "gravity"
+	_, err = SetCalibrationPoints([]byte(calibrationConfigText), target, points, 1)
+	assert.NotNil(t, err)
+}
+
+func TestSetCalibrationPointsMultiline(t *testing.T) {
+	target := CalibrationTarget{Device: "fermenters", Sensor: "red", Quantity: "gravity"}
+	points := []device.CalibrationPoint{
+		{Raw: 1.001, Actual: 1},
+		{Raw: 1.052, Actual: 1.05},
+	}
+	b, err := SetCalibrationPoints([]byte(`[devices.tilt.fermenters]
+outputs = ["stdout"]
+[devices.tilt.fermenters.colors.red] # the lager
+gravity_calibration_points = [
+    [1.000, 1.000],
+    [1.040, 1.042], # checked with a refractometer
+]
+temperature_calibration_points = [
+    [33.0, 32.0],
+    [78.0, 77.5],
+]
+[devices.tilt.fermenters.colors.blue]
+
+[outputs.log.stdout]
+`), target, points, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, `[devices.tilt.fermenters]
+outputs = ["stdout"]
+[devices.tilt.fermenters.colors.red] # the lager
+gravity_calibration_points = [[1.001, 1.0], [1.052, 1.05]]
+gravity_calibration_degree = 1
+temperature_calibration_points = [
+    [33.0, 32.0],
+    [78.0, 77.5],
+]
+[devices.tilt.fermenters.colors.blue]
+
+[outputs.log.stdout]
+`, string(b))
+}
+
+func TestUncalibratedDevice(t *testing.T) {
+	b, err := SetCalibrationPoints([]byte(calibrationConfigText),
+		CalibrationTarget{Device: "probes", Sensor: "28-0123456789abcd", Quantity: "temperature"},
+		[]device.CalibrationPoint{{Raw: 0, Actual: 10}, {Raw: 100, Actual: 110}}, 1)
+	assert.Nil(t, err)
+	c, err := ParseConfig(b)
+	assert.Nil(t, err)
+	device.SetOnewireSysfsDir(c.Global.OnesireSysfsDir)
+
+	target := CalibrationTarget{Device: "probes", Sensor: "28-0123456789abcd", Quantity: "temperature"}
+	datapoint, err := c.Datapoint(target)
+	assert.Nil(t, err)
+	assert.Equal(t, "celsius", datapoint)
+	assert.Equal(t, "id", c.SensorTag(target))
+
+	d, err := c.UncalibratedDevice(target)
+	assert.Nil(t, err)
+	samples, err := d.Read()
+	assert.Nil(t, err)
+	for _, sample := range samples {
+		if sample.Tags()["id"] == "28-0123456789abcd" {
+			assert.Equal(t, float32(21.375), sample.Datapoints()[0].Value())
+		}
+	}
+
+	// the configured device is still calibrated
+	d, err = c.Devices.DS18B20s["probes"].GenerateDevice("probes")
+	assert.Nil(t, err)
+	samples, err = d.Read()
+	assert.Nil(t, err)
+	for _, sample := range samples {
+		if sample.Tags()["id"] == "28-0123456789abcd" {
+			assert.InDelta(t, 31.375, sample.Datapoints()[0].Value(), 1e-4)
+		}
+	}
+
+	_, err = c.UncalibratedDevice(CalibrationTarget{Device: "nope", Quantity: "temperature"})
+	assert.NotNil(t, err)
+	_, err = c.UncalibratedDevice(CalibrationTarget{Device: "fermenters", Sensor: "chartreuse", Quantity: "gravity"})
+	assert.NotNil(t, err)
+	_, err = c.UncalibratedDevice(CalibrationTarget{Device: "fermenters", Sensor: "blue", Quantity: "gravity"})
+	assert.NotNil(t, err)
+}
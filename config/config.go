@@ -2,13 +2,16 @@ package config
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/BurntSushi/toml"
 	"github.com/nherson/brewski/device"
+	"github.com/nherson/brewski/measurement"
 	"github.com/nherson/brewski/outputs"
+	"github.com/nherson/brewski/state"
 )
 
 // Contains structs and definitions to turn a TOML config file
@@ -17,9 +20,10 @@ import (
 // Config is a top level struct that contains all configuration data.
 // The TOML file will be parsed into this struct
 type Config struct {
-	Global  GlobalConfig  `toml:"global"`
-	Devices DevicesConfig `toml:"devices"`
-	Outputs OutputsConfig `toml:"outputs"`
+	Global     GlobalConfig     `toml:"global"`
+	Devices    DevicesConfig    `toml:"devices"`
+	Outputs    OutputsConfig    `toml:"outputs"`
+	Processors ProcessorsConfig `toml:"processors"`
 }
 
 // ParseConfig returns a Config struct generated from the received bytes,
@@ -29,22 +33,99 @@ func ParseConfig(b []byte) (*Config, error) {
 	if _, err := toml.Decode(string(b), &conf); err != nil {
 		return nil, err
 	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
 	return &conf, nil
 }
 
+// Validate checks the parts of the configuration that can be checked
+// without generating devices, like calibrations
+func (c *Config) Validate() error {
+	if err := c.Global.Bluetooth.settings().Validate(); err != nil {
+		return err
+	}
+	if _, err := c.Global.displayUnits(); err != nil {
+		return fmt.Errorf("invalid global units: %s", err)
+	}
+	for name, tiltConfig := range c.Devices.Tilts {
+		if err := tiltConfig.Validate(); err != nil {
+			return fmt.Errorf("invalid tilt device '%s': %s", name, err)
+		}
+	}
+	for name, ds18b20Config := range c.Devices.DS18B20s {
+		if err := ds18b20Config.Validate(); err != nil {
+			return fmt.Errorf("invalid ds18b20 device '%s': %s", name, err)
+		}
+	}
+	for name, virtualConfig := range c.Devices.Virtuals {
+		if err := virtualConfig.Validate(); err != nil {
+			return fmt.Errorf("invalid virtual device '%s': %s", name, err)
+		}
+	}
+	return nil
+}
+
 // GlobalConfig contains configuration that is either a global
 // default for devices and outputs, or is some other globally
 // applied configuration
 type GlobalConfig struct {
-	PollingInterval duration `toml:"polling-interval"`
-	OnesireSysfsDir string   `toml:"onewire-sysfs-dir"`
+	PollingInterval duration        `toml:"polling-interval"`
+	OnesireSysfsDir string          `toml:"onewire-sysfs-dir"`
+	SysfsClassDir   string          `toml:"sysfs-class-dir"`
+	Bluetooth       BluetoothConfig `toml:"bluetooth"`
+	StateAddress    string          `toml:"state-address"` // serves the latest values over HTTP, e.g. :8080
+	// Units outputs display datapoints in, by quantity, e.g. temperature = "fahrenheit"
+	Units map[string]string `toml:"units"`
+}
+
+// displayUnits returns the units datapoints are converted to before reaching outputs
+func (c *GlobalConfig) displayUnits() ([]measurement.Unit, error) {
+	units := []measurement.Unit{}
+	for quantity, name := range c.Units {
+		u, err := measurement.LookupUnit(name)
+		if err != nil {
+			return nil, err
+		}
+		if u.Quantity() != measurement.Quantity(quantity) {
+			return nil, fmt.Errorf("unit '%s' is not a unit of %s", name, quantity)
+		}
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+// BluetoothConfig holds configuration for the Bluetooth LE scanner shared by
+// tilt and ble devices. Received advertisements can be captured to a file, and
+// a capture can be replayed instead of scanning (e.g. on a machine without bluetooth)
+type BluetoothConfig struct {
+	Adapter     string  `toml:"adapter"` // index (hci0) or address, defaults to the default adapter
+	Capture     string  `toml:"capture"`
+	Replay      string  `toml:"replay"`
+	ReplaySpeed float64 `toml:"replay-speed"` // defaults to 1.0, real time
+}
+
+func (c *BluetoothConfig) settings() device.BluetoothSettings {
+	return device.BluetoothSettings{
+		Adapter:     c.Adapter,
+		Capture:     c.Capture,
+		Replay:      c.Replay,
+		ReplaySpeed: c.ReplaySpeed,
+	}
 }
 
 // DevicesConfig holds configuration data for each device being setup for use
 type DevicesConfig struct {
-	DS18B20s     map[string]*DS18B20Config     `toml:"ds18b20"`
-	Tilts        map[string]*TiltConfig        `toml:"tilt"`
-	DummyDevices map[string]*DummyDeviceConfig `toml:"dummy-device"`
+	DS18B20s      map[string]*DS18B20Config      `toml:"ds18b20"`
+	Tilts         map[string]*TiltConfig         `toml:"tilt"`
+	BLESensors    map[string]*BLESensorsConfig   `toml:"ble"`
+	Hwmons        map[string]*HwmonConfig        `toml:"hwmon"`
+	BME280s       map[string]*BME280Config       `toml:"bme280"`
+	SHT3xs        map[string]*SHT3xConfig        `toml:"sht3x"`
+	HX711s        map[string]*HX711Config        `toml:"hx711"`
+	PulseCounters map[string]*PulseCounterConfig `toml:"pulse-counter"`
+	DummyDevices  map[string]*DummyDeviceConfig  `toml:"dummy-device"`
+	Virtuals      map[string]*VirtualConfig      `toml:"virtual"`
 }
 
 // AllDeviceConfigs returns a mapping from device names to their configuration
@@ -62,12 +143,54 @@ func (d *DevicesConfig) AllDeviceConfigs() (map[string]DeviceConfig, error) {
 		}
 		deviceConfigs[name] = deviceConfig
 	}
+	for name, deviceConfig := range d.BLESensors {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
+	for name, deviceConfig := range d.Hwmons {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
+	for name, deviceConfig := range d.BME280s {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
+	for name, deviceConfig := range d.SHT3xs {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
+	for name, deviceConfig := range d.HX711s {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
+	for name, deviceConfig := range d.PulseCounters {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
 	for name, deviceConfig := range d.DummyDevices {
 		if _, found := deviceConfigs[name]; found {
 			return nil, fmt.Errorf("duplicate device declared '%s'", name)
 		}
 		deviceConfigs[name] = deviceConfig
 	}
+	for name, deviceConfig := range d.Virtuals {
+		if _, found := deviceConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate device declared '%s'", name)
+		}
+		deviceConfigs[name] = deviceConfig
+	}
 	return deviceConfigs, nil
 }
 
@@ -75,6 +198,7 @@ func (d *DevicesConfig) AllDeviceConfigs() (map[string]DeviceConfig, error) {
 type OutputsConfig struct {
 	Logs      map[string]*LogConfig      `toml:"log"`
 	Influxdbs map[string]*InfluxdbConfig `toml:"influxdb"`
+	Webhooks  map[string]*WebhookConfig  `toml:"webhook"`
 }
 
 // AllOutputConfigs returns a mapping between an output name and its OutputConfig
@@ -92,6 +216,12 @@ func (d *OutputsConfig) AllOutputConfigs() (map[string]OutputConfig, error) {
 		}
 		outputConfigs[name] = outputConfig
 	}
+	for name, outputConfig := range d.Webhooks {
+		if _, found := outputConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate output declared '%s'", name)
+		}
+		outputConfigs[name] = outputConfig
+	}
 	return outputConfigs, nil
 }
 
@@ -99,6 +229,7 @@ func (d *OutputsConfig) AllOutputConfigs() (map[string]OutputConfig, error) {
 // that can be used to generate a corresponding outputs.Callback
 type OutputConfig interface {
 	GenerateOutput() (outputs.Callback, error)
+	ProcessorNames() []string
 }
 
 // DeviceConfig is some configuration for a device that
@@ -106,23 +237,114 @@ type OutputConfig interface {
 type DeviceConfig interface {
 	GenerateDevice(string) (device.Reader, error)
 	OutputNames() []string
+	ProcessorNames() []string
+}
+
+// RoutedDeviceConfig is a DeviceConfig that sends some of its samples to
+// extra outputs, depending on the value of one of the samples' tags
+type RoutedDeviceConfig interface {
+	DeviceConfig
+	OutputRoutes() (string, map[string][]string)
 }
 
 // DEVICE CONFIG STRUCTS
 
-// DS18B20Config holds configuration data about a ds18b20 temperature sensor
+// DS18B20Config holds configuration data about a ds18b20 temperature sensor.
+// Either a single probe is read using its ID, or discovery is enabled to read
+// every probe on the onewire bus, optionally naming them using aliases
 type DS18B20Config struct {
-	ID      string   `toml:"id"`
-	Outputs []string `toml:"outputs"`
+	ID       string            `toml:"id"`
+	Discover bool              `toml:"discover"`
+	Aliases  map[string]string `toml:"aliases"` // probe id -> alias, only used with discover
+	Retries  int               `toml:"retries"` // extra attempts at a valid reading, defaults to 0
+	// Optional probe tuning, see device.DS18B20Settings
+	Resolution           int      `toml:"resolution"`            // 9-12 bits, defaults to leaving the probe alone
+	ConversionTime       duration `toml:"conversion-time"`       // defaults to the kernel's own
+	TemperatureAttribute bool     `toml:"temperature-attribute"` // read 'temperature' instead of 'w1_slave'
+	// Calibrations of the celsius readings, keyed on probe id
+	Calibrations map[string]*CalibrationConfig `toml:"calibrations"`
+	Processors   []string                      `toml:"processors"`
+	Outputs      []string                      `toml:"outputs"`
+}
+
+// CalibrationConfig holds a list of [raw, actual] calibration points, which a
+// polynomial of the given degree (defaulting to linear) will be fit through
+type CalibrationConfig struct {
+	Points [][]float64 `toml:"points"`
+	Degree int         `toml:"degree"`
+}
+
+func (c *CalibrationConfig) calibration() (device.Calibration, error) {
+	if len(c.Points) == 0 {
+		return device.Calibration{}, fmt.Errorf("no calibration points given")
+	}
+	return newCalibration(0, nil, c.Points, c.Degree)
+}
+
+// Validate checks that the calibrations can be fit, and are for the configured probe
+func (c *DS18B20Config) Validate() error {
+	_, err := c.calibrations()
+	return err
+}
+
+func (c *DS18B20Config) calibrations() (map[string]device.Calibration, error) {
+	calibrations := make(map[string]device.Calibration)
+	for id, calibrationConfig := range c.Calibrations {
+		if !c.Discover && id != c.ID {
+			return nil, fmt.Errorf("ds18b20 calibration given for probe '%s', but only '%s' is read", id, c.ID)
+		}
+		calibration, err := calibrationConfig.calibration()
+		if err != nil {
+			return nil, fmt.Errorf("bad calibration for ds18b20 '%s': %s", id, err)
+		}
+		calibrations[id] = calibration
+	}
+	return calibrations, nil
+}
+
+func (c *DS18B20Config) settings() device.DS18B20Settings {
+	return device.DS18B20Settings{
+		Resolution:              c.Resolution,
+		ConversionTime:          c.ConversionTime.Duration,
+		UseTemperatureAttribute: c.TemperatureAttribute,
+	}
 }
 
 // GenerateDevice creates a DS18B20 device from a given configuration
-// Validates that an ID is given
+// Validates that an ID is given, unless discovery is enabled
 func (c *DS18B20Config) GenerateDevice(name string) (device.Reader, error) {
+	if c.Retries < 0 {
+		return nil, fmt.Errorf("ds18b20 retries cannot be negative")
+	}
+	calibrations, err := c.calibrations()
+	if err != nil {
+		return nil, err
+	}
+	if c.Discover {
+		if c.ID != "" {
+			return nil, fmt.Errorf("ds18b20 id cannot be set when discover is enabled")
+		}
+		bus := device.NewDS18B20Bus(name, c.Aliases)
+		bus.SetRetries(c.Retries)
+		bus.SetCalibrations(calibrations)
+		if err := bus.SetSettings(c.settings()); err != nil {
+			return nil, err
+		}
+		return bus, nil
+	}
 	if c.ID == "" {
 		return nil, fmt.Errorf("ds18b20 id cannot be empty")
 	}
-	return device.NewDS18B20(name, c.ID), nil
+	if len(c.Aliases) > 0 {
+		return nil, fmt.Errorf("ds18b20 aliases can only be used when discover is enabled")
+	}
+	probe := device.NewDS18B20(name, c.ID)
+	probe.SetRetries(c.Retries)
+	probe.SetCalibration(calibrations[c.ID])
+	if err := probe.SetSettings(c.settings()); err != nil {
+		return nil, err
+	}
+	return probe, nil
 }
 
 // OutputNames returns the names of the outputs configured for this
@@ -131,16 +353,133 @@ func (c *DS18B20Config) OutputNames() []string {
 	return c.Outputs
 }
 
-// TiltConfig holds configuration data about a fleet of Tilt Hydrometers (all colors)
+// ProcessorNames returns the names of the processors configured for this
+// DS18B20 device
+func (c *DS18B20Config) ProcessorNames() []string {
+	return c.Processors
+}
+
+// TiltConfig holds configuration data about a fleet of Tilt Hydrometers (all colors).
+// If any colors are configured, only those colors will be read
 type TiltConfig struct {
-	TemperatureCalibration float32  `toml:"temperature_calibration"` // defaults to 0
-	GravityCalibration     float32  `toml:"gravity_calibration"`     // defaults to 0
-	Outputs                []string `toml:"outputs"`
+	TemperatureCalibration float32                     `toml:"temperature_calibration"` // defaults to 0
+	GravityCalibration     float32                     `toml:"gravity_calibration"`     // defaults to 0
+	Colors                 map[string]*TiltColorConfig `toml:"colors"`
+	Processors             []string                    `toml:"processors"`
+	Outputs                []string                    `toml:"outputs"`
+}
+
+// TiltColorConfig holds configuration data about a single color of Tilt Hydrometer.
+// Calibrations default to the ones of the tilt device, and outputs receive this
+// color's samples on top of the outputs of the tilt device.
+// Instead of an offset, a list of [raw, actual] calibration points can be given
+// which a polynomial of the given degree (defaulting to linear) will be fit through
+type TiltColorConfig struct {
+	Alias                        string      `toml:"alias"`
+	TemperatureCalibration       *float32    `toml:"temperature_calibration"`
+	TemperatureCalibrationPoints [][]float64 `toml:"temperature_calibration_points"`
+	TemperatureCalibrationDegree int         `toml:"temperature_calibration_degree"`
+	GravityCalibration           *float32    `toml:"gravity_calibration"`
+	GravityCalibrationPoints     [][]float64 `toml:"gravity_calibration_points"`
+	GravityCalibrationDegree     int         `toml:"gravity_calibration_degree"`
+	Outputs                      []string    `toml:"outputs"`
 }
 
 // GenerateDevice creates a TiltHydrometer device from a given configuration
 func (c *TiltConfig) GenerateDevice(name string) (device.Reader, error) {
-	return device.NewTiltHydrometer(name, c.GravityCalibration, c.TemperatureCalibration)
+	colors, err := c.colorSettings()
+	if err != nil {
+		return nil, err
+	}
+	tilt, err := device.NewTiltHydrometer(name, c.GravityCalibration, c.TemperatureCalibration)
+	if err != nil {
+		return nil, err
+	}
+	if err := tilt.SetColors(colors); err != nil {
+		return nil, err
+	}
+	return tilt, nil
+}
+
+// Validate checks that the configured colors exist, that their calibrations can be fit,
+// and that they don't list outputs of the device, which would get their samples twice
+func (c *TiltConfig) Validate() error {
+	for color, colorConfig := range c.Colors {
+		for _, colorOutput := range colorConfig.Outputs {
+			for _, output := range c.Outputs {
+				if colorOutput == output {
+					return fmt.Errorf("output '%s' of color '%s' already gets every color's samples", output, color)
+				}
+			}
+		}
+	}
+	_, err := c.colorSettings()
+	return err
+}
+
+func (c *TiltConfig) colorSettings() (map[string]device.TiltColorSettings, error) {
+	colors := make(map[string]device.TiltColorSettings)
+	for color, colorConfig := range c.Colors {
+		if !device.IsTiltColor(color) {
+			return nil, fmt.Errorf("unknown tilt color '%s'", color)
+		}
+		temperatureCalibration, err := newCalibration(c.TemperatureCalibration, colorConfig.TemperatureCalibration,
+			colorConfig.TemperatureCalibrationPoints, colorConfig.TemperatureCalibrationDegree)
+		if err != nil {
+			return nil, fmt.Errorf("bad temperature calibration for tilt color '%s': %s", color, err)
+		}
+		gravityCalibration, err := newCalibration(c.GravityCalibration, colorConfig.GravityCalibration,
+			colorConfig.GravityCalibrationPoints, colorConfig.GravityCalibrationDegree)
+		if err != nil {
+			return nil, fmt.Errorf("bad gravity calibration for tilt color '%s': %s", color, err)
+		}
+		colors[color] = device.TiltColorSettings{
+			Alias:                  colorConfig.Alias,
+			TemperatureCalibration: temperatureCalibration,
+			GravityCalibration:     gravityCalibration,
+		}
+	}
+	return colors, nil
+}
+
+// newCalibration returns a calibration fit through the given [raw, actual] points if
+// there are any, otherwise an offset calibration using the offset if given, or the default offset
+func newCalibration(defaultOffset float32, offset *float32, points [][]float64, degree int) (device.Calibration, error) {
+	if len(points) == 0 {
+		if degree != 0 {
+			return device.Calibration{}, fmt.Errorf("a calibration degree needs calibration points")
+		}
+		if offset != nil {
+			return device.OffsetCalibration(*offset), nil
+		}
+		return device.OffsetCalibration(defaultOffset), nil
+	}
+	if offset != nil {
+		return device.Calibration{}, fmt.Errorf("cannot use both a calibration offset and calibration points")
+	}
+	if degree == 0 {
+		degree = 1
+	}
+	calibrationPoints := []device.CalibrationPoint{}
+	for _, p := range points {
+		if len(p) != 2 {
+			return device.Calibration{}, fmt.Errorf("calibration points must be [raw, actual] pairs, got %v", p)
+		}
+		calibrationPoints = append(calibrationPoints, device.CalibrationPoint{Raw: p[0], Actual: p[1]})
+	}
+	return device.FitCalibration(calibrationPoints, degree)
+}
+
+// OutputRoutes returns the outputs configured for each tilt color,
+// which samples are routed to using their 'color' tag
+func (c *TiltConfig) OutputRoutes() (string, map[string][]string) {
+	routes := make(map[string][]string)
+	for color, colorConfig := range c.Colors {
+		if len(colorConfig.Outputs) > 0 {
+			routes[color] = colorConfig.Outputs
+		}
+	}
+	return "color", routes
 }
 
 // OutputNames returns the names of the outputs configured for this
@@ -149,9 +488,248 @@ func (c *TiltConfig) OutputNames() []string {
 	return c.Outputs
 }
 
+// ProcessorNames returns the names of the processors configured for this
+// tilt hydrometer configuration
+func (c *TiltConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
+// BLESensorsConfig holds configuration data about Bluetooth LE sensors that
+// broadcast their data in advertisements (RAPT Pill, ATC thermometers, etc)
+type BLESensorsConfig struct {
+	Decoders   []string `toml:"decoders"`  // names of the decoders to use
+	Addresses  []string `toml:"addresses"` // only read sensors with these addresses
+	Processors []string `toml:"processors"`
+	Outputs    []string `toml:"outputs"`
+}
+
+// GenerateDevice creates a BLESensors device from a given configuration
+// Validates that at least one decoder is given, and that they all exist
+func (c *BLESensorsConfig) GenerateDevice(name string) (device.Reader, error) {
+	decoders, err := c.decoders()
+	if err != nil {
+		return nil, err
+	}
+	return device.NewBLESensors(name, decoders, c.Addresses...)
+}
+
+func (c *BLESensorsConfig) decoders() ([]device.BLEDecoder, error) {
+	if len(c.Decoders) == 0 {
+		return nil, fmt.Errorf("at least one ble decoder must be given, choose from %v", device.BLEDecoderNames())
+	}
+	decoders := []device.BLEDecoder{}
+	for _, name := range c.Decoders {
+		d, err := device.LookupBLEDecoder(name)
+		if err != nil {
+			return nil, err
+		}
+		decoders = append(decoders, d)
+	}
+	return decoders, nil
+}
+
+// OutputNames returns the names of the outputs configured for this
+// ble sensors configuration
+func (c *BLESensorsConfig) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// ble sensors configuration
+func (c *BLESensorsConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
+// HwmonConfig holds configuration data about the kernel's hwmon and thermal zone
+// temperature sensors. By default every sensor found is read
+type HwmonConfig struct {
+	Include    []string `toml:"include"` // chip names or chip/label pairs to read
+	Processors []string `toml:"processors"`
+	Outputs    []string `toml:"outputs"`
+}
+
+// GenerateDevice creates a Hwmon device from a given configuration
+func (c *HwmonConfig) GenerateDevice(name string) (device.Reader, error) {
+	return device.NewHwmon(name, c.Include...), nil
+}
+
+// OutputNames returns the names of the outputs configured for this
+// hwmon device configuration
+func (c *HwmonConfig) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// hwmon device configuration
+func (c *HwmonConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
+// BME280Config holds configuration data about a BME280 temperature,
+// humidity and pressure sensor connected over I2C
+type BME280Config struct {
+	I2CDevice  string   `toml:"i2c-device"` // defaults to /dev/i2c-1
+	Address    string   `toml:"address"`    // defaults to 0x76
+	Processors []string `toml:"processors"`
+	Outputs    []string `toml:"outputs"`
+}
+
+// GenerateDevice creates a BME280 device from a given configuration
+func (c *BME280Config) GenerateDevice(name string) (device.Reader, error) {
+	bus, err := newI2CBus(c.I2CDevice, c.Address, device.BME280DefaultAddress)
+	if err != nil {
+		return nil, err
+	}
+	return device.NewBME280(name, bus), nil
+}
+
+// OutputNames returns the names of the outputs configured for this
+// BME280 device
+func (c *BME280Config) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// BME280 device
+func (c *BME280Config) ProcessorNames() []string {
+	return c.Processors
+}
+
+// SHT3xConfig holds configuration data about an SHT3x temperature
+// and humidity sensor connected over I2C
+type SHT3xConfig struct {
+	I2CDevice  string   `toml:"i2c-device"` // defaults to /dev/i2c-1
+	Address    string   `toml:"address"`    // defaults to 0x44
+	Processors []string `toml:"processors"`
+	Outputs    []string `toml:"outputs"`
+}
+
+// GenerateDevice creates an SHT3x device from a given configuration
+func (c *SHT3xConfig) GenerateDevice(name string) (device.Reader, error) {
+	bus, err := newI2CBus(c.I2CDevice, c.Address, device.SHT3xDefaultAddress)
+	if err != nil {
+		return nil, err
+	}
+	return device.NewSHT3x(name, bus), nil
+}
+
+// OutputNames returns the names of the outputs configured for this
+// SHT3x device
+func (c *SHT3xConfig) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// SHT3x device
+func (c *SHT3xConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
+// HX711Config holds configuration data about an HX711 load cell amplifier
+// connected to two GPIO lines
+type HX711Config struct {
+	GPIOChip    string   `toml:"gpio-chip"` // defaults to /dev/gpiochip0
+	DoutLine    *int     `toml:"dout-line"`
+	SckLine     *int     `toml:"sck-line"`
+	Gain        int      `toml:"gain"`         // defaults to 128
+	Samples     int      `toml:"samples"`      // readings to take the median of, defaults to 1
+	Tare        float64  `toml:"tare"`         // raw reading with nothing on the scale
+	Scale       float64  `toml:"scale"`        // raw reading change per kilogram
+	EmptyWeight float64  `toml:"empty-weight"` // kilograms, to report what's left in a keg
+	Density     float64  `toml:"density"`      // kg/L of the beer, defaults to 1.01
+	Processors  []string `toml:"processors"`
+	Outputs     []string `toml:"outputs"`
+}
+
+// GenerateDevice creates an HX711 device from a given configuration
+// Validates that both GPIO lines are given
+func (c *HX711Config) GenerateDevice(name string) (device.Reader, error) {
+	if c.DoutLine == nil || c.SckLine == nil {
+		return nil, fmt.Errorf("hx711 dout-line and sck-line must both be set")
+	}
+	chip := c.GPIOChip
+	if chip == "" {
+		chip = defaultGPIOChip
+	}
+	return device.NewHX711(name,
+		device.NewGPIOInput(chip, *c.DoutLine),
+		device.NewGPIOOutput(chip, *c.SckLine),
+		device.HX711Settings{
+			Gain:        c.Gain,
+			Samples:     c.Samples,
+			Tare:        c.Tare,
+			Scale:       c.Scale,
+			EmptyWeight: c.EmptyWeight,
+			Density:     c.Density,
+		},
+	)
+}
+
+// OutputNames returns the names of the outputs configured for this
+// HX711 device
+func (c *HX711Config) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// HX711 device
+func (c *HX711Config) ProcessorNames() []string {
+	return c.Processors
+}
+
+// PulseCounterConfig holds configuration data about a pulse counting device
+// (airlock bubble counter, flow meter) connected to a GPIO line
+type PulseCounterConfig struct {
+	GPIOChip       string   `toml:"gpio-chip"` // defaults to /dev/gpiochip0
+	Line           *int     `toml:"line"`
+	Edge           string   `toml:"edge"`             // rising, falling or both. Defaults to rising
+	Debounce       duration `toml:"debounce"`         // ignore edges closer together than this
+	PulsesPerLiter float64  `toml:"pulses-per-liter"` // for flow meters
+	Processors     []string `toml:"processors"`
+	Outputs        []string `toml:"outputs"`
+}
+
+// GenerateDevice creates a PulseCounter device from a given configuration
+// Validates that a GPIO line is given
+func (c *PulseCounterConfig) GenerateDevice(name string) (device.Reader, error) {
+	if c.Line == nil {
+		return nil, fmt.Errorf("pulse-counter line must be set")
+	}
+	if c.PulsesPerLiter < 0 {
+		return nil, fmt.Errorf("pulse-counter pulses-per-liter cannot be negative")
+	}
+	edge := device.RisingEdge
+	if c.Edge != "" {
+		var err error
+		edge, err = device.ParseEdge(c.Edge)
+		if err != nil {
+			return nil, err
+		}
+	}
+	chip := c.GPIOChip
+	if chip == "" {
+		chip = defaultGPIOChip
+	}
+	counter := device.NewGPIOEdgeCounter(chip, *c.Line, edge, c.Debounce.Duration)
+	return device.NewPulseCounter(name, counter, c.PulsesPerLiter), nil
+}
+
+// OutputNames returns the names of the outputs configured for this
+// pulse counter device
+func (c *PulseCounterConfig) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// pulse counter device
+func (c *PulseCounterConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
 // DummyDeviceConfig holds configuration data about a DummyDevice
 type DummyDeviceConfig struct {
 	PossibleValues []float32 `toml:"possible-values"`
+	Processors     []string  `toml:"processors"`
 	Outputs        []string  `toml:"outputs"`
 }
 
@@ -166,10 +744,75 @@ func (c *DummyDeviceConfig) OutputNames() []string {
 	return c.Outputs
 }
 
+// ProcessorNames returns the names of the processors configured for this
+// dummy device configuration
+func (c *DummyDeviceConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
+// VirtualConfig holds configuration data about a virtual device, computing its
+// datapoints from expressions over the latest values of other devices
+type VirtualConfig struct {
+	Datapoints map[string]string `toml:"datapoints"`  // datapoint name = "expression"
+	StaleAfter duration          `toml:"stale-after"` // defaults to never
+	Processors []string          `toml:"processors"`
+	Outputs    []string          `toml:"outputs"`
+
+	// the latest values of other devices, set when generating all devices
+	store *state.Store
+}
+
+// Validate checks that there are datapoints, and their expressions are valid
+func (c *VirtualConfig) Validate() error {
+	_, err := c.expressions()
+	return err
+}
+
+func (c *VirtualConfig) expressions() (map[string]*state.Expression, error) {
+	if len(c.Datapoints) == 0 {
+		return nil, fmt.Errorf("at least one datapoint must be given")
+	}
+	expressions := make(map[string]*state.Expression)
+	for name, text := range c.Datapoints {
+		e, err := state.ParseExpression(text)
+		if err != nil {
+			return nil, fmt.Errorf("datapoint '%s': %s", name, err)
+		}
+		expressions[name] = e
+	}
+	return expressions, nil
+}
+
+// GenerateDevice creates a Virtual device from a given configuration. It reads the
+// values of the other devices generated along with it, by Config.Generate
+func (c *VirtualConfig) GenerateDevice(name string) (device.Reader, error) {
+	if c.store == nil {
+		return nil, fmt.Errorf("virtual device '%s' must be generated along with other devices", name)
+	}
+	expressions, err := c.expressions()
+	if err != nil {
+		return nil, err
+	}
+	return device.NewVirtual(name, c.store, expressions, c.StaleAfter.Duration), nil
+}
+
+// OutputNames returns the names of the outputs configured for this
+// virtual device configuration
+func (c *VirtualConfig) OutputNames() []string {
+	return c.Outputs
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// virtual device configuration
+func (c *VirtualConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
 // OUTPUT CONFIG STRUCTS
 
 // LogConfig holds configuration data about a logger (using zap)
 type LogConfig struct {
+	Processors []string `toml:"processors"`
 }
 
 // GenerateOutput creates a LoggingCallback output from a given configuration
@@ -181,10 +824,17 @@ func (c *LogConfig) GenerateOutput() (outputs.Callback, error) {
 	return outputs.NewLoggingCallback(l), nil
 }
 
+// ProcessorNames returns the names of the processors configured for this
+// logging output configuration
+func (c *LogConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
 // InfluxdbConfig holds configuration data for an influxdb database
 type InfluxdbConfig struct {
-	Address  string `toml:"address"`
-	Database string `toml:"database"`
+	Address    string   `toml:"address"`
+	Database   string   `toml:"database"`
+	Processors []string `toml:"processors"`
 }
 
 // GenerateOutput creates an InfluxdbCallback output from a given configuration
@@ -197,8 +847,66 @@ func (c *InfluxdbConfig) GenerateOutput() (outputs.Callback, error) {
 	return outputs.NewInfluxDBCallback(c.Address, c.Database)
 }
 
+// ProcessorNames returns the names of the processors configured for this
+// influxdb output configuration
+func (c *InfluxdbConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
+// WebhookConfig holds configuration data for posting events (like a
+// fermentation getting stuck) to a URL. Other samples aren't sent
+type WebhookConfig struct {
+	URL        string   `toml:"url"`
+	Timeout    duration `toml:"timeout"` // defaults to 10s
+	Processors []string `toml:"processors"`
+}
+
+// GenerateOutput creates an AlertCallback posting to a webhook from a given configuration
+func (c *WebhookConfig) GenerateOutput() (outputs.Callback, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("url must be provided for webhook output")
+	}
+	timeout := c.Timeout.Duration
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return outputs.NewAlertCallback(outputs.NewWebhookAlerter(c.URL, timeout)), nil
+}
+
+// ProcessorNames returns the names of the processors configured for this
+// webhook output configuration
+func (c *WebhookConfig) ProcessorNames() []string {
+	return c.Processors
+}
+
 // HELPERS
 
+// the i2c-dev character device used when none is configured,
+// which is the bus broken out on a raspberry pi's GPIO header
+var defaultI2CDevice = device.I2CDevPath(1)
+
+// the GPIO chip used when none is configured, which holds
+// the lines on a raspberry pi's GPIO header
+var defaultGPIOChip = device.GPIOChipPath(0)
+
+// creates an I2C bus from an i2c-dev path and an address given as a string
+// (TOML has no hex integers, and I2C addresses are always written in hex),
+// using defaults for anything left empty
+func newI2CBus(path, address string, defaultAddress uint16) (device.I2CBus, error) {
+	if path == "" {
+		path = defaultI2CDevice
+	}
+	addr := defaultAddress
+	if address != "" {
+		a, err := strconv.ParseUint(address, 0, 7)
+		if err != nil {
+			return nil, fmt.Errorf("invalid i2c address '%s'", address)
+		}
+		addr = uint16(a)
+	}
+	return device.NewI2CDev(path, addr), nil
+}
+
 // from the README at https://github.com/BurntSushi/toml
 type duration struct {
 	time.Duration
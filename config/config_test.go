@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/nherson/brewski/device"
+	"github.com/nherson/brewski/measurement"
 	"github.com/nherson/brewski/outputs"
 	"github.com/stretchr/testify/assert"
 )
@@ -86,6 +89,66 @@ func TestDS18B20Config(t *testing.T) {
 	d2, err := badConfig.GenerateDevice("name2")
 	assert.Nil(t, d2)
 	assert.NotNil(t, err)
+
+	discoverConfig := &DS18B20Config{
+		Discover: true,
+		Aliases:  map[string]string{"28-abc123": "fermenter"},
+	}
+	d3, err := discoverConfig.GenerateDevice("name3")
+	assert.Nil(t, err)
+	assert.Equal(t, "name3", d3.Name())
+
+	// An ID and discovery are mutually exclusive
+	badDiscoverConfig := &DS18B20Config{
+		ID:       "abc123",
+		Discover: true,
+	}
+	d4, err := badDiscoverConfig.GenerateDevice("name4")
+	assert.Nil(t, d4)
+	assert.NotNil(t, err)
+
+	// Aliases only make sense when discovering probes
+	badAliasConfig := &DS18B20Config{
+		ID:      "abc123",
+		Aliases: map[string]string{"28-abc123": "fermenter"},
+	}
+	d5, err := badAliasConfig.GenerateDevice("name5")
+	assert.Nil(t, d5)
+	assert.NotNil(t, err)
+
+	badRetriesConfig := &DS18B20Config{
+		ID:      "abc123",
+		Retries: -1,
+	}
+	d6, err := badRetriesConfig.GenerateDevice("name6")
+	assert.Nil(t, d6)
+	assert.NotNil(t, err)
+
+	badResolutionConfig := &DS18B20Config{
+		ID:         "abc123",
+		Resolution: 14,
+	}
+	d7, err := badResolutionConfig.GenerateDevice("name7")
+	assert.Nil(t, d7)
+	assert.NotNil(t, err)
+}
+
+func TestDS18B20SettingsConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.ds18b20.probe]
+	id = "28-abc123"
+	resolution = 10
+	conversion-time = "200ms"
+	temperature-attribute = true
+	`))
+	assert.Nil(t, err)
+	probeConfig := c.Devices.DS18B20s["probe"]
+	assert.Equal(t, 10, probeConfig.settings().Resolution)
+	assert.Equal(t, 200*time.Millisecond, probeConfig.settings().ConversionTime)
+	assert.True(t, probeConfig.settings().UseTemperatureAttribute)
+	d, err := probeConfig.GenerateDevice("probe")
+	assert.Nil(t, err)
+	assert.NotNil(t, d)
 }
 
 func TestInfluxDBConfig(t *testing.T) {
@@ -115,3 +178,342 @@ func TestInfluxDBConfig(t *testing.T) {
 	assert.Nil(t, o)
 	assert.NotNil(t, err)
 }
+
+func TestWebhookConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[outputs.webhook.pager]
+	url = "http://localhost:8080/brewski"
+	timeout = "5s"
+	`))
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Second, c.Outputs.Webhooks["pager"].Timeout.Duration)
+	o, err := c.Outputs.Webhooks["pager"].GenerateOutput()
+	assert.Nil(t, err)
+	assert.NotNil(t, o)
+
+	_, err = (&WebhookConfig{}).GenerateOutput()
+	assert.NotNil(t, err)
+}
+
+func TestHwmonConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[global]
+	sysfs-class-dir = "../testdata/sysfs/class"
+
+	[devices.hwmon.controller-box]
+	include = ["cpu_thermal", "lm75/ambient"]
+	`))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cpu_thermal", "lm75/ambient"}, c.Devices.Hwmons["controller-box"].Include)
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pollers))
+}
+
+func TestI2CConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.bme280.chamber]
+	address = "0x77"
+
+	[devices.sht3x.ambient]
+	i2c-device = "/dev/i2c-0"
+	`))
+	assert.Nil(t, err)
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pollers))
+
+	bus, err := newI2CBus("", "", 0x44)
+	assert.Nil(t, err)
+	assert.Equal(t, device.NewI2CDev("/dev/i2c-1", 0x44), bus)
+	bus, err = newI2CBus("/dev/i2c-0", "0x77", 0x76)
+	assert.Nil(t, err)
+	assert.Equal(t, device.NewI2CDev("/dev/i2c-0", 0x77), bus)
+
+	// addresses are 7 bits
+	badConfig := &BME280Config{
+		Address: "0x80",
+	}
+	d, err := badConfig.GenerateDevice("chamber")
+	assert.Nil(t, d)
+	assert.NotNil(t, err)
+
+	badConfig = &BME280Config{
+		Address: "seventy-six",
+	}
+	d, err = badConfig.GenerateDevice("chamber")
+	assert.Nil(t, d)
+	assert.NotNil(t, err)
+}
+
+func TestHX711Config(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.hx711.keg-1]
+	dout-line = 5
+	sck-line = 6
+	samples = 5
+	tare = 8230.5
+	scale = 21580.0
+	empty-weight = 4.4
+	`))
+	assert.Nil(t, err)
+	d, err := c.Devices.HX711s["keg-1"].GenerateDevice("keg-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "keg-1", d.Name())
+
+	// line 0 is a valid line, but the lines must be given
+	badConfig := &HX711Config{
+		DoutLine: new(int),
+		Scale:    1,
+	}
+	d, err = badConfig.GenerateDevice("keg-2")
+	assert.Nil(t, d)
+	assert.NotNil(t, err)
+
+	// bad settings are caught
+	line := 1
+	badConfig = &HX711Config{
+		DoutLine: new(int),
+		SckLine:  &line,
+	}
+	d, err = badConfig.GenerateDevice("keg-3")
+	assert.Nil(t, d)
+	assert.NotNil(t, err)
+}
+
+func TestPulseCounterConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.pulse-counter.airlock]
+	line = 17
+	edge = "falling"
+	debounce = "20ms"
+
+	[devices.pulse-counter.flow-meter]
+	line = 27
+	pulses-per-liter = 450.0
+	`))
+	assert.Nil(t, err)
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pollers))
+
+	badConfig := &PulseCounterConfig{}
+	d, err := badConfig.GenerateDevice("airlock")
+	assert.Nil(t, d)
+	assert.NotNil(t, err)
+
+	badConfig = &PulseCounterConfig{
+		Line: new(int),
+		Edge: "up",
+	}
+	d, err = badConfig.GenerateDevice("airlock")
+	assert.Nil(t, d)
+	assert.NotNil(t, err)
+}
+
+func TestBLESensorsConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.ble.chamber]
+	decoders = ["rapt-pill", "atc"]
+	addresses = ["a4:c1:38:11:22:33"]
+	`))
+	assert.Nil(t, err)
+	decoders, err := c.Devices.BLESensors["chamber"].decoders()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(decoders))
+	assert.Equal(t, "rapt-pill", decoders[0].Name())
+
+	badConfig := &BLESensorsConfig{}
+	_, err = badConfig.decoders()
+	assert.NotNil(t, err)
+
+	badConfig = &BLESensorsConfig{
+		Decoders: []string{"plaato"},
+	}
+	_, err = badConfig.decoders()
+	assert.NotNil(t, err)
+}
+
+func TestTiltConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.tilt.fermenters]
+	gravity_calibration = 0.002
+	outputs = ["everything"]
+	[devices.tilt.fermenters.colors.red]
+	alias = "lager"
+	gravity_calibration = -0.001
+	outputs = ["lager-dashboard"]
+	[devices.tilt.fermenters.colors.blue]
+	alias = "stout"
+	`))
+	assert.Nil(t, err)
+	tiltConfig := c.Devices.Tilts["fermenters"]
+	colors, err := tiltConfig.colorSettings()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(colors))
+	assert.Equal(t, "lager", colors["red"].Alias)
+	assert.Equal(t, device.OffsetCalibration(-0.001), colors["red"].GravityCalibration)
+	// falls back to the device's calibration
+	assert.Equal(t, device.OffsetCalibration(0.002), colors["blue"].GravityCalibration)
+
+	tag, routes := tiltConfig.OutputRoutes()
+	assert.Equal(t, "color", tag)
+	assert.Equal(t, map[string][]string{"red": {"lager-dashboard"}}, routes)
+
+	badConfig := &TiltConfig{
+		Colors: map[string]*TiltColorConfig{"chartreuse": {}},
+	}
+	_, err = badConfig.colorSettings()
+	assert.NotNil(t, err)
+
+	// a color's outputs can't also be the device's, or they'd get its samples twice
+	_, err = ParseConfig([]byte(`
+	[devices.tilt.fermenters]
+	outputs = ["everything"]
+	[devices.tilt.fermenters.colors.red]
+	outputs = ["lager-dashboard", "everything"]
+	`))
+	assert.NotNil(t, err)
+}
+
+func TestTiltCalibrationConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.tilt.fermenters]
+	gravity_calibration = 0.002
+	[devices.tilt.fermenters.colors.red]
+	gravity_calibration_points = [[1.000, 1.000], [1.036, 1.040], [1.080, 1.080]]
+	gravity_calibration_degree = 2
+	temperature_calibration_points = [[33.0, 32.0], [213.0, 212.0]]
+	[devices.tilt.fermenters.colors.blue]
+	`))
+	assert.Nil(t, err)
+	colors, err := c.Devices.Tilts["fermenters"].colorSettings()
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.040, colors["red"].GravityCalibration.Apply(1.036), 1e-6)
+	assert.InDelta(t, 67, colors["red"].TemperatureCalibration.Apply(68), 1e-4)
+	assert.InDelta(t, 1.052, colors["blue"].GravityCalibration.Apply(1.050), 1e-6)
+
+	// not enough points for the degree
+	_, err = ParseConfig([]byte(`
+	[devices.tilt.fermenters.colors.red]
+	gravity_calibration_points = [[1.000, 1.000], [1.050, 1.052]]
+	gravity_calibration_degree = 2
+	`))
+	assert.NotNil(t, err)
+
+	// not pairs
+	_, err = ParseConfig([]byte(`
+	[devices.tilt.fermenters.colors.red]
+	gravity_calibration_points = [[1.000, 1.000, 1.002], [1.050, 1.052]]
+	`))
+	assert.NotNil(t, err)
+
+	// both an offset and points
+	_, err = ParseConfig([]byte(`
+	[devices.tilt.fermenters.colors.red]
+	temperature_calibration = 1.0
+	temperature_calibration_points = [[33.0, 32.0], [213.0, 212.0]]
+	`))
+	assert.NotNil(t, err)
+
+	// a degree without points
+	_, err = ParseConfig([]byte(`
+	[devices.tilt.fermenters.colors.red]
+	gravity_calibration_degree = 2
+	`))
+	assert.NotNil(t, err)
+}
+
+func TestBluetoothConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[global.bluetooth]
+	replay = "../testdata/ble/tilt-capture.jsonl"
+	replay-speed = 60.0
+
+	[devices.tilt.fermenters]
+	`))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(60), c.Global.Bluetooth.ReplaySpeed)
+	defer device.SetBluetoothSettings(device.BluetoothSettings{})
+	// replaying doesn't need any bluetooth hardware
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pollers))
+
+	_, err = ParseConfig([]byte(`
+	[global.bluetooth]
+	capture = "capture.jsonl"
+	replay = "capture.jsonl"
+	`))
+	assert.NotNil(t, err)
+
+	_, err = ParseConfig([]byte(`
+	[global.bluetooth]
+	adapter = "the usb one"
+	`))
+	assert.NotNil(t, err)
+}
+
+func TestUnitsConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[global.units]
+	temperature = "fahrenheit"
+	gravity = "plato"
+
+	[devices.dummy-device.foobar]
+	possible-values = [2.0]
+	outputs = ["logs"]
+
+	[outputs.log.logs]
+	`))
+	assert.Nil(t, err)
+	units, err := c.Global.displayUnits()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []measurement.Unit{measurement.Fahrenheit, measurement.Plato}, units)
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pollers))
+
+	for _, bad := range []string{
+		`temperature = "kelvin"`,
+		`temperature = "plato"`,
+		`color = "red"`,
+	} {
+		_, err = ParseConfig([]byte("[global.units]\n" + bad))
+		assert.NotNil(t, err, bad)
+	}
+}
+
+func TestVirtualConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[devices.dummy-device.fermenter]
+	possible-values = [19.0]
+	[devices.dummy-device.ambient]
+	possible-values = [22.5]
+
+	[devices.virtual.derived]
+	stale-after = "5m"
+	[devices.virtual.derived.datapoints]
+	fermenter-delta = "fermenter.random - ambient.random"
+	average = "avg(fermenter.random, ambient.random)"
+	`))
+	assert.Nil(t, err)
+	assert.Equal(t, 5*time.Minute, c.Devices.Virtuals["derived"].StaleAfter.Duration)
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(pollers))
+
+	// virtual devices need the other devices' values
+	_, err = (&VirtualConfig{Datapoints: map[string]string{"x": "a.b"}}).GenerateDevice("x")
+	assert.NotNil(t, err)
+
+	for _, bad := range []string{`
+	[devices.virtual.derived]
+	`, `
+	[devices.virtual.derived.datapoints]
+	delta = "fermenter.random - "
+	`} {
+		_, err = ParseConfig([]byte(bad))
+		assert.NotNil(t, err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/nherson/brewski/device"
 	"github.com/nherson/brewski/outputs"
+	"github.com/nherson/brewski/processors"
+	"github.com/nherson/brewski/state"
 	"go.uber.org/zap"
 )
 
@@ -14,6 +16,22 @@ import (
 func (c *Config) Generate() ([]device.Poller, error) {
 	// Get some global config options
 	pollingInterval := c.Global.PollingInterval.Duration
+	if c.Global.OnesireSysfsDir != "" {
+		device.SetOnewireSysfsDir(c.Global.OnesireSysfsDir)
+	}
+	if c.Global.SysfsClassDir != "" {
+		device.SetSysfsClassDir(c.Global.SysfsClassDir)
+	}
+	if err := device.SetBluetoothSettings(c.Global.Bluetooth.settings()); err != nil {
+		return nil, err
+	}
+
+	// The latest values read from every device, shared across the process for virtual
+	// devices to compute theirs from and for the state API
+	store := state.Default
+	for _, virtualConfig := range c.Devices.Virtuals {
+		virtualConfig.store = store
+	}
 
 	// Get raw device configs for looking up device<-->outputs mappings
 	deviceConfigs, err := c.Devices.AllDeviceConfigs()
@@ -26,9 +44,79 @@ func (c *Config) Generate() ([]device.Poller, error) {
 		return nil, err
 	}
 
+	processorConfigs, err := c.Processors.AllProcessorConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	// getProcessors generates the named processors. Unlike outputs, processors aren't
+	// shared: they may keep state per series, and two outputs of the same device
+	// would otherwise feed them the same samples twice
+	getProcessors := func(processorNames []string, user string) ([]processors.Processor, error) {
+		ps := []processors.Processor{}
+		for _, processorName := range processorNames {
+			processorConfig, found := processorConfigs[processorName]
+			if !found {
+				return nil, fmt.Errorf("processor '%s' does not exist for %s", processorName, user)
+			}
+			processor, err := processorConfig.GenerateProcessor()
+			if err != nil {
+				return nil, fmt.Errorf("invalid processor '%s': %s", processorName, err)
+			}
+			ps = append(ps, processor)
+		}
+		return ps, nil
+	}
+
+	// Outputs display datapoints in the preferred units, if any
+	var displayUnits processors.Processor
+	if len(c.Global.Units) > 0 {
+		units, err := c.Global.displayUnits()
+		if err != nil {
+			return nil, err
+		}
+		if displayUnits, err = processors.NewDisplayUnits(units...); err != nil {
+			return nil, err
+		}
+	}
+
 	// A place to store outputs that have already been generated
 	generatedOutputs := make(map[string]outputs.Callback)
 
+	// getOutput returns the named output, generating it if it hasn't been yet
+	getOutput := func(outputName, deviceName string) (outputs.Callback, error) {
+		// See if the output has already been generated and cached
+		if output, found := generatedOutputs[outputName]; found {
+			return output, nil
+		}
+		// If not found, generate it
+		outputConfig, found := outputConfigs[outputName]
+		// If the requested output doesn't exist, that's a config error
+		if !found {
+			return nil, fmt.Errorf("output '%s' does not exist for device '%s'", outputName, deviceName)
+		}
+		// Generate the output
+		output, err := outputConfig.GenerateOutput()
+		if err != nil {
+			return nil, err
+		}
+		// Run samples through the output's processors before it sees them,
+		// converting to the display units last
+		ps, err := getProcessors(outputConfig.ProcessorNames(), fmt.Sprintf("output '%s'", outputName))
+		if err != nil {
+			return nil, err
+		}
+		if displayUnits != nil {
+			ps = append(ps, displayUnits)
+		}
+		if len(ps) > 0 {
+			output = processors.NewPipeline(output, ps...)
+		}
+		// Cache generated output for later
+		generatedOutputs[outputName] = output
+		return output, nil
+	}
+
 	pollers := []device.Poller{}
 
 	// Iterate over each device, generating (or pulling from cache) all
@@ -48,35 +136,44 @@ func (c *Config) Generate() ([]device.Poller, error) {
 		}
 		sensor := device.NewSensor(d, pollingInterval, sensorLogger)
 
-		// create a chained callback for the sensor
+		// create a chained callback for the sensor, keeping the latest values first
 		callbackChain := outputs.NewChainCallback()
+		callbackChain.RegisterCallback(store)
 		for _, outputName := range deviceConfig.OutputNames() {
-			var output outputs.Callback
-			var outputConfig OutputConfig
-			var found bool
-			var err error
-			output, found = generatedOutputs[outputName]
-			// See if the output has already been generated and cached
-			if !found {
-				// If not found, generate it
-				outputConfig, found = outputConfigs[outputName]
-				// If the requested output doesn't exist, that's a config error
-				if !found {
-					return nil, fmt.Errorf("output '%s' does not exist for device '%s'", outputName, deviceName)
-				}
-				// Generate the output
-				output, err = outputConfig.GenerateOutput()
-				if err != nil {
-					return nil, err
-				}
-				// Cache generated output for later
-				generatedOutputs[outputName] = output
+			output, err := getOutput(outputName, deviceName)
+			if err != nil {
+				return nil, err
 			}
 			// Register the output in the callback chain
 			callbackChain.RegisterCallback(output)
 		}
-		// Assign the callback chain to the sensor
-		sensor.SetCallback(callbackChain)
+		// Some devices send samples to extra outputs based on their tags
+		if routedConfig, ok := deviceConfig.(RoutedDeviceConfig); ok {
+			tag, routes := routedConfig.OutputRoutes()
+			router := outputs.NewTagRouter(tag)
+			for value, outputNames := range routes {
+				routeChain := outputs.NewChainCallback()
+				for _, outputName := range outputNames {
+					output, err := getOutput(outputName, deviceName)
+					if err != nil {
+						return nil, err
+					}
+					routeChain.RegisterCallback(output)
+				}
+				router.Route(value, routeChain)
+			}
+			callbackChain.RegisterCallback(router)
+		}
+		// Assign the callback chain to the sensor, running the device's processors before anything else
+		var callback outputs.Callback = callbackChain
+		if processorNames := deviceConfig.ProcessorNames(); len(processorNames) > 0 {
+			ps, err := getProcessors(processorNames, fmt.Sprintf("device '%s'", deviceName))
+			if err != nil {
+				return nil, err
+			}
+			callback = processors.NewPipeline(callback, ps...)
+		}
+		sensor.SetCallback(callback)
 		// Append sensor to list of returned sensors
 		pollers = append(pollers, sensor)
 	}
@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/nherson/brewski/processors"
+	"github.com/nherson/brewski/state"
+)
+
+// ProcessorsConfig holds configuration data for each processor being setup for use.
+// Processors are referenced by name from the 'processors' list of devices and outputs
+type ProcessorsConfig struct {
+	Renames       map[string]*RenameConfig         `toml:"rename"`
+	Tags          map[string]*StaticTagsConfig     `toml:"tags"`
+	Converts      map[string]*ConvertConfig        `toml:"convert"`
+	Clamps        map[string]*ClampConfig          `toml:"clamp"`
+	Filters       map[string]*FilterConfig         `toml:"filter"`
+	Medians       map[string]*MedianConfig         `toml:"median"`
+	EMAs          map[string]*EMAConfig            `toml:"ema"`
+	Hampels       map[string]*HampelConfig         `toml:"hampel"`
+	RateGates     map[string]*RateGateConfig       `toml:"rate-gate"`
+	Fermentations map[string]*FermentationConfig   `toml:"fermentation"`
+	Stalls        map[string]*StallConfig          `toml:"stall"`
+	Aggregates    map[string]*AggregateConfig      `toml:"aggregate"`
+	Compensations map[string]*CompensationConfig   `toml:"gravity-compensation"`
+	Metrics       map[string]*GravityMetricsConfig `toml:"gravity-metrics"`
+}
+
+// AllProcessorConfigs returns a mapping from processor names to their configuration
+func (p *ProcessorsConfig) AllProcessorConfigs() (map[string]ProcessorConfig, error) {
+	processorConfigs := make(map[string]ProcessorConfig)
+	for name, processorConfig := range p.Renames {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Tags {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Converts {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Clamps {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Filters {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Medians {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.EMAs {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Hampels {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.RateGates {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Fermentations {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Stalls {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Aggregates {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Compensations {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	for name, processorConfig := range p.Metrics {
+		if _, found := processorConfigs[name]; found {
+			return nil, fmt.Errorf("duplicate processor declared '%s'", name)
+		}
+		processorConfigs[name] = processorConfig
+	}
+	return processorConfigs, nil
+}
+
+// ProcessorConfig is some configuration for a processor that
+// can be used to generate a corresponding processors.Processor
+type ProcessorConfig interface {
+	GenerateProcessor() (processors.Processor, error)
+}
+
+// RenameConfig holds configuration data about renaming datapoints
+type RenameConfig struct {
+	Datapoints map[string]string `toml:"datapoints"` // old name = "new name"
+}
+
+// GenerateProcessor creates a Rename processor from a given configuration
+func (c *RenameConfig) GenerateProcessor() (processors.Processor, error) {
+	if len(c.Datapoints) == 0 {
+		return nil, fmt.Errorf("at least one datapoint must be given to rename")
+	}
+	return processors.NewRename(c.Datapoints), nil
+}
+
+// StaticTagsConfig holds configuration data about tags to add to every sample
+type StaticTagsConfig struct {
+	Tags map[string]string `toml:"tags"`
+}
+
+// GenerateProcessor creates a StaticTags processor from a given configuration
+func (c *StaticTagsConfig) GenerateProcessor() (processors.Processor, error) {
+	if len(c.Tags) == 0 {
+		return nil, fmt.Errorf("at least one tag must be given to add")
+	}
+	return processors.NewStaticTags(measurement.Tags(c.Tags)), nil
+}
+
+// ConvertConfig holds configuration data about converting the units of datapoints,
+// either with a named conversion or by scaling and offsetting their values
+type ConvertConfig struct {
+	Datapoints []string `toml:"datapoints"`
+	Conversion string   `toml:"conversion"`
+	Scale      *float64 `toml:"scale"`  // defaults to 1.0
+	Offset     float64  `toml:"offset"` // defaults to 0.0
+	Unit       string   `toml:"unit"`   // the unit of scaled values, if any
+}
+
+// GenerateProcessor creates a Convert processor from a given configuration
+func (c *ConvertConfig) GenerateProcessor() (processors.Processor, error) {
+	if len(c.Datapoints) == 0 {
+		return nil, fmt.Errorf("at least one datapoint must be given to convert")
+	}
+	if c.Conversion != "" {
+		if c.Scale != nil || c.Offset != 0 || c.Unit != "" {
+			return nil, fmt.Errorf("a conversion cannot be given along with a scale, offset or unit")
+		}
+		conversion, unit, err := processors.LookupConversion(c.Conversion)
+		if err != nil {
+			return nil, err
+		}
+		return processors.NewConvert(conversion, unit, c.Datapoints...), nil
+	}
+	scale := 1.0
+	if c.Scale != nil {
+		scale = *c.Scale
+	}
+	unit := measurement.NoUnit
+	if c.Unit != "" {
+		var err error
+		if unit, err = measurement.LookupUnit(c.Unit); err != nil {
+			return nil, err
+		}
+	}
+	return processors.NewConvert(processors.LinearConversion(scale, c.Offset), unit, c.Datapoints...), nil
+}
+
+// ClampConfig holds configuration data about keeping datapoint values in a range
+type ClampConfig struct {
+	Datapoints []string `toml:"datapoints"` // defaults to all datapoints
+	Min        float32  `toml:"min"`
+	Max        float32  `toml:"max"`
+	Drop       bool     `toml:"drop"` // drop out of range values instead of clamping them
+}
+
+// GenerateProcessor creates a Clamp processor from a given configuration
+func (c *ClampConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewClamp(c.Min, c.Max, c.Drop, c.Datapoints...)
+}
+
+// FilterConfig holds configuration data about which datapoints to keep
+type FilterConfig struct {
+	Keep []string `toml:"keep"` // defaults to all datapoints
+	Drop []string `toml:"drop"`
+}
+
+// GenerateProcessor creates a Filter processor from a given configuration
+func (c *FilterConfig) GenerateProcessor() (processors.Processor, error) {
+	if len(c.Keep) == 0 && len(c.Drop) == 0 {
+		return nil, fmt.Errorf("datapoints to keep or drop must be given")
+	}
+	return processors.NewFilter(c.Keep, c.Drop), nil
+}
+
+// MedianConfig holds configuration data about a median filter
+type MedianConfig struct {
+	Datapoints []string `toml:"datapoints"` // defaults to all datapoints
+	Window     int      `toml:"window"`     // defaults to 5
+}
+
+// GenerateProcessor creates a Median processor from a given configuration
+func (c *MedianConfig) GenerateProcessor() (processors.Processor, error) {
+	window := c.Window
+	if window == 0 {
+		window = 5
+	}
+	return processors.NewMedian(window, c.Datapoints...)
+}
+
+// EMAConfig holds configuration data about an exponential moving average
+type EMAConfig struct {
+	Datapoints []string `toml:"datapoints"` // defaults to all datapoints
+	Alpha      float64  `toml:"alpha"`      // weight of each new value, defaults to 0.2
+}
+
+// GenerateProcessor creates an EMA processor from a given configuration
+func (c *EMAConfig) GenerateProcessor() (processors.Processor, error) {
+	alpha := c.Alpha
+	if alpha == 0 {
+		alpha = 0.2
+	}
+	return processors.NewEMA(alpha, c.Datapoints...)
+}
+
+// HampelConfig holds configuration data about a Hampel outlier filter
+type HampelConfig struct {
+	Datapoints   []string `toml:"datapoints"`    // defaults to all datapoints
+	Window       int      `toml:"window"`        // defaults to 7
+	Threshold    float64  `toml:"threshold"`     // defaults to 3.0
+	MinDeviation float64  `toml:"min-deviation"` // defaults to 0.0
+	Drop         bool     `toml:"drop"`          // drop outliers instead of replacing them
+}
+
+// GenerateProcessor creates a Hampel processor from a given configuration
+func (c *HampelConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewHampel(processors.HampelSettings{
+		Window:       c.Window,
+		Threshold:    c.Threshold,
+		MinDeviation: c.MinDeviation,
+		Drop:         c.Drop,
+	}, c.Datapoints...)
+}
+
+// RateGateConfig holds configuration data about dropping implausibly fast changes
+type RateGateConfig struct {
+	Datapoints []string `toml:"datapoints"` // defaults to all datapoints
+	MaxRate    float64  `toml:"max-rate"`   // largest plausible change per minute
+}
+
+// GenerateProcessor creates a RateGate processor from a given configuration
+func (c *RateGateConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewRateGate(c.MaxRate, c.Datapoints...)
+}
+
+// FermentationConfig holds configuration data about following fermentations
+type FermentationConfig struct {
+	Datapoint       string   `toml:"datapoint"`        // defaults to gravity
+	RateWindow      duration `toml:"rate-window"`      // defaults to 24h
+	StableDuration  duration `toml:"stable-duration"`  // defaults to 72h
+	StableTolerance float32  `toml:"stable-tolerance"` // defaults to 0.001
+	TerminalGravity float32  `toml:"terminal-gravity"`
+	OriginalGravity float32  `toml:"original-gravity"`
+}
+
+// GenerateProcessor creates a Fermentation processor from a given configuration
+func (c *FermentationConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewFermentation(processors.FermentationSettings{
+		Datapoint:       c.Datapoint,
+		RateWindow:      c.RateWindow.Duration,
+		StableDuration:  c.StableDuration.Duration,
+		StableTolerance: c.StableTolerance,
+		TerminalGravity: c.TerminalGravity,
+		OriginalGravity: c.OriginalGravity,
+	})
+}
+
+// StallConfig holds configuration data about detecting fermentations
+// that are slow to start or get stuck
+type StallConfig struct {
+	Datapoint       string   `toml:"datapoint"`       // defaults to gravity
+	LagTime         duration `toml:"lag-time"`        // defaults to 48h
+	LagDrop         float32  `toml:"lag-drop"`        // defaults to 0.002
+	StallTime       duration `toml:"stall-time"`      // defaults to 48h
+	StallTolerance  float32  `toml:"stall-tolerance"` // defaults to 0.001
+	StallMargin     float32  `toml:"stall-margin"`    // defaults to 0.004
+	TerminalGravity float32  `toml:"terminal-gravity"`
+	OriginalGravity float32  `toml:"original-gravity"`
+}
+
+// GenerateProcessor creates a Stall processor from a given configuration
+func (c *StallConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewStall(processors.StallSettings{
+		Datapoint:       c.Datapoint,
+		OriginalGravity: c.OriginalGravity,
+		LagTime:         c.LagTime.Duration,
+		LagDrop:         c.LagDrop,
+		StallTime:       c.StallTime.Duration,
+		StallTolerance:  c.StallTolerance,
+		StallMargin:     c.StallMargin,
+		TerminalGravity: c.TerminalGravity,
+	})
+}
+
+// AggregateConfig holds configuration data about downsampling samples
+// into aggregates over time windows
+type AggregateConfig struct {
+	Window     duration `toml:"window"`
+	Aggregates []string `toml:"aggregates"` // defaults to mean
+}
+
+// GenerateProcessor creates an Aggregate processor from a given configuration
+func (c *AggregateConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewAggregate(c.Window.Duration, c.Aggregates...)
+}
+
+// CompensationConfig holds configuration data about correcting gravity readings
+// for the temperature they were taken at, using the temperature in the same sample
+// or the latest one read from another device
+type CompensationConfig struct {
+	Datapoint   string            `toml:"datapoint"`   // defaults to gravity
+	Temperature string            `toml:"temperature"` // defaults to temperature
+	Unit        string            `toml:"unit"`        // fahrenheit or celsius
+	Reference   float64           `toml:"reference"`   // defaults to 60.0°F or 20.0°C
+	Corrected   string            `toml:"corrected"`   // defaults to <datapoint>-corrected
+	Device      string            `toml:"device"`
+	Tags        map[string]string `toml:"tags"`
+	MaxAge      duration          `toml:"max-age"` // defaults to 5m
+}
+
+// GenerateProcessor creates a GravityCompensation processor from a given configuration
+func (c *CompensationConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewGravityCompensation(processors.CompensationSettings{
+		Datapoint:   c.Datapoint,
+		Temperature: c.Temperature,
+		Unit:        c.Unit,
+		Reference:   c.Reference,
+		Corrected:   c.Corrected,
+		Device:      c.Device,
+		Tags:        measurement.Tags(c.Tags),
+		Values:      state.Default,
+		MaxAge:      c.MaxAge.Duration,
+	})
+}
+
+// GravityMetricsConfig holds configuration data about deriving brewing metrics
+// (plato, brix, attenuation and abv) from gravity readings. Without an original
+// gravity, it is detected as the first stable gravity seen, so restarting brewski
+// mid-fermentation detects it again, from the current gravity
+type GravityMetricsConfig struct {
+	Datapoint       string  `toml:"datapoint"` // defaults to gravity
+	OriginalGravity float32 `toml:"original-gravity"`
+	StableReadings  int     `toml:"stable-readings"`  // defaults to 5
+	StableTolerance float32 `toml:"stable-tolerance"` // defaults to 0.001
+}
+
+// GenerateProcessor creates a GravityMetrics processor from a given configuration
+func (c *GravityMetricsConfig) GenerateProcessor() (processors.Processor, error) {
+	return processors.NewGravityMetrics(processors.GravityMetricsSettings{
+		Datapoint: c.Datapoint,
+		OriginalGravitySettings: processors.OriginalGravitySettings{
+			OriginalGravity: c.OriginalGravity,
+			StableReadings:  c.StableReadings,
+			StableTolerance: c.StableTolerance,
+		},
+	})
+}
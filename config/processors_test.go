@@ -0,0 +1,140 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessorsConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`
+	[processors.convert.to-celsius]
+	datapoints = ["temperature"]
+	conversion = "fahrenheit-to-celsius"
+	[processors.convert.grams]
+	datapoints = ["weight"]
+	scale = 1000.0
+	[processors.tags.batch]
+	tags = { batch = "42" }
+	[processors.clamp.sane]
+	datapoints = ["temperature"]
+	min = -10.0
+	max = 40.0
+	drop = true
+
+	[processors.median.smooth]
+	datapoints = ["gravity"]
+	[processors.ema.smoother]
+	alpha = 0.1
+	[processors.hampel.spikes]
+	datapoints = ["celsius"]
+	min-deviation = 0.5
+	[processors.rate-gate.plausible]
+	datapoints = ["celsius"]
+	max-rate = 1.0
+	[processors.fermentation.progress]
+	stable-duration = "48h"
+	terminal-gravity = 1.012
+	[processors.stall.stuck]
+	original-gravity = 1.052
+	lag-time = "36h"
+	terminal-gravity = 1.012
+	[processors.aggregate.minutely]
+	window = "1m"
+	aggregates = ["mean", "max"]
+	[processors.gravity-compensation.corrected]
+	temperature = "celsius"
+	device = "fermenter-probe"
+	max-age = "10m"
+	[processors.gravity-metrics.metrics]
+	original-gravity = 1.052
+
+	[devices.dummy-device.foobar]
+	possible-values = [2.0]
+	processors = ["to-celsius", "sane", "smooth", "smoother", "spikes", "plausible"]
+	outputs = ["logs"]
+
+	[outputs.log.logs]
+	processors = ["batch", "minutely"]
+	[outputs.log.more-logs]
+	processors = ["minutely"]
+	`))
+	assert.Nil(t, err)
+	processorConfigs, err := c.Processors.AllProcessorConfigs()
+	assert.Nil(t, err)
+	assert.Equal(t, 13, len(processorConfigs))
+	assert.Equal(t, 10*time.Minute, c.Processors.Compensations["corrected"].MaxAge.Duration)
+	assert.Equal(t, 48*time.Hour, c.Processors.Fermentations["progress"].StableDuration.Duration)
+	assert.Equal(t, float32(1.052), c.Processors.Metrics["metrics"].OriginalGravity)
+	assert.Equal(t, []string{"to-celsius", "sane", "smooth", "smoother", "spikes", "plausible"}, c.Devices.DummyDevices["foobar"].ProcessorNames())
+	assert.Equal(t, []string{"batch", "minutely"}, c.Outputs.Logs["logs"].ProcessorNames())
+
+	grams, err := processorConfigs["grams"].GenerateProcessor()
+	assert.Nil(t, err)
+	s := measurement.NewDeviceSample("scale")
+	s.AddDatapoint("weight", 1.5, time.Now())
+	out, err := grams.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(1500), out[0].Datapoints()[0].Value())
+	assert.Equal(t, measurement.NoUnit, out[0].Datapoints()[0].Unit())
+
+	scale := 2.20462
+	pounds, err := (&ConvertConfig{Datapoints: []string{"weight"}, Scale: &scale, Unit: "pounds"}).GenerateProcessor()
+	assert.Nil(t, err)
+	out, err = pounds.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, measurement.Pounds, out[0].Datapoints()[0].Unit())
+
+	pollers, err := c.Generate()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pollers))
+
+	// referencing a processor that doesn't exist
+	c, err = ParseConfig([]byte(`
+	[devices.dummy-device.foobar]
+	possible-values = [2.0]
+	processors = ["nope"]
+	`))
+	assert.Nil(t, err)
+	_, err = c.Generate()
+	assert.NotNil(t, err)
+
+	// duplicate names across processor types
+	c, err = ParseConfig([]byte(`
+	[processors.filter.foobar]
+	drop = ["read-errors"]
+	[processors.tags.foobar]
+	tags = { batch = "42" }
+	`))
+	assert.Nil(t, err)
+	_, err = c.Generate()
+	assert.NotNil(t, err)
+
+	// bad processor configs
+	for _, bad := range []ProcessorConfig{
+		&ConvertConfig{Datapoints: []string{"temperature"}, Conversion: "furlongs-to-parsecs"},
+		&ConvertConfig{Conversion: "fahrenheit-to-celsius"},
+		&ConvertConfig{Datapoints: []string{"temperature"}, Conversion: "fahrenheit-to-celsius", Offset: 1},
+		&ConvertConfig{Datapoints: []string{"weight"}, Scale: new(float64), Unit: "stones"},
+		&ClampConfig{Min: 10, Max: 0},
+		&FilterConfig{},
+		&RenameConfig{},
+		&StaticTagsConfig{},
+		&MedianConfig{Window: 1},
+		&EMAConfig{Alpha: 2},
+		&HampelConfig{Window: 2},
+		&RateGateConfig{},
+		&FermentationConfig{StableTolerance: -1},
+		&StallConfig{TerminalGravity: 0.5},
+		&StallConfig{OriginalGravity: 0.5},
+		&AggregateConfig{},
+		&CompensationConfig{Unit: "kelvin"},
+		&GravityMetricsConfig{OriginalGravity: 0.952},
+		&GravityMetricsConfig{StableReadings: -1},
+	} {
+		_, err = bad.GenerateProcessor()
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,205 @@
+package device
+
+// Contains a registry of decoders for the advertisements broadcast by Bluetooth LE
+// sensors, and a Reader implementation reporting the data any of them decode
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// BLEValue is a single named value decoded from an advertisement
+type BLEValue struct {
+	Name  string
+	Value float32
+	Unit  measurement.Unit
+}
+
+// BLEReading is the data decoded from a single Bluetooth LE advertisement
+type BLEReading struct {
+	// ID identifies the sensor that sent the advertisement, e.g. its address
+	ID     string
+	Tags   measurement.Tags
+	Values []BLEValue
+}
+
+// Value returns the value with the given name, or false if the reading doesn't have it
+func (r *BLEReading) Value(name string) (float32, bool) {
+	for _, v := range r.Values {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+// BLEDecoder decodes the advertisements of a particular kind of Bluetooth LE sensor
+type BLEDecoder interface {
+	// Name returns the name the decoder is registered under
+	Name() string
+	// Decode returns the reading held in the advertisement, or false
+	// if the advertisement wasn't sent by this kind of sensor
+	Decode(ble.Advertisement) (*BLEReading, bool)
+}
+
+var (
+	bleDecoders    = make(map[string]BLEDecoder)
+	bleDecoderLock = &sync.Mutex{}
+)
+
+// RegisterBLEDecoder makes a decoder available by name to LookupBLEDecoder.
+// Registering a second decoder with the same name replaces the first
+func RegisterBLEDecoder(d BLEDecoder) {
+	bleDecoderLock.Lock()
+	defer bleDecoderLock.Unlock()
+	bleDecoders[d.Name()] = d
+}
+
+// LookupBLEDecoder returns the decoder registered with the given name
+func LookupBLEDecoder(name string) (BLEDecoder, error) {
+	bleDecoderLock.Lock()
+	defer bleDecoderLock.Unlock()
+	d, found := bleDecoders[name]
+	if !found {
+		return nil, fmt.Errorf("unknown ble decoder '%s'", name)
+	}
+	return d, nil
+}
+
+// BLEDecoderNames returns the names of all registered decoders, sorted
+func BLEDecoderNames() []string {
+	bleDecoderLock.Lock()
+	defer bleDecoderLock.Unlock()
+	names := make([]string, 0, len(bleDecoders))
+	for name := range bleDecoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DecodeBLEAdvertisement tries each of the given decoders in turn, returning the
+// reading from the first one that recognizes the advertisement along with its name
+func DecodeBLEAdvertisement(a ble.Advertisement, decoders []BLEDecoder) (*BLEReading, string, bool) {
+	for _, d := range decoders {
+		if reading, ok := d.Decode(a); ok {
+			return reading, d.Name(), true
+		}
+	}
+	return nil, "", false
+}
+
+// BLESensors reports data from any Bluetooth LE sensors whose advertisements
+// can be decoded by its decoders. Readings received from the same sensor
+// between calls to Read are averaged together
+type BLESensors struct {
+	name      string
+	bluetooth BluetoothScanner
+	decoders  []BLEDecoder
+	addresses map[string]bool
+}
+
+// NewBLESensors returns a new device reading from sensors understood by the given
+// decoders. If any addresses are given, only sensors with those addresses are read
+func NewBLESensors(name string, decoders []BLEDecoder, addresses ...string) (*BLESensors, error) {
+	// This will immediately start scanning and holding on to discovered advertisements
+	b, err := NewBluetoothScanner()
+	if err != nil {
+		return nil, err
+	}
+	return newBLESensors(name, b, decoders, addresses...), nil
+}
+
+func newBLESensors(name string, b BluetoothScanner, decoders []BLEDecoder, addresses ...string) *BLESensors {
+	bs := &BLESensors{
+		name:      name,
+		bluetooth: b,
+		decoders:  decoders,
+		addresses: make(map[string]bool),
+	}
+	for _, a := range addresses {
+		bs.addresses[strings.ToLower(a)] = true
+	}
+	return bs
+}
+
+// a running average of the values decoded from a single sensor
+type bleAverage struct {
+	decoder string
+	reading *BLEReading
+	count   int
+}
+
+// Read returns a sample for each sensor that has advertised since the last
+// Read, holding the average of each value it advertised. Each sample is tagged
+// with the decoder ('sensor') and ID of the sensor it came from. A sample
+// reporting the health of the bluetooth scanner is included too
+func (bs *BLESensors) Read() ([]measurement.Sample, error) {
+	t := time.Now()
+	averages := make(map[string]*bleAverage)
+	order := []string{}
+	for _, a := range bs.bluetooth.GetAdvertisements() {
+		if len(bs.addresses) > 0 && !bs.addresses[bleAddress(a)] {
+			continue
+		}
+		reading, decoder, ok := DecodeBLEAdvertisement(a, bs.decoders)
+		if !ok {
+			continue
+		}
+		key := decoder + "/" + reading.ID
+		avg, found := averages[key]
+		if !found {
+			averages[key] = &bleAverage{decoder: decoder, reading: reading, count: 1}
+			order = append(order, key)
+			continue
+		}
+		// values are always decoded in the same order by the same decoder
+		for i, v := range reading.Values {
+			if i < len(avg.reading.Values) {
+				avg.reading.Values[i].Value = (avg.reading.Values[i].Value*float32(avg.count) + v.Value) / float32(avg.count+1)
+			}
+		}
+		avg.count++
+	}
+	samples := []measurement.Sample{}
+	for _, key := range order {
+		avg := averages[key]
+		sample := measurement.NewDeviceSample(bs.Name())
+		sample.AddTag("sensor", avg.decoder)
+		sample.AddTag("id", avg.reading.ID)
+		for k, v := range avg.reading.Tags {
+			sample.AddTag(k, v)
+		}
+		for _, v := range avg.reading.Values {
+			sample.AddUnitDatapoint(v.Name, v.Value, v.Unit, t)
+		}
+		samples = append(samples, sample)
+	}
+	// Report how well the bluetooth adapter is scanning
+	health, err := bluetoothHealthSample(bs.name, bs.bluetooth, t)
+	if health != nil {
+		samples = append(samples, health)
+	}
+	return samples, err
+}
+
+// Name returns the name of this device
+func (bs *BLESensors) Name() string {
+	return bs.name
+}
+
+// returns the address of the advertisement's sender,
+// or an empty string if it doesn't have one
+func bleAddress(a ble.Advertisement) string {
+	if a.Addr() == nil {
+		return ""
+	}
+	return strings.ToLower(a.Addr().String())
+}
@@ -0,0 +1,188 @@
+package device
+
+// Contains recording of Bluetooth LE advertisements to a capture file, and a
+// BluetoothScanner replaying them, so the BLE devices can be run without any
+// bluetooth hardware. Captures hold one JSON object per line
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+)
+
+// a single advertisement in a capture file, with binary data hex encoded
+type capturedAdvertisement struct {
+	Time             time.Time             `json:"time"`
+	Address          string                `json:"address"`
+	RSSI             int                   `json:"rssi"`
+	LocalName        string                `json:"local-name,omitempty"`
+	ManufacturerData string                `json:"manufacturer-data,omitempty"`
+	ServiceData      []capturedServiceData `json:"service-data,omitempty"`
+}
+
+type capturedServiceData struct {
+	UUID string `json:"uuid"`
+	Data string `json:"data"`
+}
+
+// captureWriter writes advertisements to a capture file
+type captureWriter struct {
+	encoder *json.Encoder
+}
+
+func newCaptureWriter(w io.Writer) *captureWriter {
+	return &captureWriter{encoder: json.NewEncoder(w)}
+}
+
+// write records the advertisement as received at the given time
+func (cw *captureWriter) write(a ble.Advertisement, t time.Time) error {
+	ca := capturedAdvertisement{
+		Time:             t,
+		Address:          bleAddress(a),
+		RSSI:             a.RSSI(),
+		LocalName:        a.LocalName(),
+		ManufacturerData: hex.EncodeToString(a.ManufacturerData()),
+	}
+	for _, sd := range a.ServiceData() {
+		ca.ServiceData = append(ca.ServiceData, capturedServiceData{
+			UUID: hex.EncodeToString(sd.UUID),
+			Data: hex.EncodeToString(sd.Data),
+		})
+	}
+	return cw.encoder.Encode(ca)
+}
+
+// replayedAdvertisement is an advertisement read back from a capture file
+type replayedAdvertisement struct {
+	t                time.Time
+	address          string
+	rssi             int
+	localName        string
+	manufacturerData []byte
+	serviceData      []ble.ServiceData
+}
+
+func (ra *replayedAdvertisement) LocalName() string              { return ra.localName }
+func (ra *replayedAdvertisement) ManufacturerData() []byte       { return ra.manufacturerData }
+func (ra *replayedAdvertisement) ServiceData() []ble.ServiceData { return ra.serviceData }
+func (ra *replayedAdvertisement) Services() []ble.UUID           { return nil }
+func (ra *replayedAdvertisement) OverflowService() []ble.UUID    { return nil }
+func (ra *replayedAdvertisement) TxPowerLevel() int              { return 0 }
+func (ra *replayedAdvertisement) Connectable() bool              { return false }
+func (ra *replayedAdvertisement) SolicitedService() []ble.UUID   { return nil }
+func (ra *replayedAdvertisement) RSSI() int                      { return ra.rssi }
+func (ra *replayedAdvertisement) Addr() ble.Addr                 { return ble.NewAddr(ra.address) }
+
+// readCapture reads every advertisement in a capture, in the order they were captured
+func readCapture(r io.Reader) ([]*replayedAdvertisement, error) {
+	advertisements := []*replayedAdvertisement{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var ca capturedAdvertisement
+		if err := json.Unmarshal(scanner.Bytes(), &ca); err != nil {
+			return nil, fmt.Errorf("bad advertisement on line %d of capture: %s", line, err)
+		}
+		ra := &replayedAdvertisement{
+			t:         ca.Time,
+			address:   ca.Address,
+			rssi:      ca.RSSI,
+			localName: ca.LocalName,
+		}
+		var err error
+		if ra.manufacturerData, err = hex.DecodeString(ca.ManufacturerData); err != nil {
+			return nil, fmt.Errorf("bad manufacturer data on line %d of capture: %s", line, err)
+		}
+		for _, csd := range ca.ServiceData {
+			uuid, err := hex.DecodeString(csd.UUID)
+			if err != nil {
+				return nil, fmt.Errorf("bad service data uuid on line %d of capture: %s", line, err)
+			}
+			data, err := hex.DecodeString(csd.Data)
+			if err != nil {
+				return nil, fmt.Errorf("bad service data on line %d of capture: %s", line, err)
+			}
+			ra.serviceData = append(ra.serviceData, ble.ServiceData{UUID: ble.UUID(uuid), Data: data})
+		}
+		advertisements = append(advertisements, ra)
+	}
+	return advertisements, scanner.Err()
+}
+
+// ReplayScanner is a BluetoothScanner handing out the advertisements from a
+// capture file, spaced out as they were when they were captured
+type ReplayScanner struct {
+	advertisements []*replayedAdvertisement
+	next           int
+	speed          float64
+	start          time.Time
+	now            func() time.Time
+	lock           *sync.Mutex
+}
+
+// NewReplayScanner reads the capture file and starts replaying it straight away.
+// The speed speeds up (or slows down) the replay, and defaults to real time
+func NewReplayScanner(path string, speed float64) (*ReplayScanner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return newReplayScanner(f, speed, time.Now)
+}
+
+func newReplayScanner(r io.Reader, speed float64, now func() time.Time) (*ReplayScanner, error) {
+	advertisements, err := readCapture(r)
+	if err != nil {
+		return nil, err
+	}
+	if speed <= 0 {
+		speed = 1
+	}
+	return &ReplayScanner{
+		advertisements: advertisements,
+		speed:          speed,
+		start:          now(),
+		now:            now,
+		lock:           &sync.Mutex{},
+	}, nil
+}
+
+// GetAdvertisements returns the captured advertisements that are due to have
+// been received since the last call
+func (rs *ReplayScanner) GetAdvertisements() []ble.Advertisement {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	advertisements := []ble.Advertisement{}
+	if len(rs.advertisements) == 0 {
+		return advertisements
+	}
+	first := rs.advertisements[0].t
+	elapsed := time.Duration(float64(rs.now().Sub(rs.start)) * rs.speed)
+	for ; rs.next < len(rs.advertisements); rs.next++ {
+		a := rs.advertisements[rs.next]
+		if a.t.Sub(first) > elapsed {
+			break
+		}
+		advertisements = append(advertisements, a)
+	}
+	return advertisements
+}
+
+// Done returns whether every advertisement in the capture has been replayed
+func (rs *ReplayScanner) Done() bool {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return rs.next >= len(rs.advertisements)
+}
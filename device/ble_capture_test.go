@@ -0,0 +1,90 @@
+package device
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	captured := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	cw := newCaptureWriter(&buf)
+	err := cw.write(&fakeAdvertisement{
+		md:   mustDecodeHex("4c000215a495bb10c5b14b44b5121370f02d74de00430410c7"),
+		sd:   []ble.ServiceData{{UUID: ble.UUID16(0x181a), Data: mustDecodeHex("a4c13811223300d7375a0b8607")}},
+		addr: "DD:33:0A:11:22:33",
+		rssi: -71,
+	}, captured)
+	assert.Nil(t, err)
+
+	advertisements, err := readCapture(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(advertisements))
+	a := advertisements[0]
+	assert.True(t, captured.Equal(a.t))
+	assert.Equal(t, "dd:33:0a:11:22:33", a.Addr().String())
+	assert.Equal(t, -71, a.RSSI())
+	assert.Equal(t, mustDecodeHex("4c000215a495bb10c5b14b44b5121370f02d74de00430410c7"), a.ManufacturerData())
+	assert.True(t, ble.UUID16(0x181a).Equal(a.ServiceData()[0].UUID))
+	assert.Equal(t, mustDecodeHex("a4c13811223300d7375a0b8607"), a.ServiceData()[0].Data)
+
+	_, err = readCapture(bytes.NewBufferString(`{"time": "yesterday"}`))
+	assert.NotNil(t, err)
+	_, err = readCapture(bytes.NewBufferString(`{"manufacturer-data": "zz"}`))
+	assert.NotNil(t, err)
+}
+
+func TestReplayScanner(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	rs, err := NewReplayScanner("../testdata/ble/tilt-capture.jsonl", 10)
+	assert.Nil(t, err)
+	rs.start, rs.now = clock(), clock
+
+	tilt := &TiltHydrometer{
+		name:      "replayed",
+		bluetooth: rs,
+		data:      newRecentData(),
+	}
+	// the first tilt advertisement is due straight away
+	samples, err := tilt.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, float32(1.040), samples[0].Datapoints()[1].Value())
+	assert.Equal(t, float32(-71), samples[0].Datapoints()[2].Value())
+
+	// 10 captured seconds later, only the ATC advertisement has been replayed
+	now = now.Add(time.Second)
+	advertisements := rs.GetAdvertisements()
+	assert.Equal(t, 1, len(advertisements))
+	assert.Equal(t, "ATC_112233", advertisements[0].LocalName())
+	assert.False(t, rs.Done())
+
+	now = now.Add(2 * time.Second)
+	samples, err = tilt.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, float32(1.038), samples[0].Datapoints()[1].Value())
+	assert.True(t, rs.Done())
+	assert.Equal(t, 0, len(rs.GetAdvertisements()))
+
+	_, err = NewReplayScanner("../testdata/ble/does-not-exist.jsonl", 1)
+	assert.NotNil(t, err)
+}
+
+func TestBluetoothSettings(t *testing.T) {
+	assert.Nil(t, BluetoothSettings{Capture: "capture.jsonl"}.Validate())
+	assert.Nil(t, BluetoothSettings{Replay: "capture.jsonl", ReplaySpeed: 60}.Validate())
+	assert.NotNil(t, BluetoothSettings{Capture: "capture.jsonl", Replay: "capture.jsonl"}.Validate())
+	assert.NotNil(t, BluetoothSettings{Replay: "capture.jsonl", ReplaySpeed: -1}.Validate())
+
+	defer SetBluetoothSettings(BluetoothSettings{})
+	assert.Nil(t, SetBluetoothSettings(BluetoothSettings{Replay: "../testdata/ble/tilt-capture.jsonl"}))
+	scanner, err := NewBluetoothScanner()
+	assert.Nil(t, err)
+	_, isReplay := scanner.(*ReplayScanner)
+	assert.True(t, isReplay)
+}
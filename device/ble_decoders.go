@@ -0,0 +1,199 @@
+package device
+
+// Contains decoders for the advertisements of popular Bluetooth LE brewing
+// sensors. Tilt Hydrometers are decoded in tilt.go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-ble/ble"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+func init() {
+	RegisterBLEDecoder(raptPillDecoder{})
+	RegisterBLEDecoder(atcThermometerDecoder{})
+	RegisterBLEDecoder(goveeThermometerDecoder{})
+}
+
+// Names of the built in decoders
+const (
+	RaptPillDecoderName         = "rapt-pill"
+	ATCThermometerDecoderName   = "atc"
+	GoveeThermometerDecoderName = "govee-h5075"
+)
+
+// raptPillDecoder decodes the metrics the RAPT Pill hydrometer broadcasts in its
+// manufacturer data, which starts with "RAPT" followed by a format version
+type raptPillDecoder struct{}
+
+var raptPrefix = []byte("RAPT")
+
+func (raptPillDecoder) Name() string {
+	return RaptPillDecoderName
+}
+
+func (raptPillDecoder) Decode(a ble.Advertisement) (*BLEReading, bool) {
+	md := a.ManufacturerData()
+	if len(md) < 5 || !bytes.Equal(md[0:4], raptPrefix) {
+		return nil, false
+	}
+	var rawTemp uint16
+	var gravity float32
+	var battery int16
+	values := []BLEValue{}
+	id := bleAddress(a)
+	switch md[4] {
+	case 1:
+		// prefix[4] version mac[6] temperature(u16) gravity(f32) x y z(i16) battery(i16)
+		if len(md) < 25 {
+			return nil, false
+		}
+		id = formatMAC(md[5:11])
+		rawTemp = binary.BigEndian.Uint16(md[11:13])
+		gravity = math.Float32frombits(binary.BigEndian.Uint32(md[13:17]))
+		battery = int16(binary.BigEndian.Uint16(md[23:25]))
+	case 2:
+		// prefix[4] version velocity-valid(u8) velocity(f32) temperature(u16)
+		// gravity(f32) x y z(i16) battery(i16)
+		if len(md) < 24 {
+			return nil, false
+		}
+		if md[5] != 0 {
+			// gravity points per day
+			velocity := math.Float32frombits(binary.BigEndian.Uint32(md[6:10]))
+			values = append(values, BLEValue{Name: "gravity-velocity", Value: velocity})
+		}
+		rawTemp = binary.BigEndian.Uint16(md[10:12])
+		gravity = math.Float32frombits(binary.BigEndian.Uint32(md[12:16]))
+		battery = int16(binary.BigEndian.Uint16(md[22:24]))
+	default:
+		return nil, false
+	}
+	// temperature is sent in kelvin * 128, gravity in points (1000 * SG)
+	// and battery percentage * 256
+	c := float32(rawTemp)/128 - 273.15
+	values = append([]BLEValue{
+		{Name: "celsius", Value: c, Unit: measurement.Celsius},
+		{Name: "fahrenheit", Value: celsiusToFahrenheit(c), Unit: measurement.Fahrenheit},
+		{Name: "gravity", Value: gravity / 1000, Unit: measurement.SpecificGravity},
+		{Name: "battery", Value: float32(battery) / 256, Unit: measurement.Percent},
+	}, values...)
+	return &BLEReading{
+		ID:     id,
+		Tags:   make(measurement.Tags),
+		Values: values,
+	}, true
+}
+
+// atcThermometerDecoder decodes the environmental sensing service data broadcast
+// by Xiaomi LYWSD03MMC thermometers running the custom ATC firmware, in either
+// the original atc1441 format or the pvvx custom format
+type atcThermometerDecoder struct{}
+
+// 16 bit UUID of the environmental sensing service
+var environmentalSensingUUID = ble.UUID16(0x181a)
+
+func (atcThermometerDecoder) Name() string {
+	return ATCThermometerDecoderName
+}
+
+func (atcThermometerDecoder) Decode(a ble.Advertisement) (*BLEReading, bool) {
+	for _, sd := range a.ServiceData() {
+		if !sd.UUID.Equal(environmentalSensingUUID) {
+			continue
+		}
+		d := sd.Data
+		var c, humidity, battery float32
+		var mac []byte
+		switch len(d) {
+		case 13:
+			// atc1441: mac[6] temperature(i16, 0.1C) humidity(u8 %) battery(u8 %)
+			// battery(u16 mV) counter(u8), all big endian
+			mac = d[0:6]
+			c = float32(int16(binary.BigEndian.Uint16(d[6:8]))) / 10
+			humidity = float32(d[8])
+			battery = float32(d[9])
+		case 15:
+			// pvvx: mac[6] temperature(i16, 0.01C) humidity(u16, 0.01%) battery(u16 mV)
+			// battery(u8 %) counter(u8) flags(u8), all little endian
+			mac = reverseBytes(d[0:6])
+			c = float32(int16(binary.LittleEndian.Uint16(d[6:8]))) / 100
+			humidity = float32(binary.LittleEndian.Uint16(d[8:10])) / 100
+			battery = float32(d[12])
+		default:
+			continue
+		}
+		return &BLEReading{
+			ID:   formatMAC(mac),
+			Tags: make(measurement.Tags),
+			Values: []BLEValue{
+				{Name: "celsius", Value: c, Unit: measurement.Celsius},
+				{Name: "fahrenheit", Value: celsiusToFahrenheit(c), Unit: measurement.Fahrenheit},
+				{Name: "humidity", Value: humidity, Unit: measurement.Percent},
+				{Name: "battery", Value: battery, Unit: measurement.Percent},
+			},
+		}, true
+	}
+	return nil, false
+}
+
+// goveeThermometerDecoder decodes the manufacturer data broadcast by
+// Govee H5075 (and the similar H5072) thermometer/hygrometers
+type goveeThermometerDecoder struct{}
+
+// company ID 0xec88, little endian
+var goveePrefix = []byte{0x88, 0xec}
+
+func (goveeThermometerDecoder) Name() string {
+	return GoveeThermometerDecoderName
+}
+
+func (goveeThermometerDecoder) Decode(a ble.Advertisement) (*BLEReading, bool) {
+	md := a.ManufacturerData()
+	if len(md) < 7 || !bytes.Equal(md[0:2], goveePrefix) {
+		return nil, false
+	}
+	// temperature and humidity are packed into a single 24 bit number,
+	// temperature * 10000 + humidity * 10, with the top bit as a sign
+	packed := uint32(md[3])<<16 | uint32(md[4])<<8 | uint32(md[5])
+	negative := packed&0x800000 != 0
+	packed &^= 0x800000
+	c := float32(packed/1000) / 10
+	if negative {
+		c = -c
+	}
+	humidity := float32(packed%1000) / 10
+	return &BLEReading{
+		ID:   bleAddress(a),
+		Tags: make(measurement.Tags),
+		Values: []BLEValue{
+			{Name: "celsius", Value: c, Unit: measurement.Celsius},
+			{Name: "fahrenheit", Value: celsiusToFahrenheit(c), Unit: measurement.Fahrenheit},
+			{Name: "humidity", Value: humidity, Unit: measurement.Percent},
+			{Name: "battery", Value: float32(md[6]), Unit: measurement.Percent},
+		},
+	}, true
+}
+
+// formats a MAC address in the usual colon separated lower case hex
+func formatMAC(mac []byte) string {
+	parts := make([]string, len(mac))
+	for i, b := range mac {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func reverseBytes(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
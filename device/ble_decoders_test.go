@@ -0,0 +1,93 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/go-ble/ble"
+	"github.com/stretchr/testify/assert"
+)
+
+func assertBLEValue(t *testing.T, reading *BLEReading, name string, expected float32) {
+	v, found := reading.Value(name)
+	assert.True(t, found, "missing value '%s'", name)
+	assert.InDelta(t, expected, v, 0.001, name)
+}
+
+func TestRaptPillDecoder(t *testing.T) {
+	// v1
+	a := &fakeAdvertisement{md: mustDecodeHex("52415054010a0b0c0d0e0f92934482b0000000000000005a00")}
+	reading, ok := raptPillDecoder{}.Decode(a)
+	assert.True(t, ok)
+	assert.Equal(t, "0a:0b:0c:0d:0e:0f", reading.ID)
+	assertBLEValue(t, reading, "celsius", 19.998)
+	assertBLEValue(t, reading, "gravity", 1.0455)
+	assertBLEValue(t, reading, "battery", 90)
+	_, found := reading.Value("gravity-velocity")
+	assert.False(t, found)
+
+	// v2
+	a = &fakeAdvertisement{md: mustDecodeHex("524150540201c06000009293447d00000000000000005a00"), addr: "78:e3:6d:00:00:01"}
+	reading, ok = raptPillDecoder{}.Decode(a)
+	assert.True(t, ok)
+	assert.Equal(t, "78:e3:6d:00:00:01", reading.ID)
+	assertBLEValue(t, reading, "gravity", 1.012)
+	assertBLEValue(t, reading, "gravity-velocity", -3.5)
+
+	// unknown version, and not a RAPT at all
+	_, ok = raptPillDecoder{}.Decode(&fakeAdvertisement{md: mustDecodeHex("5241505409")})
+	assert.False(t, ok)
+	_, ok = raptPillDecoder{}.Decode(&fakeAdvertisement{md: mustDecodeHex("4c000215")})
+	assert.False(t, ok)
+}
+
+func TestATCThermometerDecoder(t *testing.T) {
+	sd := func(uuid ble.UUID, data string) *fakeAdvertisement {
+		return &fakeAdvertisement{sd: []ble.ServiceData{{UUID: uuid, Data: mustDecodeHex(data)}}}
+	}
+	// atc1441 format
+	reading, ok := atcThermometerDecoder{}.Decode(sd(environmentalSensingUUID, "a4c13811223300d7375a0b8607"))
+	assert.True(t, ok)
+	assert.Equal(t, "a4:c1:38:11:22:33", reading.ID)
+	assertBLEValue(t, reading, "celsius", 21.5)
+	assertBLEValue(t, reading, "humidity", 55)
+	assertBLEValue(t, reading, "battery", 90)
+
+	// pvvx format
+	reading, ok = atcThermometerDecoder{}.Decode(sd(environmentalSensingUUID, "33221138c1a466088815860b5a0700"))
+	assert.True(t, ok)
+	assert.Equal(t, "a4:c1:38:11:22:33", reading.ID)
+	assertBLEValue(t, reading, "celsius", 21.5)
+	assertBLEValue(t, reading, "humidity", 55.12)
+	assertBLEValue(t, reading, "battery", 90)
+
+	// some other service
+	_, ok = atcThermometerDecoder{}.Decode(sd(ble.UUID16(0x180f), "a4c13811223300d7375a0b8607"))
+	assert.False(t, ok)
+}
+
+func TestGoveeThermometerDecoder(t *testing.T) {
+	reading, ok := goveeThermometerDecoder{}.Decode(&fakeAdvertisement{md: mustDecodeHex("88ec00034a006400"), addr: "A4:C1:38:00:00:01"})
+	assert.True(t, ok)
+	assert.Equal(t, "a4:c1:38:00:00:01", reading.ID)
+	assertBLEValue(t, reading, "celsius", 21.5)
+	assertBLEValue(t, reading, "humidity", 55.2)
+	assertBLEValue(t, reading, "battery", 100)
+
+	// below freezing
+	reading, ok = goveeThermometerDecoder{}.Decode(&fakeAdvertisement{md: mustDecodeHex("88ec0080d0985a00")})
+	assert.True(t, ok)
+	assertBLEValue(t, reading, "celsius", -5.3)
+	assertBLEValue(t, reading, "humidity", 40)
+}
+
+func TestTiltDecoder(t *testing.T) {
+	reading, ok := tiltDecoder{}.Decode(newMockAdvertisement(68, 1050))
+	assert.True(t, ok)
+	assert.Equal(t, "red", reading.ID)
+	assert.Equal(t, "red", reading.Tags["color"])
+	assertBLEValue(t, reading, "temperature", 68)
+	assertBLEValue(t, reading, "gravity", 1.05)
+
+	_, ok = tiltDecoder{}.Decode(&fakeAdvertisement{md: mustDecodeHex("88ec00034a006400")})
+	assert.False(t, ok)
+}
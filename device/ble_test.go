@@ -0,0 +1,97 @@
+package device
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/go-ble/ble"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAdvertisement is a ble.Advertisement with settable fields
+type fakeAdvertisement struct {
+	md   []byte
+	sd   []ble.ServiceData
+	addr string
+	rssi int
+}
+
+func (fa *fakeAdvertisement) ManufacturerData() []byte       { return fa.md }
+func (fa *fakeAdvertisement) ServiceData() []ble.ServiceData { return fa.sd }
+func (fa *fakeAdvertisement) LocalName() string              { return "" }
+func (fa *fakeAdvertisement) Services() []ble.UUID           { return nil }
+func (fa *fakeAdvertisement) OverflowService() []ble.UUID    { return nil }
+func (fa *fakeAdvertisement) TxPowerLevel() int              { return 0 }
+func (fa *fakeAdvertisement) Connectable() bool              { return false }
+func (fa *fakeAdvertisement) SolicitedService() []ble.UUID   { return nil }
+func (fa *fakeAdvertisement) RSSI() int                      { return fa.rssi }
+func (fa *fakeAdvertisement) Addr() ble.Addr                 { return ble.NewAddr(fa.addr) }
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// a scanner handing out a fixed set of advertisements once
+type fakeScanner struct {
+	advertisements []ble.Advertisement
+}
+
+func (fs *fakeScanner) GetAdvertisements() []ble.Advertisement {
+	a := fs.advertisements
+	fs.advertisements = nil
+	return a
+}
+
+func TestBLEDecoderRegistry(t *testing.T) {
+	names := BLEDecoderNames()
+	for _, name := range []string{TiltDecoderName, RaptPillDecoderName, ATCThermometerDecoderName, GoveeThermometerDecoderName} {
+		assert.Contains(t, names, name)
+		d, err := LookupBLEDecoder(name)
+		assert.Nil(t, err)
+		assert.Equal(t, name, d.Name())
+	}
+	_, err := LookupBLEDecoder("not-a-decoder")
+	assert.NotNil(t, err)
+}
+
+func TestBLESensorsRead(t *testing.T) {
+	govee := func(addr, data string) *fakeAdvertisement {
+		return &fakeAdvertisement{md: mustDecodeHex(data), addr: addr}
+	}
+	scanner := &fakeScanner{
+		advertisements: []ble.Advertisement{
+			govee("A4:C1:38:00:00:01", "88ec00034a006400"),
+			// not a sensor anything can decode
+			&fakeAdvertisement{md: mustDecodeHex("ffff0102"), addr: "a4:c1:38:00:00:01"},
+			govee("a4:c1:38:00:00:01", "88ec00035e886400"),
+			govee("a4:c1:38:00:00:02", "88ec0080d0985a00"),
+			// filtered out by address
+			govee("a4:c1:38:00:00:03", "88ec00034a006400"),
+		},
+	}
+	decoders := []BLEDecoder{raptPillDecoder{}, goveeThermometerDecoder{}}
+	bs := newBLESensors("chamber", scanner, decoders, "a4:c1:38:00:00:01", "A4:C1:38:00:00:02")
+
+	samples, err := bs.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(samples))
+
+	// the two readings of the first sensor are averaged
+	assert.Equal(t, "chamber", samples[0].DeviceName())
+	assert.Equal(t, "govee-h5075", samples[0].Tags()["sensor"])
+	assert.Equal(t, "a4:c1:38:00:00:01", samples[0].Tags()["id"])
+	assert.Equal(t, "celsius", samples[0].Datapoints()[0].Name())
+	assert.InDelta(t, 21.75, samples[0].Datapoints()[0].Value(), 0.001)
+
+	assert.Equal(t, "a4:c1:38:00:00:02", samples[1].Tags()["id"])
+	assert.InDelta(t, -5.3, samples[1].Datapoints()[0].Value(), 0.001)
+
+	// nothing new has been advertised
+	samples, err = bs.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+}
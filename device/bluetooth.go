@@ -0,0 +1,348 @@
+package device
+
+// Contains the Bluetooth LE scanner shared by the devices that read sensor
+// data out of advertisements (tilts and other BLE sensors)
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/go-ble/ble/examples/lib/dev"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+const (
+	// Use a refreshing scan with a timeout because there are issues
+	// with long running calls to Scan() no longer seeing data
+	bluetoothScanPeriod = 1 * time.Minute
+	// how long to wait before retrying a failed scan, doubling
+	// with every failure in a row up to the max
+	bluetoothMinBackoff = 1 * time.Second
+	bluetoothMaxBackoff = 1 * time.Minute
+)
+
+// BluetoothSettings changes where Bluetooth LE advertisements come from.
+// Advertisements can be recorded to a capture file as they are received,
+// or instead of scanning at all, replayed from a capture file
+type BluetoothSettings struct {
+	// Adapter selects the HCI adapter to scan with, either by index ("hci1" or "1")
+	// or by its address. Defaults to the system's default adapter
+	Adapter string
+	// Capture is a file to append every received advertisement to
+	Capture string
+	// Replay is a capture file to read advertisements from instead of scanning
+	Replay string
+	// ReplaySpeed speeds up replay, e.g. 60 replays an hour of captured
+	// advertisements in a minute. Defaults to replaying in real time
+	ReplaySpeed float64
+}
+
+// Validate returns an error if the settings can't be used together
+func (s BluetoothSettings) Validate() error {
+	if s.Capture != "" && s.Replay != "" {
+		return fmt.Errorf("bluetooth advertisements cannot be captured while replaying a capture")
+	}
+	if s.ReplaySpeed < 0 {
+		return fmt.Errorf("bluetooth replay speed cannot be negative")
+	}
+	if s.Adapter != "" {
+		if _, isIndex := parseAdapterIndex(s.Adapter); !isIndex {
+			if _, err := net.ParseMAC(s.Adapter); err != nil {
+				return fmt.Errorf("bluetooth adapter must be an index (e.g. hci0) or an address, not '%s'", s.Adapter)
+			}
+		}
+	}
+	return nil
+}
+
+var bluetoothSettings BluetoothSettings
+
+// SetBluetoothSettings changes the settings used by any bluetooth
+// scanners created afterwards with NewBluetoothScanner
+func SetBluetoothSettings(settings BluetoothSettings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	bluetoothSettings = settings
+	return nil
+}
+
+// BluetoothScanner is an interface to read data from a Bluetooth LE device
+type BluetoothScanner interface {
+	GetAdvertisements() []ble.Advertisement
+}
+
+// BluetoothHealth describes how well a scanner's adapter is scanning
+type BluetoothHealth struct {
+	Adapter string
+	// Scanning is false once a scan has failed, until one succeeds again
+	Scanning          bool
+	ConsecutiveErrors int
+	TotalErrors       uint64
+	LastError         error
+	// CaptureError is why capturing advertisements stopped, if it did
+	CaptureError error
+}
+
+// BluetoothHealthReporter is implemented by scanners that can report their health
+type BluetoothHealthReporter interface {
+	Health() BluetoothHealth
+}
+
+// NewBluetoothScanner returns a scanner that immediately starts holding on to
+// received advertisements until they are collected with GetAdvertisements.
+// Depending on the bluetooth settings, the advertisements are scanned for
+// (and possibly captured), or replayed from a capture file.
+// Scanners using the same adapter share it, each getting every advertisement
+func NewBluetoothScanner() (BluetoothScanner, error) {
+	if bluetoothSettings.Replay != "" {
+		return NewReplayScanner(bluetoothSettings.Replay, bluetoothSettings.ReplaySpeed)
+	}
+	hub, err := getBluetoothHub(bluetoothSettings)
+	if err != nil {
+		return nil, err
+	}
+	return hub.subscribe(), nil
+}
+
+var (
+	bluetoothHubs     = make(map[string]*bluetoothHub)
+	bluetoothHubsLock = &sync.Mutex{}
+)
+
+// returns the hub scanning with the adapter in the settings, opening the
+// adapter and starting to scan the first time it is asked for
+func getBluetoothHub(settings BluetoothSettings) (*bluetoothHub, error) {
+	bluetoothHubsLock.Lock()
+	defer bluetoothHubsLock.Unlock()
+	if hub, found := bluetoothHubs[settings.Adapter]; found {
+		return hub, nil
+	}
+	d, err := openBluetoothAdapter(settings.Adapter)
+	if err != nil {
+		return nil, err
+	}
+	hub := newBluetoothHub(settings.Adapter, d.Scan)
+	if settings.Capture != "" {
+		f, err := os.OpenFile(settings.Capture, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			d.Stop()
+			return nil, err
+		}
+		hub.capture = newCaptureWriter(f)
+	}
+	go hub.run()
+	bluetoothHubs[settings.Adapter] = hub
+	return hub, nil
+}
+
+// opens the adapter with the given index or address, or the default adapter
+func openBluetoothAdapter(adapter string) (ble.Device, error) {
+	if adapter == "" {
+		return dev.NewDevice("default")
+	}
+	if index, isIndex := parseAdapterIndex(adapter); isIndex {
+		return dev.NewDevice("default", ble.OptDeviceID(index))
+	}
+	// find the adapter with the address by opening each in turn
+	paths, err := filepath.Glob(filepath.Join(SysfsClassDir, "bluetooth", "hci*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		index, isIndex := parseAdapterIndex(filepath.Base(path))
+		if !isIndex {
+			continue
+		}
+		d, err := dev.NewDevice("default", ble.OptDeviceID(index))
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(d.Address().String(), adapter) {
+			return d, nil
+		}
+		d.Stop()
+	}
+	return nil, fmt.Errorf("no bluetooth adapter found with address '%s'", adapter)
+}
+
+// parses an adapter index given as 'hciN' or just 'N'
+func parseAdapterIndex(adapter string) (int, bool) {
+	index, err := strconv.Atoi(strings.TrimPrefix(adapter, "hci"))
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+type scanFunc func(ctx context.Context, allowDup bool, h ble.AdvHandler) error
+
+// bluetoothHub scans with a single adapter, handing every advertisement
+// received to each of its subscribers
+type bluetoothHub struct {
+	adapter     string
+	scan        scanFunc
+	scanPeriod  time.Duration
+	backoff     time.Duration
+	capture     *captureWriter
+	subscribers []*bluetoothSubscription
+	health      BluetoothHealth
+	lock        *sync.Mutex
+}
+
+func newBluetoothHub(adapter string, scan scanFunc) *bluetoothHub {
+	if adapter == "" {
+		adapter = "default"
+	}
+	return &bluetoothHub{
+		adapter:    adapter,
+		scan:       scan,
+		scanPeriod: bluetoothScanPeriod,
+		backoff:    bluetoothMinBackoff,
+		health: BluetoothHealth{
+			Adapter:  adapter,
+			Scanning: true,
+		},
+		lock: &sync.Mutex{},
+	}
+}
+
+// run scans forever, backing off whenever scanning fails
+func (h *bluetoothHub) run() {
+	for {
+		time.Sleep(h.scanOnce())
+	}
+}
+
+// scanOnce does a single scan, returning how long to wait before the next.
+// A scan is only successful if it lasts the whole scan period
+func (h *bluetoothHub) scanOnce() time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), h.scanPeriod)
+	defer cancel()
+	err := h.scan(ctx, true, h.advHandler)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if ctx.Err() == context.DeadlineExceeded {
+		h.health.Scanning = true
+		h.health.ConsecutiveErrors = 0
+		h.backoff = bluetoothMinBackoff
+		return 0
+	}
+	if err == nil {
+		err = errors.New("scan stopped early")
+	}
+	h.health.Scanning = false
+	h.health.ConsecutiveErrors++
+	h.health.TotalErrors++
+	h.health.LastError = err
+	wait := h.backoff
+	h.backoff *= 2
+	if h.backoff > bluetoothMaxBackoff {
+		h.backoff = bluetoothMaxBackoff
+	}
+	return wait
+}
+
+// hands the advertisement to every subscriber, leaving it to them
+// to pick out the ones they understand
+func (h *bluetoothHub) advHandler(a ble.Advertisement) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, s := range h.subscribers {
+		s.add(a)
+	}
+	if h.capture != nil {
+		// a capture that can't be written isn't worth stopping scanning for,
+		// so it is given up on and reported with the adapter's health
+		if err := h.capture.write(a, time.Now()); err != nil {
+			h.health.CaptureError = err
+			h.capture = nil
+		}
+	}
+}
+
+func (h *bluetoothHub) subscribe() *bluetoothSubscription {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s := &bluetoothSubscription{
+		hub:            h,
+		advertisements: []ble.Advertisement{},
+		lock:           &sync.Mutex{},
+	}
+	h.subscribers = append(h.subscribers, s)
+	return s
+}
+
+// Health returns the health of the hub's adapter
+func (h *bluetoothHub) Health() BluetoothHealth {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.health
+}
+
+// bluetoothSubscription is a BluetoothScanner holding on to the advertisements
+// received by a hub until they are collected
+type bluetoothSubscription struct {
+	hub            *bluetoothHub
+	advertisements []ble.Advertisement
+	lock           *sync.Mutex
+}
+
+func (bs *bluetoothSubscription) add(a ble.Advertisement) {
+	bs.lock.Lock()
+	bs.advertisements = append(bs.advertisements, a)
+	bs.lock.Unlock()
+}
+
+func (bs *bluetoothSubscription) GetAdvertisements() []ble.Advertisement {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	// make the array to return
+	toReturn := make([]ble.Advertisement, len(bs.advertisements))
+	copy(toReturn, bs.advertisements)
+	bs.advertisements = []ble.Advertisement{}
+	return toReturn
+}
+
+// Health returns the health of the adapter the subscription is scanning with
+func (bs *bluetoothSubscription) Health() BluetoothHealth {
+	return bs.hub.Health()
+}
+
+// bluetoothHealthSample returns a sample reporting the health of the scanner, if it
+// reports it, along with an error if it is failing to scan or stopped capturing
+// advertisements. The sample is tagged
+// with the adapter ('scanner'), and holds whether it is 'scanning' and its 'scan-errors'
+func bluetoothHealthSample(name string, b BluetoothScanner, t time.Time) (measurement.Sample, error) {
+	reporter, ok := b.(BluetoothHealthReporter)
+	if !ok {
+		return nil, nil
+	}
+	health := reporter.Health()
+	sample := measurement.NewDeviceSample(name)
+	sample.AddTag("scanner", health.Adapter)
+	scanning := float32(0)
+	if health.Scanning {
+		scanning = 1
+	}
+	sample.AddDatapoint("scanning", scanning, t)
+	sample.AddDatapoint("scan-errors", float32(health.TotalErrors), t)
+	if !health.Scanning {
+		return sample, fmt.Errorf("bluetooth adapter '%s' failed to scan %d times in a row: %s",
+			health.Adapter, health.ConsecutiveErrors, health.LastError)
+	}
+	if health.CaptureError != nil {
+		return sample, fmt.Errorf("bluetooth adapter '%s' stopped capturing advertisements: %s", health.Adapter, health.CaptureError)
+	}
+	return sample, nil
+}
@@ -0,0 +1,106 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-ble/ble"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdapterSettings(t *testing.T) {
+	assert.Nil(t, BluetoothSettings{Adapter: "hci1"}.Validate())
+	assert.Nil(t, BluetoothSettings{Adapter: "0"}.Validate())
+	assert.Nil(t, BluetoothSettings{Adapter: "00:1A:7D:DA:71:13"}.Validate())
+	assert.NotNil(t, BluetoothSettings{Adapter: "hcione"}.Validate())
+	assert.NotNil(t, BluetoothSettings{Adapter: "hci-1"}.Validate())
+
+	index, isIndex := parseAdapterIndex("hci2")
+	assert.True(t, isIndex)
+	assert.Equal(t, 2, index)
+}
+
+// a scan that fails a number of times before working, sending an
+// advertisement every time it works
+type fakeScan struct {
+	failures int
+	ad       ble.Advertisement
+}
+
+func (fs *fakeScan) scan(ctx context.Context, allowDup bool, h ble.AdvHandler) error {
+	if fs.failures > 0 {
+		fs.failures--
+		return errors.New("hci0: device busy")
+	}
+	h(fs.ad)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestBluetoothHub(t *testing.T) {
+	fs := &fakeScan{
+		failures: 3,
+		ad:       newMockAdvertisement(uint16(67), uint16(1040)),
+	}
+	hub := newBluetoothHub("", fs.scan)
+	hub.scanPeriod = time.Millisecond
+	tilts := hub.subscribe()
+	others := hub.subscribe()
+
+	// failures back off exponentially
+	assert.Equal(t, bluetoothMinBackoff, hub.scanOnce())
+	assert.Equal(t, 2*bluetoothMinBackoff, hub.scanOnce())
+	health := hub.Health()
+	assert.Equal(t, "default", health.Adapter)
+	assert.False(t, health.Scanning)
+	assert.Equal(t, 2, health.ConsecutiveErrors)
+	assert.Equal(t, "hci0: device busy", health.LastError.Error())
+
+	tilt := &TiltHydrometer{
+		name:      "tilt",
+		bluetooth: tilts,
+		data:      newRecentData(),
+	}
+	samples, err := tilt.Read()
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, "default", samples[0].Tags()["scanner"])
+	assert.Equal(t, float32(0), samples[0].Datapoints()[0].Value())
+	assert.Equal(t, float32(2), samples[0].Datapoints()[1].Value())
+
+	assert.Equal(t, 4*bluetoothMinBackoff, hub.scanOnce())
+	// a successful scan resets everything but the total
+	assert.Equal(t, time.Duration(0), hub.scanOnce())
+	assert.Equal(t, bluetoothMinBackoff, hub.backoff)
+	health = hub.Health()
+	assert.True(t, health.Scanning)
+	assert.Equal(t, 0, health.ConsecutiveErrors)
+	assert.Equal(t, uint64(3), health.TotalErrors)
+
+	// every subscriber gets the advertisement
+	assert.Equal(t, 1, len(others.GetAdvertisements()))
+	samples, err = tilt.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(samples))
+	assert.Equal(t, "red", samples[0].Tags()["color"])
+	assert.Equal(t, float32(1), samples[1].Datapoints()[0].Value())
+	assert.Equal(t, float32(3), samples[1].Datapoints()[1].Value())
+
+	// a capture that can't be written is given up on, and reported
+	hub.capture = newCaptureWriter(failingWriter{})
+	hub.advHandler(fs.ad)
+	assert.Nil(t, hub.capture)
+	assert.Equal(t, "disk full", hub.Health().CaptureError.Error())
+	samples, err = tilt.Read()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "stopped capturing")
+	assert.Equal(t, 2, len(samples))
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
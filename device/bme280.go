@@ -0,0 +1,213 @@
+package device
+
+// Contains a Reader implementation for the Bosch BME280
+// temperature, humidity and pressure sensor, connected over I2C
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// BME280DefaultAddress is the I2C address of a BME280 with SDO pulled low.
+// With SDO pulled high it is 0x77
+const BME280DefaultAddress = 0x76
+
+// BME280 registers and values, from the datasheet
+const (
+	bme280RegChipID   = 0xd0
+	bme280RegCalib00  = 0x88 // 26 bytes of temperature/pressure calibration (and dig_H1)
+	bme280RegCalib26  = 0xe1 // 7 bytes of humidity calibration
+	bme280RegCtrlHum  = 0xf2
+	bme280RegStatus   = 0xf3
+	bme280RegCtrlMeas = 0xf4
+	bme280RegData     = 0xf7 // 8 bytes, pressure, temperature then humidity
+
+	bme280ChipID = 0x60
+	// 1x oversampling for humidity
+	bme280CtrlHum = 0x01
+	// 1x oversampling for temperature and pressure, forced mode
+	// (take a single measurement then go back to sleep)
+	bme280CtrlMeasForced = 0x25
+	// set in the status register while a measurement is running
+	bme280StatusMeasuring = 0x08
+	// a forced measurement at 1x oversampling takes under 10ms
+	bme280MeasurementTimeout = 50 * time.Millisecond
+)
+
+// BME280 reads temperature, humidity and pressure from a BME280 sensor
+type BME280 struct {
+	name  string
+	bus   I2CBus
+	calib *bme280Calibration
+}
+
+// calibration values burned into each chip at the factory, named as in the datasheet
+type bme280Calibration struct {
+	t1                             uint16
+	t2, t3                         int16
+	p1                             uint16
+	p2, p3, p4, p5, p6, p7, p8, p9 int16
+	h1, h3                         uint8
+	h2, h4, h5                     int16
+	h6                             int8
+}
+
+// NewBME280 creates a new BME280 device talking over the given I2C bus.
+// The chip isn't touched until the first Read
+func NewBME280(name string, bus I2CBus) *BME280 {
+	return &BME280{
+		name: name,
+		bus:  bus,
+	}
+}
+
+// Read triggers a single measurement and returns a sample
+// holding the temperature, relative humidity and pressure
+func (b *BME280) Read() ([]measurement.Sample, error) {
+	if b.calib == nil {
+		calib, err := b.readCalibration()
+		if err != nil {
+			return nil, err
+		}
+		b.calib = calib
+	}
+	raw, err := b.measure()
+	if err != nil {
+		return nil, err
+	}
+	// pressure and temperature are 20 bits, humidity is 16 bits
+	adcP := int32(raw[0])<<12 | int32(raw[1])<<4 | int32(raw[2])>>4
+	adcT := int32(raw[3])<<12 | int32(raw[4])<<4 | int32(raw[5])>>4
+	adcH := int32(raw[6])<<8 | int32(raw[7])
+
+	c, tFine := b.calib.compensateTemperature(adcT)
+	t := time.Now()
+	sample := measurement.NewDeviceSample(b.Name())
+	sample.AddUnitDatapoint("celsius", float32(c), measurement.Celsius, t)
+	sample.AddUnitDatapoint("fahrenheit", celsiusToFahrenheit(float32(c)), measurement.Fahrenheit, t)
+	sample.AddUnitDatapoint("humidity", float32(b.calib.compensateHumidity(adcH, tFine)), measurement.Percent, t)
+	// report pressure in hectopascals (millibars)
+	sample.AddUnitDatapoint("pressure", float32(b.calib.compensatePressure(adcP, tFine)/100), measurement.Hectopascal, t)
+	return []measurement.Sample{sample}, nil
+}
+
+// Name returns the name of this device
+func (b *BME280) Name() string {
+	return b.name
+}
+
+// checks that a BME280 is actually there, and reads its calibration values
+func (b *BME280) readCalibration() (*bme280Calibration, error) {
+	id, err := readI2CRegisters(b.bus, bme280RegChipID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if id[0] != bme280ChipID {
+		return nil, fmt.Errorf("unexpected bme280 chip id 0x%02x", id[0])
+	}
+	tp, err := readI2CRegisters(b.bus, bme280RegCalib00, 26)
+	if err != nil {
+		return nil, err
+	}
+	h, err := readI2CRegisters(b.bus, bme280RegCalib26, 7)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	return &bme280Calibration{
+		t1: le.Uint16(tp[0:2]),
+		t2: int16(le.Uint16(tp[2:4])),
+		t3: int16(le.Uint16(tp[4:6])),
+		p1: le.Uint16(tp[6:8]),
+		p2: int16(le.Uint16(tp[8:10])),
+		p3: int16(le.Uint16(tp[10:12])),
+		p4: int16(le.Uint16(tp[12:14])),
+		p5: int16(le.Uint16(tp[14:16])),
+		p6: int16(le.Uint16(tp[16:18])),
+		p7: int16(le.Uint16(tp[18:20])),
+		p8: int16(le.Uint16(tp[20:22])),
+		p9: int16(le.Uint16(tp[22:24])),
+		h1: tp[25],
+		h2: int16(le.Uint16(h[0:2])),
+		h3: h[2],
+		// h4 and h5 are 12 bit values sharing the nibbles of 0xe5
+		h4: int16(int8(h[3]))<<4 | int16(h[4]&0x0f),
+		h5: int16(int8(h[5]))<<4 | int16(h[4]>>4),
+		h6: int8(h[6]),
+	}, nil
+}
+
+// runs a forced mode measurement, returning the 8 raw data bytes
+func (b *BME280) measure() ([]byte, error) {
+	// ctrl_hum only takes effect after a write to ctrl_meas
+	if err := writeI2CRegister(b.bus, bme280RegCtrlHum, bme280CtrlHum); err != nil {
+		return nil, err
+	}
+	if err := writeI2CRegister(b.bus, bme280RegCtrlMeas, bme280CtrlMeasForced); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(bme280MeasurementTimeout)
+	for {
+		status, err := readI2CRegisters(b.bus, bme280RegStatus, 1)
+		if err != nil {
+			return nil, err
+		}
+		if status[0]&bme280StatusMeasuring == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for bme280 measurement")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	return readI2CRegisters(b.bus, bme280RegData, 8)
+}
+
+// The compensation formulas below are the floating point versions from
+// section 8.1 of the BME280 datasheet
+
+// returns the temperature in celsius, and the fine temperature
+// value used to compensate the other measurements
+func (c *bme280Calibration) compensateTemperature(adcT int32) (float64, float64) {
+	var1 := (float64(adcT)/16384 - float64(c.t1)/1024) * float64(c.t2)
+	var2 := float64(adcT)/131072 - float64(c.t1)/8192
+	var2 = var2 * var2 * float64(c.t3)
+	tFine := var1 + var2
+	return tFine / 5120, tFine
+}
+
+// returns the pressure in pascals
+func (c *bme280Calibration) compensatePressure(adcP int32, tFine float64) float64 {
+	var1 := tFine/2 - 64000
+	var2 := var1 * var1 * float64(c.p6) / 32768
+	var2 = var2 + var1*float64(c.p5)*2
+	var2 = var2/4 + float64(c.p4)*65536
+	var1 = (float64(c.p3)*var1*var1/524288 + float64(c.p2)*var1) / 524288
+	var1 = (1 + var1/32768) * float64(c.p1)
+	if var1 == 0 {
+		// avoid dividing by zero
+		return 0
+	}
+	p := 1048576 - float64(adcP)
+	p = (p - var2/4096) * 6250 / var1
+	var1 = float64(c.p9) * p * p / 2147483648
+	var2 = p * float64(c.p8) / 32768
+	return p + (var1+var2+float64(c.p7))/16
+}
+
+// returns the relative humidity as a percentage
+func (c *bme280Calibration) compensateHumidity(adcH int32, tFine float64) float64 {
+	h := tFine - 76800
+	h = (float64(adcH) - (float64(c.h4)*64 + float64(c.h5)/16384*h)) *
+		(float64(c.h2) / 65536 * (1 + float64(c.h6)/67108864*h*(1+float64(c.h3)/67108864*h)))
+	h = h * (1 - float64(c.h1)*h/524288)
+	if h > 100 {
+		return 100
+	} else if h < 0 {
+		return 0
+	}
+	return h
+}
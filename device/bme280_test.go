@@ -0,0 +1,63 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Register fixtures using the example calibration values from the datasheet
+func newBME280FakeBus() *fakeRegisterBus {
+	return newFakeRegisterBus(map[byte][]byte{
+		bme280RegChipID: {bme280ChipID},
+		bme280RegCalib00: {
+			0x70, 0x6b, 0x43, 0x67, 0x18, 0xfc, 0x7d, 0x8e, 0x43, 0xd6, 0xd0, 0x0b, 0x27,
+			0x0b, 0x8c, 0x00, 0xf9, 0xff, 0x8c, 0x3c, 0xf8, 0xc6, 0x70, 0x17, 0x00, 0x4b,
+		},
+		bme280RegCalib26: {0x6a, 0x01, 0x00, 0x13, 0x29, 0x03, 0x1e},
+		bme280RegData:    {0x65, 0x5a, 0xc0, 0x7e, 0xed, 0x00, 0x75, 0x30},
+	})
+}
+
+func TestBME280Calibration(t *testing.T) {
+	b := NewBME280("chamber", newBME280FakeBus())
+	calib, err := b.readCalibration()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(27504), calib.t1)
+	assert.Equal(t, int16(-1000), calib.t3)
+	assert.Equal(t, int16(-14600), calib.p8)
+	assert.Equal(t, uint8(75), calib.h1)
+	assert.Equal(t, int16(362), calib.h2)
+	assert.Equal(t, int16(313), calib.h4)
+	assert.Equal(t, int16(50), calib.h5)
+	assert.Equal(t, int8(30), calib.h6)
+}
+
+func TestBME280Read(t *testing.T) {
+	bus := newBME280FakeBus()
+	b := NewBME280("chamber", bus)
+	samples, err := b.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+
+	values := map[string]float32{}
+	for _, d := range samples[0].Datapoints() {
+		values[d.Name()] = d.Value()
+	}
+	assert.InDelta(t, 25.08, values["celsius"], 0.01)
+	assert.InDelta(t, 77.14, values["fahrenheit"], 0.01)
+	assert.InDelta(t, 55.0, values["humidity"], 0.01)
+	assert.InDelta(t, 1006.53, values["pressure"], 0.01)
+
+	// a forced measurement was requested
+	assert.Equal(t, []byte{bme280CtrlHum}, bus.writes[bme280RegCtrlHum])
+	assert.Equal(t, []byte{bme280CtrlMeasForced}, bus.writes[bme280RegCtrlMeas])
+}
+
+func TestBME280WrongChip(t *testing.T) {
+	bus := newBME280FakeBus()
+	bus.registers[bme280RegChipID] = 0x58 // a BMP280, which has no humidity sensor
+	b := NewBME280("chamber", bus)
+	_, err := b.Read()
+	assert.NotNil(t, err)
+}
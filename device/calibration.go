@@ -0,0 +1,129 @@
+package device
+
+import (
+	"fmt"
+	"math"
+)
+
+// MaxCalibrationDegree is the highest degree polynomial a calibration can be fit with.
+// Anything higher will happily fit a handful of points and be wrong everywhere else
+const MaxCalibrationDegree = 3
+
+// CalibrationPoint is a raw reading from a device, and the actual
+// value it should have read (e.g. from a hydrometer or thermometer)
+type CalibrationPoint struct {
+	Raw    float64
+	Actual float64
+}
+
+// Calibration corrects raw device readings using a polynomial, or a
+// constant offset. The zero value leaves readings untouched
+type Calibration struct {
+	offset float32
+
+	// the polynomial is evaluated at (raw-center)/scale to keep the fit
+	// well conditioned, as gravity readings all bunch up around 1.0
+	center       float64
+	scale        float64
+	coefficients []float64 // lowest degree first
+}
+
+// OffsetCalibration returns a calibration which adds a constant offset to readings
+func OffsetCalibration(offset float32) Calibration {
+	return Calibration{offset: offset}
+}
+
+// FitCalibration fits a polynomial of the given degree (1 being linear) through the
+// calibration points using least squares. At least degree+1 points with distinct
+// raw values are needed
+func FitCalibration(points []CalibrationPoint, degree int) (Calibration, error) {
+	if degree < 1 || degree > MaxCalibrationDegree {
+		return Calibration{}, fmt.Errorf("calibration degree must be between 1 and %d, got %d", MaxCalibrationDegree, degree)
+	}
+	distinct := make(map[float64]bool)
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		distinct[p.Raw] = true
+		min = math.Min(min, p.Raw)
+		max = math.Max(max, p.Raw)
+	}
+	if len(distinct) < degree+1 {
+		return Calibration{}, fmt.Errorf("a degree %d calibration needs at least %d points with different raw values, got %d", degree, degree+1, len(distinct))
+	}
+	c := Calibration{
+		center: (min + max) / 2,
+		scale:  (max - min) / 2,
+	}
+	// Build the normal equations (XᵀX)a = Xᵀy, as an augmented matrix
+	n := degree + 1
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n+1)
+	}
+	for _, p := range points {
+		x := c.normalize(p.Raw)
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				m[i][j] += math.Pow(x, float64(i+j))
+			}
+			m[i][n] += math.Pow(x, float64(i)) * p.Actual
+		}
+	}
+	coefficients, err := solve(m)
+	if err != nil {
+		return Calibration{}, err
+	}
+	c.coefficients = coefficients
+	return c, nil
+}
+
+// Apply returns the calibrated value of a raw reading
+func (c Calibration) Apply(raw float32) float32 {
+	if len(c.coefficients) == 0 {
+		return raw + c.offset
+	}
+	x := c.normalize(float64(raw))
+	// Horner's method
+	value := 0.0
+	for i := len(c.coefficients) - 1; i >= 0; i-- {
+		value = value*x + c.coefficients[i]
+	}
+	return float32(value)
+}
+
+func (c Calibration) normalize(raw float64) float64 {
+	return (raw - c.center) / c.scale
+}
+
+// solve solves the linear system in the augmented matrix m using
+// gaussian elimination with partial pivoting. m is modified in place
+func solve(m [][]float64) ([]float64, error) {
+	n := len(m)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("calibration points cannot be fit")
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := col + 1; row < n; row++ {
+			factor := m[row][col] / m[col][col]
+			for k := col; k <= n; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+	solution := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= m[row][k] * solution[k]
+		}
+		solution[row] = sum / m[row][row]
+	}
+	return solution, nil
+}
@@ -0,0 +1,72 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetCalibration(t *testing.T) {
+	assert.Equal(t, float32(1.05), Calibration{}.Apply(1.05))
+	assert.InDelta(t, 1.047, OffsetCalibration(-0.003).Apply(1.05), 1e-6)
+	assert.InDelta(t, 66.5, OffsetCalibration(-0.5).Apply(67), 1e-6)
+}
+
+func TestLinearCalibration(t *testing.T) {
+	c, err := FitCalibration([]CalibrationPoint{
+		{Raw: 33, Actual: 32},
+		{Raw: 213, Actual: 212},
+	}, 1)
+	assert.Nil(t, err)
+	assert.InDelta(t, 32, c.Apply(33), 1e-4)
+	assert.InDelta(t, 67, c.Apply(68), 1e-4)
+
+	// least squares through noisy points
+	c, err = FitCalibration([]CalibrationPoint{
+		{Raw: 1.000, Actual: 1.002},
+		{Raw: 1.000, Actual: 1.004},
+		{Raw: 1.060, Actual: 1.063},
+	}, 1)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.003, c.Apply(1.000), 1e-5)
+	assert.InDelta(t, 1.063, c.Apply(1.060), 1e-5)
+}
+
+func TestPolynomialCalibration(t *testing.T) {
+	// a tilt reading right at both ends of its range, but low in the middle
+	c, err := FitCalibration([]CalibrationPoint{
+		{Raw: 1.000, Actual: 1.000},
+		{Raw: 1.036, Actual: 1.040},
+		{Raw: 1.080, Actual: 1.080},
+	}, 2)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.000, c.Apply(1.000), 1e-6)
+	assert.InDelta(t, 1.040, c.Apply(1.036), 1e-6)
+	assert.InDelta(t, 1.080, c.Apply(1.080), 1e-6)
+
+	c, err = FitCalibration([]CalibrationPoint{
+		{Raw: -1, Actual: -1},
+		{Raw: 0, Actual: 0},
+		{Raw: 1, Actual: 1},
+		{Raw: 2, Actual: 8},
+	}, 3)
+	assert.Nil(t, err)
+	assert.InDelta(t, 27, c.Apply(3), 1e-4)
+}
+
+func TestBadCalibration(t *testing.T) {
+	points := []CalibrationPoint{
+		{Raw: 1.000, Actual: 1.000},
+		{Raw: 1.000, Actual: 1.002},
+		{Raw: 1.050, Actual: 1.049},
+	}
+	_, err := FitCalibration(points, 0)
+	assert.NotNil(t, err)
+	_, err = FitCalibration(points, MaxCalibrationDegree+1)
+	assert.NotNil(t, err)
+	// only two distinct raw readings
+	_, err = FitCalibration(points, 2)
+	assert.NotNil(t, err)
+	_, err = FitCalibration(nil, 1)
+	assert.NotNil(t, err)
+}
@@ -26,8 +26,9 @@ func SetOnewireSysfsDir(dir string) {
 
 // DS18B20 represents a temperature sensor
 type DS18B20 struct {
-	name string
-	ID   string
+	name  string
+	ID    string
+	probe *ds18b20Probe
 }
 
 // NewDS18B20 creates a new sensor struct. Once created, the sensor can be
@@ -35,69 +36,124 @@ type DS18B20 struct {
 // and feed it into a callback function
 func NewDS18B20(name string, deviceID string) *DS18B20 {
 	return &DS18B20{
-		name: name,
-		ID:   deviceID,
+		name:  name,
+		ID:    deviceID,
+		probe: newDS18B20Probe(deviceID),
 	}
 }
 
+// SetRetries sets how many extra attempts are made to get a valid reading
+// from the probe before giving up on a Read
+func (d *DS18B20) SetRetries(retries int) {
+	d.probe.retries = retries
+}
+
+// SetSettings validates the given settings and, if valid, uses them for the
+// probe. They are written to the probe right away if it's connected, returning
+// an error if it doesn't support them
+func (d *DS18B20) SetSettings(settings DS18B20Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	return d.probe.setSettings(settings)
+}
+
+// SetCalibration sets the calibration applied to the probe's celsius readings
+func (d *DS18B20) SetCalibration(c Calibration) {
+	d.probe.calibration = c
+}
+
+// ErrorCounts returns a tally of the bad readings seen from this probe
+func (d *DS18B20) ErrorCounts() DS18B20ErrorCounts {
+	return d.probe.errorCounts()
+}
+
 // ReadTemperature reads data from the sensor and saves the temperature reading (celsius)
 // into the sensors lastReadTemperatureC field
 // if there is a problem reading data an error is returned
 func (d *DS18B20) Read() ([]measurement.Sample, error) {
-	dataFile := d.getSysfsPath()
-	b, err := ioutil.ReadFile(dataFile)
+	c, err := d.probe.read()
 	if err != nil {
 		return nil, err
 	}
+	sample := newDS18B20Sample(d.Name(), d.probe, c, time.Now())
+	// the Reader interface expects an array of samples, but this device is very simple,
+	// so just return the single sample alone in an array... it just has the temp
+	return []measurement.Sample{sample}, nil
+}
+
+// readDS18B20 reads the w1_slave file for the probe with the given ID and
+// returns the temperature it reports in celsius. The reading is validated
+// before being returned, see validateScratchpad
+func readDS18B20(id string) (float32, error) {
+	b, err := ioutil.ReadFile(getSysfsPath(id))
+	if err != nil {
+		return 0, err
+	}
 	// simple sanity checks
-	// 1. make sure the output is exactly 2 lines
-	lines := strings.Split(string(b), "\n")
+	// 1. make sure the output is exactly 2 lines (ignoring the trailing newline)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
 	if len(lines) != 2 {
-		return nil, fmt.Errorf("unexpected number of lines in sensor output: %s", string(len(lines)))
+		return 0, fmt.Errorf("unexpected number of lines in sensor output: %d", len(lines))
 	}
 	// 2. Make sure the device is ready to read (first line ends in 'YES')
-	if !d.isReady(lines[0]) {
-		return nil, fmt.Errorf("device not ready")
+	if !isReady(lines[0]) {
+		return 0, ErrDS18B20NotReady
+	}
+	// 3. Make sure the raw scratchpad is intact and isn't a known bad value
+	if err := validateScratchpad(lines[0]); err != nil {
+		return 0, err
+	}
+	c, err := parseTemperature(lines[1])
+	if err != nil {
+		return 0, err
 	}
-	return d.parseTemperature(lines[1])
+	// 4. Some drivers report a failed read as -127C rather than a bad CRC
+	if c == ds18b20DisconnectedCelsius {
+		return 0, ErrDS18B20Disconnected
+	}
+	return c, nil
 }
 
-// Returns a celsius and fahrenheit reading given the data line for a sensor
+// Returns a celsius reading given the data line for a sensor
 // reading. Returns an error if there is an issue parsing the line
-func (d *DS18B20) parseTemperature(dataLine string) ([]measurement.Sample, error) {
+func parseTemperature(dataLine string) (float32, error) {
 	// Take the last field and split on '=' (we expect a format `t=$temp`)
 	fields := strings.Split(dataLine, " ")
 	thermReading := strings.Split(fields[len(fields)-1], "=")
 
 	// Expect the above split to return 2 fields (the `t` and the `$temp`)
 	if len(thermReading) != 2 {
-		return nil, fmt.Errorf("unknown error reading temperature from sensor")
+		return 0, fmt.Errorf("unknown error reading temperature from sensor")
 	}
 	// attempt to parse into a float
 	// the actual data value is always a signed int, but lets parse right
 	// into a float because we will immediately be dividing by 1000
 	rawReading, err := strconv.ParseFloat(thermReading[1], 32)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing temperature: %s", err.Error())
+		return 0, fmt.Errorf("error parsing temperature: %s", err.Error())
 	}
-	t := time.Now()
+	// convert from millicelsius(?) to celsius
+	return float32(rawReading) / 1000, nil
+}
+
+// newDS18B20Sample builds a sample holding a celsius and fahrenheit
+// reading for the given probe, along with its running error count.
+// The probe's calibration is applied to the reading
+func newDS18B20Sample(name string, p *ds18b20Probe, c float32, t time.Time) measurement.Sample {
 	// create a sample using the retrieved data
-	sample := measurement.NewDeviceSample(d.Name())
+	sample := measurement.NewDeviceSample(name)
 	// Add the device ID to the sample as a tag
-	sample.AddTag("id", d.ID)
-	// convert from millicelsius(?) to celsius
-	c := float32(rawReading) / 1000
+	sample.AddTag("id", p.id)
+	c = p.calibration.Apply(c)
 	// add the celsius reading to the sample
-	sample.AddDatapoint("celsius", c, t)
+	sample.AddUnitDatapoint("celsius", c, measurement.Celsius, t)
 	// convert from celsius to fahrenheit
 	f := celsiusToFahrenheit(c)
-	sample.AddDatapoint("fahrenheit", f, t)
-
-	// return the results
-	// the Reader interface expects an array of samples, but this device is very simple,
-	// so just return the single sample alone in an array... it just has the temp
-	return []measurement.Sample{sample}, nil
-
+	sample.AddUnitDatapoint("fahrenheit", f, measurement.Fahrenheit, t)
+	// report how many bad readings have been thrown away so far
+	sample.AddDatapoint("read-errors", float32(p.errorCounts().Total()), t)
+	return sample
 }
 
 // Name returns the formatted name of the sensor, in the format
@@ -108,7 +164,7 @@ func (d *DS18B20) Name() string {
 
 // checks if the reading indicates that the sensor data
 // is good to use. returns true if so, otherwise false
-func (d *DS18B20) isReady(s string) bool {
+func isReady(s string) bool {
 	fields := strings.Split(s, " ")
 	n := len(fields)
 	return fields[n-1] == "YES"
@@ -122,6 +178,6 @@ func celsiusToFahrenheit(c float32) float32 {
 // utility to get a filepath to read sensor data
 // uses ONEWIRE_SYSFS_DIR and the sensor's ID
 // to build a filepath to read sensor data from
-func (d *DS18B20) getSysfsPath() string {
-	return filepath.Join(OnewireSysfsDir, d.ID, "w1_slave")
+func getSysfsPath(id string) string {
+	return filepath.Join(OnewireSysfsDir, id, "w1_slave")
 }
@@ -0,0 +1,186 @@
+package device
+
+// Contains a Reader implementation that discovers and reads every
+// DS18B20 temperature probe attached to the onewire bus
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/nherson/brewski/measurement"
+)
+
+// ds18b20FamilyCode is the onewire family code prefixed to the ID of every
+// DS18B20 probe, as seen in the sysfs device directory names (28-xxxxxxxxxxxx)
+const ds18b20FamilyCode = "28"
+
+// DS18B20Bus reads from every DS18B20 probe found on the onewire bus.
+// The bus is rescanned on every Read, so probes that are plugged in or
+// swapped around while brewski is running are picked up automatically
+type DS18B20Bus struct {
+	name         string
+	aliases      map[string]string
+	retries      int
+	settings     DS18B20Settings
+	calibrations map[string]Calibration
+	probes       map[string]*ds18b20Probe
+	lock         *sync.Mutex
+}
+
+// NewDS18B20Bus creates a new reader for all DS18B20 probes on the bus.
+// The aliases map probe IDs to a friendlier name which will be added
+// to that probe's samples as the 'alias' tag
+func NewDS18B20Bus(name string, aliases map[string]string) *DS18B20Bus {
+	if aliases == nil {
+		aliases = make(map[string]string)
+	}
+	return &DS18B20Bus{
+		name:    name,
+		aliases: aliases,
+		probes:  make(map[string]*ds18b20Probe),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// SetRetries sets how many extra attempts are made to get a valid reading
+// from each probe before giving up on it for a Read
+func (b *DS18B20Bus) SetRetries(retries int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.retries = retries
+	for _, p := range b.probes {
+		p.retries = retries
+	}
+}
+
+// SetSettings validates the given settings and, if valid, uses them for
+// every probe on the bus. They are written to the probes currently on the bus
+// right away, returning an error if any of them doesn't support them, and to
+// probes plugged in later when they are first read
+func (b *DS18B20Bus) SetSettings(settings DS18B20Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	b.lock.Lock()
+	b.settings = settings
+	for _, p := range b.probes {
+		p.settings = settings
+		p.applied = false
+	}
+	b.lock.Unlock()
+	ids, err := discoverDS18B20s()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := b.probe(id).setSettings(settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCalibrations sets the calibration applied to the celsius readings of
+// each probe, keyed on probe ID. Probes without one are left uncalibrated
+func (b *DS18B20Bus) SetCalibrations(calibrations map[string]Calibration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.calibrations = calibrations
+	for id, p := range b.probes {
+		p.calibration = calibrations[id]
+	}
+}
+
+// ErrorCounts returns a tally of the bad readings seen from each probe
+// that has been discovered so far, keyed on probe ID
+func (b *DS18B20Bus) ErrorCounts() map[string]DS18B20ErrorCounts {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	counts := make(map[string]DS18B20ErrorCounts)
+	for id, p := range b.probes {
+		counts[id] = p.errorCounts()
+	}
+	return counts
+}
+
+// returns the probe with the given ID, creating it the first time it's seen.
+// Probes are kept around after they disappear from the bus so their error
+// counts aren't lost if they come back
+func (b *DS18B20Bus) probe(id string) *ds18b20Probe {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	p, found := b.probes[id]
+	if !found {
+		p = newDS18B20Probe(id)
+		p.retries = b.retries
+		p.settings = b.settings
+		p.calibration = b.calibrations[id]
+		b.probes[id] = p
+	}
+	return p
+}
+
+// marks any known probes that weren't found on the bus as needing their
+// settings applied again, since they will have lost them if they were unplugged
+func (b *DS18B20Bus) forgetMissing(ids []string) {
+	found := make(map[string]bool)
+	for _, id := range ids {
+		found[id] = true
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for id, p := range b.probes {
+		if !found[id] {
+			p.applied = false
+		}
+	}
+}
+
+// Read discovers all the probes currently on the bus and returns a sample
+// for each of them. A probe that fails to read does not prevent the others
+// from being reported; any errors are collected and returned alongside
+// the samples that were read successfully
+func (b *DS18B20Bus) Read() ([]measurement.Sample, error) {
+	ids, err := discoverDS18B20s()
+	if err != nil {
+		return nil, err
+	}
+	b.forgetMissing(ids)
+	var errList *multierror.Error
+	samples := []measurement.Sample{}
+	for _, id := range ids {
+		p := b.probe(id)
+		c, err := p.read()
+		if err != nil {
+			errList = multierror.Append(errList, fmt.Errorf("error reading ds18b20 '%s': %s", id, err.Error()))
+			continue
+		}
+		sample := newDS18B20Sample(b.Name(), p, c, time.Now())
+		if alias, found := b.aliases[id]; found {
+			sample.AddTag("alias", alias)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, errList.ErrorOrNil()
+}
+
+// Name returns the name of this device
+func (b *DS18B20Bus) Name() string {
+	return b.name
+}
+
+// returns the IDs of all DS18B20 probes currently found in the onewire sysfs dir
+func discoverDS18B20s() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(OnewireSysfsDir, ds18b20FamilyCode+"-*"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(paths))
+	for _, p := range paths {
+		ids = append(ids, filepath.Base(p))
+	}
+	return ids, nil
+}
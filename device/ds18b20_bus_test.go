@@ -0,0 +1,70 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDS18B20BusRead(t *testing.T) {
+	SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	bus := NewDS18B20Bus("probes", map[string]string{
+		"28-0123456789abcd": "fermenter",
+	})
+
+	// Both dummy probes in the testdata dir should be discovered,
+	// but the bus master directory should not be
+	samples, err := bus.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(samples))
+
+	celsiusByID := map[string]float32{}
+	for _, sample := range samples {
+		assert.Equal(t, "probes", sample.DeviceName())
+		id := sample.Tags()["id"]
+		alias, hasAlias := sample.Tags()["alias"]
+		switch id {
+		case "28-0123456789abcd":
+			assert.True(t, hasAlias)
+			assert.Equal(t, "fermenter", alias)
+		case "28-00000a1b2c3d":
+			assert.False(t, hasAlias)
+		default:
+			assert.Fail(t, "unexpected probe id '"+id+"'")
+		}
+		celsiusByID[id] = sample.Datapoints()[0].Value()
+	}
+	assert.Equal(t, float32(21.375), celsiusByID["28-0123456789abcd"])
+	assert.Equal(t, float32(18.625), celsiusByID["28-00000a1b2c3d"])
+}
+
+func TestDS18B20BusEmpty(t *testing.T) {
+	SetOnewireSysfsDir("../testdata/temperature/does-not-exist")
+	defer SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	bus := NewDS18B20Bus("probes", nil)
+	samples, err := bus.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+}
+
+func TestDS18B20BusCalibration(t *testing.T) {
+	SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	bus := NewDS18B20Bus("probes", nil)
+	bus.SetCalibrations(map[string]Calibration{
+		"28-0123456789abcd": OffsetCalibration(-0.375),
+	})
+	samples, err := bus.Read()
+	assert.Nil(t, err)
+	for _, sample := range samples {
+		switch sample.Tags()["id"] {
+		case "28-0123456789abcd":
+			assert.Equal(t, float32(21), sample.Datapoints()[0].Value())
+			assert.Equal(t, float32(69.8), sample.Datapoints()[1].Value())
+		case "28-00000a1b2c3d":
+			assert.Equal(t, float32(18.625), sample.Datapoints()[0].Value())
+		}
+	}
+}
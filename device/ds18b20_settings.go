@@ -0,0 +1,103 @@
+package device
+
+// Contains optional tuning of DS18B20 probes through the kernel's w1_therm
+// sysfs attributes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DS18B20Settings holds optional settings for DS18B20 probes. The settings
+// are written to a probe the first time it is read (and again if it is
+// unplugged and comes back), the zero value leaves the probe untouched
+type DS18B20Settings struct {
+	// Resolution of temperature conversions in bits, between 9 and 12.
+	// Each bit less halves the time a conversion takes (750ms at 12 bits)
+	Resolution int
+	// ConversionTime overrides how long the kernel waits for a conversion
+	ConversionTime time.Duration
+	// UseTemperatureAttribute reads the 'temperature' sysfs attribute, which
+	// newer kernels provide, instead of parsing w1_slave. Probes without
+	// the attribute fall back to w1_slave
+	UseTemperatureAttribute bool
+}
+
+// Validate returns an error if any of the settings are out of range
+func (s DS18B20Settings) Validate() error {
+	if s.Resolution != 0 && (s.Resolution < 9 || s.Resolution > 12) {
+		return fmt.Errorf("ds18b20 resolution must be between 9 and 12 bits, got %d", s.Resolution)
+	}
+	if s.ConversionTime < 0 {
+		return fmt.Errorf("ds18b20 conversion time cannot be negative")
+	}
+	if s.ConversionTime%time.Millisecond != 0 {
+		return fmt.Errorf("ds18b20 conversion time must be a whole number of milliseconds")
+	}
+	return nil
+}
+
+// writes the settings to the probe with the given ID
+func (s DS18B20Settings) apply(id string) error {
+	if s.Resolution != 0 {
+		// Newer kernels have a dedicated attribute, older ones
+		// take the resolution written straight to w1_slave
+		resolutionPath := filepath.Join(OnewireSysfsDir, id, "resolution")
+		if !fileExists(resolutionPath) {
+			resolutionPath = getSysfsPath(id)
+		}
+		if err := writeSysfsInt(resolutionPath, s.Resolution); err != nil {
+			return fmt.Errorf("error setting ds18b20 resolution: %s", err.Error())
+		}
+	}
+	if s.ConversionTime != 0 {
+		convTimePath := filepath.Join(OnewireSysfsDir, id, "conv_time")
+		if !fileExists(convTimePath) {
+			return fmt.Errorf("kernel does not support setting ds18b20 conversion time")
+		}
+		if err := writeSysfsInt(convTimePath, int(s.ConversionTime/time.Millisecond)); err != nil {
+			return fmt.Errorf("error setting ds18b20 conversion time: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// readTemperatureAttribute reads the 'temperature' attribute for the probe with the
+// given ID, which holds just the temperature in millicelsius. The kernel has already
+// checked the CRC, but the known bogus values are still rejected
+func readTemperatureAttribute(id string) (float32, error) {
+	b, err := ioutil.ReadFile(getTemperatureAttributePath(id))
+	if err != nil {
+		return 0, err
+	}
+	rawReading, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 32)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing temperature: %s", err.Error())
+	}
+	c := float32(rawReading) / 1000
+	switch c {
+	case ds18b20PowerOnResetCelsius:
+		return 0, ErrDS18B20PowerOnReset
+	case ds18b20DisconnectedCelsius:
+		return 0, ErrDS18B20Disconnected
+	}
+	return c, nil
+}
+
+func getTemperatureAttributePath(id string) string {
+	return filepath.Join(OnewireSysfsDir, id, "temperature")
+}
+
+func writeSysfsInt(path string, value int) error {
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(value)+"\n"), 0644)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,124 @@
+package device
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// creates a fake onewire sysfs dir holding a single probe with the given
+// files, returning the dir. The caller is responsible for removing it
+func newFakeOnewireDir(t *testing.T, id string, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "brewski-onewire")
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, id), 0755))
+	for name, contents := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, id, name), []byte(contents), 0644))
+	}
+	return dir
+}
+
+func readFakeFile(t *testing.T, dir, id, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, id, name))
+	assert.Nil(t, err)
+	return string(b)
+}
+
+func TestDS18B20SettingsValidate(t *testing.T) {
+	assert.Nil(t, DS18B20Settings{}.Validate())
+	assert.Nil(t, DS18B20Settings{Resolution: 9, ConversionTime: 100 * time.Millisecond}.Validate())
+	assert.NotNil(t, DS18B20Settings{Resolution: 8}.Validate())
+	assert.NotNil(t, DS18B20Settings{Resolution: 13}.Validate())
+	assert.NotNil(t, DS18B20Settings{ConversionTime: -time.Millisecond}.Validate())
+	assert.NotNil(t, DS18B20Settings{ConversionTime: 1500 * time.Microsecond}.Validate())
+}
+
+func TestDS18B20ResolutionAttribute(t *testing.T) {
+	id := "28-0123456789abcd"
+	dir := newFakeOnewireDir(t, id, map[string]string{
+		"w1_slave":    "56 01 4b 46 7f ff 0c 10 7b : crc=7b YES\n56 01 4b 46 7f ff 0c 10 7b t=21375\n",
+		"resolution":  "12\n",
+		"conv_time":   "750\n",
+		"temperature": "21375\n",
+	})
+	defer os.RemoveAll(dir)
+	SetOnewireSysfsDir(dir)
+	defer SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	probe := NewDS18B20("probe", id)
+	assert.Nil(t, probe.SetSettings(DS18B20Settings{
+		Resolution:     10,
+		ConversionTime: 200 * time.Millisecond,
+	}))
+	samples, err := probe.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, "10\n", readFakeFile(t, dir, id, "resolution"))
+	assert.Equal(t, "200\n", readFakeFile(t, dir, id, "conv_time"))
+
+	// Invalid settings are refused
+	assert.NotNil(t, probe.SetSettings(DS18B20Settings{Resolution: 16}))
+}
+
+func TestDS18B20ResolutionLegacy(t *testing.T) {
+	// Older kernels have no resolution attribute, and take it
+	// written to w1_slave instead
+	id := "28-0123456789abcd"
+	dir := newFakeOnewireDir(t, id, map[string]string{
+		"w1_slave": "",
+	})
+	defer os.RemoveAll(dir)
+	SetOnewireSysfsDir(dir)
+	defer SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	settings := DS18B20Settings{Resolution: 11}
+	assert.Nil(t, settings.apply(id))
+	assert.Equal(t, "11\n", readFakeFile(t, dir, id, "w1_slave"))
+
+	// ...and have no way to set the conversion time
+	settings = DS18B20Settings{ConversionTime: 100 * time.Millisecond}
+	assert.NotNil(t, settings.apply(id))
+
+	// which is found when the settings are given, not on every read
+	assert.NotNil(t, NewDS18B20("probe", id).SetSettings(settings))
+	assert.NotNil(t, NewDS18B20Bus("bus", nil).SetSettings(settings))
+	// probes that aren't connected yet get them when they show up
+	assert.Nil(t, NewDS18B20("probe", "28-000000000000").SetSettings(settings))
+}
+
+func TestDS18B20TemperatureAttribute(t *testing.T) {
+	id := "28-0123456789abcd"
+	dir := newFakeOnewireDir(t, id, map[string]string{
+		// w1_slave holds a different temperature, to tell which file was read
+		"w1_slave":    "2a 01 4b 46 7f ff 06 10 16 : crc=16 YES\n2a 01 4b 46 7f ff 06 10 16 t=18625\n",
+		"temperature": "21375\n",
+	})
+	defer os.RemoveAll(dir)
+	SetOnewireSysfsDir(dir)
+	defer SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	probe := NewDS18B20("probe", id)
+	samples, err := probe.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, float32(18.625), samples[0].Datapoints()[0].Value())
+
+	assert.Nil(t, probe.SetSettings(DS18B20Settings{UseTemperatureAttribute: true}))
+	samples, err = probe.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, float32(21.375), samples[0].Datapoints()[0].Value())
+
+	// bogus values are still thrown away
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, id, "temperature"), []byte("85000\n"), 0644))
+	_, err = probe.Read()
+	assert.Equal(t, ErrDS18B20PowerOnReset, err)
+
+	// probes without the attribute fall back to w1_slave
+	assert.Nil(t, os.Remove(filepath.Join(dir, id, "temperature")))
+	samples, err = probe.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, float32(18.625), samples[0].Datapoints()[0].Value())
+}
@@ -3,6 +3,7 @@ package device
 import (
 	"testing"
 
+	"github.com/nherson/brewski/measurement"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,17 +22,22 @@ func TestDS18B20Read(t *testing.T) {
 	sample := samples[0]
 
 	assert.NotNil(t, sample)
-	assert.Equal(t, 2, len(sample.Datapoints()))
+	assert.Equal(t, 3, len(sample.Datapoints()))
 	fahrenheitDatapointExists := false
 	celsiusDatapointExists := false
 	for _, datapoint := range sample.Datapoints() {
 		switch datapoint.Name() {
 		case "celsius":
 			assert.Equal(t, float32(21.375), datapoint.Value())
+			assert.Equal(t, measurement.Celsius, datapoint.Unit())
 			celsiusDatapointExists = true
 		case "fahrenheit":
 			assert.Equal(t, float32(70.475), datapoint.Value())
+			assert.Equal(t, measurement.Fahrenheit, datapoint.Unit())
 			fahrenheitDatapointExists = true
+		case "read-errors":
+			assert.Equal(t, float32(0), datapoint.Value())
+			assert.Equal(t, measurement.NoUnit, datapoint.Unit())
 		}
 	}
 	assert.True(t, celsiusDatapointExists)
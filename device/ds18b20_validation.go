@@ -0,0 +1,186 @@
+package device
+
+// Contains validation of raw DS18B20 readings, weeding out the bogus values
+// the probes report when they have just powered on or are badly wired
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrDS18B20NotReady is returned when the kernel reports the reading is not ready (no 'YES')
+	ErrDS18B20NotReady = errors.New("device not ready")
+	// ErrDS18B20CRC is returned when the scratchpad bytes don't match their CRC
+	ErrDS18B20CRC = errors.New("crc mismatch in ds18b20 scratchpad")
+	// ErrDS18B20PowerOnReset is returned when the probe reports its 85C power-on value,
+	// meaning it reset before finishing a temperature conversion
+	ErrDS18B20PowerOnReset = errors.New("ds18b20 reported power-on reset value (85C)")
+	// ErrDS18B20Disconnected is returned for the readings produced by a disconnected
+	// or badly wired probe (an all zero scratchpad or -127C)
+	ErrDS18B20Disconnected = errors.New("ds18b20 appears to be disconnected")
+)
+
+const (
+	// raw temperature register value held by the probe after power-on,
+	// before any temperature conversion has been done
+	ds18b20PowerOnResetRaw = 0x0550
+	// the same power-on value, as reported by the kernel in celsius
+	ds18b20PowerOnResetCelsius = float32(85)
+	// the value reported by drivers when a probe can't be read at all
+	ds18b20DisconnectedCelsius = float32(-127)
+	// number of bytes in the scratchpad, the last of which is a CRC of the others
+	ds18b20ScratchpadLength = 9
+)
+
+// DS18B20ErrorCounts tallies the bad readings seen from a single probe,
+// broken down by the reason the reading was thrown away
+type DS18B20ErrorCounts struct {
+	NotReady     uint64
+	CRC          uint64
+	PowerOnReset uint64
+	Disconnected uint64
+	Other        uint64
+}
+
+// Total returns the total number of bad readings
+func (c DS18B20ErrorCounts) Total() uint64 {
+	return c.NotReady + c.CRC + c.PowerOnReset + c.Disconnected + c.Other
+}
+
+// ds18b20Probe reads a single probe, retrying bad readings
+// and keeping count of why they were bad
+type ds18b20Probe struct {
+	id          string
+	retries     int
+	settings    DS18B20Settings
+	applied     bool
+	calibration Calibration
+	errors      DS18B20ErrorCounts
+	lock        *sync.Mutex
+}
+
+func newDS18B20Probe(id string) *ds18b20Probe {
+	return &ds18b20Probe{
+		id:   id,
+		lock: &sync.Mutex{},
+	}
+}
+
+// setSettings sets the settings used for the probe. They are written to the probe
+// right away if it's on the bus, so unsupported settings are found when brewski
+// starts; otherwise they are written by the first read once it shows up
+func (p *ds18b20Probe) setSettings(settings DS18B20Settings) error {
+	p.settings = settings
+	p.applied = false
+	if !fileExists(filepath.Join(OnewireSysfsDir, p.id)) {
+		return nil
+	}
+	if err := settings.apply(p.id); err != nil {
+		return fmt.Errorf("ds18b20 '%s': %s", p.id, err)
+	}
+	p.applied = true
+	return nil
+}
+
+// read attempts to read a valid temperature (celsius) from the probe up to
+// retries+1 times, returning the error from the last attempt if none succeed
+func (p *ds18b20Probe) read() (float32, error) {
+	if !p.applied {
+		if err := p.settings.apply(p.id); err != nil {
+			p.countError(err)
+			return 0, err
+		}
+		p.applied = true
+	}
+	var err error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		var c float32
+		c, err = p.readOnce()
+		if err == nil {
+			return c, nil
+		}
+		p.countError(err)
+	}
+	return 0, err
+}
+
+// makes a single attempt at reading the probe, using the
+// temperature attribute instead of w1_slave if asked to
+func (p *ds18b20Probe) readOnce() (float32, error) {
+	if p.settings.UseTemperatureAttribute && fileExists(getTemperatureAttributePath(p.id)) {
+		return readTemperatureAttribute(p.id)
+	}
+	return readDS18B20(p.id)
+}
+
+func (p *ds18b20Probe) countError(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	switch err {
+	case ErrDS18B20NotReady:
+		p.errors.NotReady++
+	case ErrDS18B20CRC:
+		p.errors.CRC++
+	case ErrDS18B20PowerOnReset:
+		p.errors.PowerOnReset++
+	case ErrDS18B20Disconnected:
+		p.errors.Disconnected++
+	default:
+		p.errors.Other++
+	}
+}
+
+func (p *ds18b20Probe) errorCounts() DS18B20ErrorCounts {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.errors
+}
+
+// validateScratchpad checks the raw scratchpad bytes found at the start of the
+// first line of w1_slave output, e.g. '72 01 4b 46 7f ff 0e 10 57 : crc=57 YES'.
+// The CRC is verified, and the known bogus readings are rejected
+func validateScratchpad(line string) error {
+	fields := strings.Split(line, ":")
+	scratchpad, err := hex.DecodeString(strings.Replace(strings.TrimSpace(fields[0]), " ", "", -1))
+	if err != nil {
+		return fmt.Errorf("error parsing ds18b20 scratchpad: %s", err.Error())
+	}
+	if len(scratchpad) != ds18b20ScratchpadLength {
+		return fmt.Errorf("unexpected ds18b20 scratchpad length: %d", len(scratchpad))
+	}
+	// An unplugged data line reads back as all zeroes, which has a valid CRC
+	// of zero. The configuration register (byte 4) always has its low 5 bits
+	// set on a real probe, so use it to tell the two apart
+	if scratchpad[4]&0x1f != 0x1f {
+		return ErrDS18B20Disconnected
+	}
+	if dallasCRC8(scratchpad[:ds18b20ScratchpadLength-1]) != scratchpad[ds18b20ScratchpadLength-1] {
+		return ErrDS18B20CRC
+	}
+	raw := uint16(scratchpad[1])<<8 | uint16(scratchpad[0])
+	if raw == ds18b20PowerOnResetRaw {
+		return ErrDS18B20PowerOnReset
+	}
+	return nil
+}
+
+// dallasCRC8 computes the Dallas/Maxim onewire CRC (polynomial x^8 + x^5 + x^4 + 1)
+func dallasCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 0x01
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8c
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
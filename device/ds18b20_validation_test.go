@@ -0,0 +1,56 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScratchpad(t *testing.T) {
+	// a good reading of 21.375C
+	assert.Nil(t, validateScratchpad("56 01 4b 46 7f ff 0c 10 7b : crc=7b YES"))
+	// a good reading of 0C (ice bath) must not be mistaken for a disconnected probe
+	assert.Nil(t, validateScratchpad("00 00 4b 46 7f ff 0c 10 c8 : crc=c8 YES"))
+	// the 85C power-on reset value
+	assert.Equal(t, ErrDS18B20PowerOnReset, validateScratchpad("50 05 4b 46 7f ff 0c 10 1c : crc=1c YES"))
+	// all zeroes from a disconnected data line
+	assert.Equal(t, ErrDS18B20Disconnected, validateScratchpad("00 00 00 00 00 00 00 00 00 : crc=00 YES"))
+	// a corrupted byte
+	assert.Equal(t, ErrDS18B20CRC, validateScratchpad("56 01 4b 46 7f ff 0c 10 7c : crc=7c YES"))
+	// garbage
+	assert.NotNil(t, validateScratchpad("56 01 4b : crc=4b YES"))
+	assert.NotNil(t, validateScratchpad("zz zz zz zz zz zz zz zz zz : crc=zz YES"))
+}
+
+func TestDallasCRC8(t *testing.T) {
+	assert.Equal(t, byte(0x7b), dallasCRC8([]byte{0x56, 0x01, 0x4b, 0x46, 0x7f, 0xff, 0x0c, 0x10}))
+	assert.Equal(t, byte(0x00), dallasCRC8([]byte{0, 0, 0, 0, 0, 0, 0, 0}))
+}
+
+func TestDS18B20ErrorCounts(t *testing.T) {
+	SetOnewireSysfsDir("../testdata/temperature/ds18b20-bad")
+	defer SetOnewireSysfsDir("../testdata/temperature/ds18b20")
+
+	bus := NewDS18B20Bus("probes", nil)
+	bus.SetRetries(2)
+
+	// None of the probes in the testdata dir give good readings
+	samples, err := bus.Read()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(samples))
+
+	// each probe is tried 3 times
+	counts := bus.ErrorCounts()
+	assert.Equal(t, 4, len(counts))
+	assert.Equal(t, DS18B20ErrorCounts{PowerOnReset: 3}, counts["28-000000000085"])
+	assert.Equal(t, DS18B20ErrorCounts{Disconnected: 3}, counts["28-000000000000"])
+	assert.Equal(t, DS18B20ErrorCounts{CRC: 3}, counts["28-0000000000cc"])
+	assert.Equal(t, DS18B20ErrorCounts{NotReady: 3}, counts["28-00000000000a"])
+	assert.Equal(t, uint64(3), counts["28-00000000000a"].Total())
+
+	// a single probe keeps its own count
+	probe := NewDS18B20("bad", "28-000000000085")
+	_, err = probe.Read()
+	assert.Equal(t, ErrDS18B20PowerOnReset, err)
+	assert.Equal(t, uint64(1), probe.ErrorCounts().PowerOnReset)
+}
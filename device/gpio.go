@@ -0,0 +1,310 @@
+package device
+
+// Contains access to GPIO lines through the Linux GPIO character
+// device interface (/dev/gpiochipN)
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ioctls and flags from linux/gpio.h (v1 of the character device ABI)
+const (
+	gpioGetLineHandleIoctl      = 0xc16cb403
+	gpioGetLineEventIoctl       = 0xc030b404
+	gpioHandleGetValuesIoctl    = 0xc040b408
+	gpioHandleSetValuesIoctl    = 0xc040b409
+	gpioHandleRequestInput      = 1 << 0
+	gpioHandleRequestOutput     = 1 << 1
+	gpioEventRequestRisingEdge  = 1 << 0
+	gpioEventRequestFallingEdge = 1 << 1
+	gpioHandlesMax              = 64
+	gpioConsumerLabel           = "brewski"
+	// size of struct gpioevent_data, a u64 timestamp (ns) and u32 event id, padded
+	gpioEventDataSize = 16
+)
+
+// struct gpiohandle_request
+type gpioHandleRequest struct {
+	lineOffsets   [gpioHandlesMax]uint32
+	flags         uint32
+	defaultValues [gpioHandlesMax]uint8
+	consumerLabel [32]byte
+	lines         uint32
+	fd            int32
+}
+
+// struct gpioevent_request
+type gpioEventRequest struct {
+	lineOffset    uint32
+	handleFlags   uint32
+	eventFlags    uint32
+	consumerLabel [32]byte
+	fd            int32
+}
+
+// struct gpiohandle_data
+type gpioHandleData struct {
+	values [gpioHandlesMax]uint8
+}
+
+// GPIOChipPath returns the path of the GPIO character device for a chip number
+func GPIOChipPath(chip int) string {
+	return fmt.Sprintf("/dev/gpiochip%d", chip)
+}
+
+// GPIOLine is a single GPIO line, used either as an input or an output
+type GPIOLine interface {
+	Value() (int, error)
+	SetValue(int) error
+	Close() error
+}
+
+// GPIOChardevLine is a GPIOLine requested from a GPIO character device.
+// The line isn't requested from the kernel until it's first used
+type GPIOChardevLine struct {
+	chip   string
+	offset int
+	output bool
+	fd     int
+	lock   *sync.Mutex
+}
+
+// NewGPIOInput returns an input line on the given GPIO chip (e.g. /dev/gpiochip0)
+func NewGPIOInput(chip string, offset int) *GPIOChardevLine {
+	return newGPIOChardevLine(chip, offset, false)
+}
+
+// NewGPIOOutput returns an output line on the given GPIO chip, initially driven low
+func NewGPIOOutput(chip string, offset int) *GPIOChardevLine {
+	return newGPIOChardevLine(chip, offset, true)
+}
+
+func newGPIOChardevLine(chip string, offset int, output bool) *GPIOChardevLine {
+	return &GPIOChardevLine{
+		chip:   chip,
+		offset: offset,
+		output: output,
+		fd:     -1,
+		lock:   &sync.Mutex{},
+	}
+}
+
+// Value returns the current value of the line, 0 or 1
+func (l *GPIOChardevLine) Value() (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.request(); err != nil {
+		return 0, err
+	}
+	var data gpioHandleData
+	if err := gpioIoctl(uintptr(l.fd), gpioHandleGetValuesIoctl, unsafe.Pointer(&data)); err != nil {
+		return 0, fmt.Errorf("error reading gpio line %d: %s", l.offset, err.Error())
+	}
+	return int(data.values[0]), nil
+}
+
+// SetValue drives an output line high (1) or low (0)
+func (l *GPIOChardevLine) SetValue(value int) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.output {
+		return fmt.Errorf("gpio line %d is not an output", l.offset)
+	}
+	if err := l.request(); err != nil {
+		return err
+	}
+	var data gpioHandleData
+	data.values[0] = uint8(value)
+	if err := gpioIoctl(uintptr(l.fd), gpioHandleSetValuesIoctl, unsafe.Pointer(&data)); err != nil {
+		return fmt.Errorf("error setting gpio line %d: %s", l.offset, err.Error())
+	}
+	return nil
+}
+
+// Close releases the line back to the kernel, if it was requested
+func (l *GPIOChardevLine) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.fd < 0 {
+		return nil
+	}
+	err := syscall.Close(l.fd)
+	l.fd = -1
+	return err
+}
+
+// requests the line from the kernel, if not already done
+func (l *GPIOChardevLine) request() error {
+	if l.fd >= 0 {
+		return nil
+	}
+	chip, err := os.OpenFile(l.chip, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	// the line handle stays valid after the chip is closed
+	defer chip.Close()
+	req := gpioHandleRequest{
+		lines: 1,
+		flags: gpioHandleRequestInput,
+	}
+	if l.output {
+		req.flags = gpioHandleRequestOutput
+	}
+	req.lineOffsets[0] = uint32(l.offset)
+	copy(req.consumerLabel[:], gpioConsumerLabel)
+	if err := gpioIoctl(chip.Fd(), gpioGetLineHandleIoctl, unsafe.Pointer(&req)); err != nil {
+		return fmt.Errorf("error requesting gpio line %d on %s: %s", l.offset, l.chip, err.Error())
+	}
+	l.fd = int(req.fd)
+	return nil
+}
+
+// Edge is which transitions of a GPIO line are counted
+type Edge int
+
+// The edges that can be counted
+const (
+	RisingEdge Edge = iota
+	FallingEdge
+	BothEdges
+)
+
+// ParseEdge returns the Edge with the given name: rising, falling or both
+func ParseEdge(s string) (Edge, error) {
+	switch s {
+	case "rising":
+		return RisingEdge, nil
+	case "falling":
+		return FallingEdge, nil
+	case "both":
+		return BothEdges, nil
+	}
+	return 0, fmt.Errorf("unknown gpio edge '%s', must be rising, falling or both", s)
+}
+
+// PulseSource counts pulses, e.g. edges on a GPIO line
+type PulseSource interface {
+	// Pulses returns the total number of pulses counted so far
+	Pulses() (uint64, error)
+	Close() error
+}
+
+// GPIOEdgeCounter is a PulseSource counting edge events the kernel reports for a
+// GPIO line. The line isn't requested, and counting doesn't start, until the first
+// call to Pulses. Edges closer together than the debounce interval are ignored
+type GPIOEdgeCounter struct {
+	chip     string
+	offset   int
+	edge     Edge
+	debounce time.Duration
+	count    uint64
+	f        *os.File
+	err      error
+	lock     *sync.Mutex
+}
+
+// NewGPIOEdgeCounter returns a counter of edges on a line of the given GPIO chip
+func NewGPIOEdgeCounter(chip string, offset int, edge Edge, debounce time.Duration) *GPIOEdgeCounter {
+	return &GPIOEdgeCounter{
+		chip:     chip,
+		offset:   offset,
+		edge:     edge,
+		debounce: debounce,
+		lock:     &sync.Mutex{},
+	}
+}
+
+// Pulses returns the number of edges counted since counting started
+func (c *GPIOEdgeCounter) Pulses() (uint64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.f == nil {
+		if err := c.request(); err != nil {
+			return 0, err
+		}
+	}
+	return atomic.LoadUint64(&c.count), nil
+}
+
+// Close stops counting and releases the line back to the kernel
+func (c *GPIOEdgeCounter) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+// requests edge events for the line from the kernel, and starts counting them
+func (c *GPIOEdgeCounter) request() error {
+	chip, err := os.OpenFile(c.chip, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	// the event handle stays valid after the chip is closed
+	defer chip.Close()
+	req := gpioEventRequest{
+		lineOffset:  uint32(c.offset),
+		handleFlags: gpioHandleRequestInput,
+	}
+	switch c.edge {
+	case RisingEdge:
+		req.eventFlags = gpioEventRequestRisingEdge
+	case FallingEdge:
+		req.eventFlags = gpioEventRequestFallingEdge
+	case BothEdges:
+		req.eventFlags = gpioEventRequestRisingEdge | gpioEventRequestFallingEdge
+	}
+	copy(req.consumerLabel[:], gpioConsumerLabel)
+	if err := gpioIoctl(chip.Fd(), gpioGetLineEventIoctl, unsafe.Pointer(&req)); err != nil {
+		return fmt.Errorf("error requesting events for gpio line %d on %s: %s", c.offset, c.chip, err.Error())
+	}
+	c.f = os.NewFile(uintptr(req.fd), fmt.Sprintf("%s line %d", c.chip, c.offset))
+	go c.countEvents(c.f)
+	return nil
+}
+
+// reads events from the kernel until the line is closed, counting them
+func (c *GPIOEdgeCounter) countEvents(r io.Reader) {
+	buf := make([]byte, gpioEventDataSize)
+	var last uint64
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			c.lock.Lock()
+			// an error after Close is expected, anything else is reported by Pulses
+			if c.f != nil {
+				c.err = fmt.Errorf("error reading events for gpio line %d: %s", c.offset, err.Error())
+			}
+			c.lock.Unlock()
+			return
+		}
+		ts := binary.LittleEndian.Uint64(buf[0:8])
+		if last != 0 && ts-last < uint64(c.debounce) {
+			continue
+		}
+		last = ts
+		atomic.AddUint64(&c.count, 1)
+	}
+}
+
+func gpioIoctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package device
+
+// Contains a Reader implementation for the temperature sensors the Linux
+// kernel exposes through sysfs: hwmon chips (CPU, I2C sensors like the LM75
+// with a kernel driver, etc) and thermal zones
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/nherson/brewski/measurement"
+)
+
+// SysfsClassDir is the directory where the sysfs device classes (hwmon, thermal)
+// are mounted on the filesystem. Below is a default but it can be changed
+// using the SetSysfsClassDir function
+var SysfsClassDir = "/sys/class"
+
+// SetSysfsClassDir changes a global var indicating where on the OS
+// the sysfs device classes can be found.
+func SetSysfsClassDir(dir string) {
+	SysfsClassDir = dir
+}
+
+// Hwmon reads every hwmon temperature input and thermal zone the kernel
+// exposes. Sensors are discovered on every Read
+type Hwmon struct {
+	name    string
+	include map[string]bool
+}
+
+// hwmonSensor is a single discovered temperature input
+type hwmonSensor struct {
+	source string // hwmon or thermal
+	chip   string
+	label  string
+	path   string
+}
+
+// NewHwmon creates a new reader for kernel temperature sensors. If any sensors are
+// given to include, only those are read. Each one is either a chip name (e.g.
+// 'cpu_thermal'), or a chip name and label (e.g. 'lm75/temp1')
+func NewHwmon(name string, include ...string) *Hwmon {
+	h := &Hwmon{
+		name:    name,
+		include: make(map[string]bool),
+	}
+	for _, i := range include {
+		h.include[i] = true
+	}
+	return h
+}
+
+// Read returns a sample for each temperature sensor found. Sensors that
+// can't be read are skipped, with their errors returned alongside the
+// samples that were read successfully
+func (h *Hwmon) Read() ([]measurement.Sample, error) {
+	sensors, err := discoverHwmonSensors()
+	if err != nil {
+		return nil, err
+	}
+	var errList *multierror.Error
+	samples := []measurement.Sample{}
+	for _, s := range sensors {
+		if !h.included(s) {
+			continue
+		}
+		c, err := readMillicelsius(s.path)
+		if err != nil {
+			errList = multierror.Append(errList, fmt.Errorf("error reading %s/%s: %s", s.chip, s.label, err.Error()))
+			continue
+		}
+		t := time.Now()
+		sample := measurement.NewDeviceSample(h.Name())
+		sample.AddTag("source", s.source)
+		sample.AddTag("chip", s.chip)
+		sample.AddTag("label", s.label)
+		sample.AddUnitDatapoint("celsius", c, measurement.Celsius, t)
+		sample.AddUnitDatapoint("fahrenheit", celsiusToFahrenheit(c), measurement.Fahrenheit, t)
+		samples = append(samples, sample)
+	}
+	return samples, errList.ErrorOrNil()
+}
+
+// Name returns the name of this device
+func (h *Hwmon) Name() string {
+	return h.name
+}
+
+func (h *Hwmon) included(s hwmonSensor) bool {
+	if len(h.include) == 0 {
+		return true
+	}
+	return h.include[s.chip] || h.include[s.chip+"/"+s.label]
+}
+
+// finds all hwmon temperature inputs and thermal zones under SysfsClassDir
+func discoverHwmonSensors() ([]hwmonSensor, error) {
+	sensors := []hwmonSensor{}
+
+	// hwmon chips have a 'name' and any number of tempN_input files,
+	// some of which have a matching tempN_label
+	inputs, err := filepath.Glob(filepath.Join(SysfsClassDir, "hwmon", "hwmon*", "temp*_input"))
+	if err != nil {
+		return nil, err
+	}
+	for _, input := range inputs {
+		dir := filepath.Dir(input)
+		chip := readSysfsString(filepath.Join(dir, "name"), filepath.Base(dir))
+		prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+		label := readSysfsString(filepath.Join(dir, prefix+"_label"), prefix)
+		sensors = append(sensors, hwmonSensor{
+			source: "hwmon",
+			chip:   chip,
+			label:  label,
+			path:   input,
+		})
+	}
+
+	// thermal zones have a 'type' and a single 'temp' file
+	temps, err := filepath.Glob(filepath.Join(SysfsClassDir, "thermal", "thermal_zone*", "temp"))
+	if err != nil {
+		return nil, err
+	}
+	for _, temp := range temps {
+		dir := filepath.Dir(temp)
+		sensors = append(sensors, hwmonSensor{
+			source: "thermal",
+			chip:   readSysfsString(filepath.Join(dir, "type"), filepath.Base(dir)),
+			label:  filepath.Base(dir),
+			path:   temp,
+		})
+	}
+	return sensors, nil
+}
+
+// reads a sysfs file holding a temperature in millicelsius, returning celsius
+func readMillicelsius(path string) (float32, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	raw, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 32)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing temperature: %s", err.Error())
+	}
+	return float32(raw) / 1000, nil
+}
+
+// reads a single line sysfs file, returning the fallback if it can't be read
+func readSysfsString(path, fallback string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fallback
+	}
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		return fallback
+	}
+	return s
+}
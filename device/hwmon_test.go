@@ -0,0 +1,46 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHwmonRead(t *testing.T) {
+	SetSysfsClassDir("../testdata/sysfs/class")
+
+	h := NewHwmon("controller-box")
+	samples, err := h.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(samples))
+
+	found := map[string]float32{}
+	for _, sample := range samples {
+		assert.Equal(t, "controller-box", sample.DeviceName())
+		tags := sample.Tags()
+		found[tags["source"]+":"+tags["chip"]+"/"+tags["label"]] = sample.Datapoints()[0].Value()
+	}
+	assert.Equal(t, map[string]float32{
+		"hwmon:cpu_thermal/temp1":           48.312,
+		"hwmon:lm75/temp1":                  24.5,
+		"hwmon:lm75/ambient":                31,
+		"thermal:cpu-thermal/thermal_zone0": 48.312,
+	}, found)
+}
+
+func TestHwmonInclude(t *testing.T) {
+	SetSysfsClassDir("../testdata/sysfs/class")
+
+	// include a whole chip, and a single labelled input of another
+	h := NewHwmon("controller-box", "cpu-thermal", "lm75/ambient")
+	samples, err := h.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(samples))
+	for _, sample := range samples {
+		assert.Contains(t, []string{"cpu-thermal", "lm75"}, sample.Tags()["chip"])
+		if sample.Tags()["chip"] == "lm75" {
+			assert.Equal(t, "ambient", sample.Tags()["label"])
+			assert.Equal(t, float32(87.8), sample.Datapoints()[1].Value())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package device
+
+// Contains a Reader implementation for an HX711 load cell amplifier,
+// bit-banged over two GPIO lines. Useful for weighing kegs and fermenters
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+const (
+	// how long to wait for the HX711 to have a conversion ready. At its
+	// slowest (10 samples per second) a conversion takes 100ms
+	hx711ReadyTimeout = 500 * time.Millisecond
+	// liters in a US pint
+	litersPerPint = 0.473176473
+)
+
+// number of extra clock pulses after the 24 data bits
+// that select the channel and gain for the next conversion
+var hx711GainPulses = map[int]int{
+	128: 1, // channel A
+	32:  2, // channel B
+	64:  3, // channel A
+}
+
+// HX711Settings holds the settings for converting HX711 readings to a weight
+type HX711Settings struct {
+	// Gain is 128 or 64 for channel A, 32 for channel B. Defaults to 128
+	Gain int
+	// Samples is how many readings to take the median of for each Read.
+	// Defaults to 1
+	Samples int
+	// Tare is the raw reading with nothing on the scale
+	Tare float64
+	// Scale is how much the raw reading changes per kilogram on the scale
+	Scale float64
+	// EmptyWeight is the weight (kg) of the empty keg or fermenter. If set, the
+	// weight of the beer left is reported, in kilograms and pints
+	EmptyWeight float64
+	// Density of the beer in kg/L, used to work out the number of pints
+	// left. Defaults to 1.01
+	Density float64
+}
+
+// Validate returns an error if any of the settings are invalid
+func (s HX711Settings) Validate() error {
+	if _, found := hx711GainPulses[s.Gain]; !found && s.Gain != 0 {
+		return fmt.Errorf("hx711 gain must be 128, 64 or 32, got %d", s.Gain)
+	}
+	if s.Samples < 0 {
+		return fmt.Errorf("hx711 samples cannot be negative")
+	}
+	if s.Scale == 0 {
+		return fmt.Errorf("hx711 scale must be set")
+	}
+	if s.Density < 0 {
+		return fmt.Errorf("hx711 density cannot be negative")
+	}
+	return nil
+}
+
+// HX711 reads a weight from a load cell through an HX711 amplifier
+type HX711 struct {
+	name     string
+	dout     GPIOLine
+	sck      GPIOLine
+	settings HX711Settings
+}
+
+// NewHX711 creates a new HX711 device reading data from the dout line
+// and clocking it out with the sck line. Settings are validated, and
+// defaults filled in for anything left unset
+func NewHX711(name string, dout, sck GPIOLine, settings HX711Settings) (*HX711, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Gain == 0 {
+		settings.Gain = 128
+	}
+	if settings.Samples == 0 {
+		settings.Samples = 1
+	}
+	if settings.Density == 0 {
+		settings.Density = 1.01
+	}
+	return &HX711{
+		name:     name,
+		dout:     dout,
+		sck:      sck,
+		settings: settings,
+	}, nil
+}
+
+// Read takes the median of the configured number of raw readings and returns
+// a sample holding the raw value and the weight in kilograms. If an empty
+// weight is configured, the weight and pints of the beer left are included too
+func (h *HX711) Read() ([]measurement.Sample, error) {
+	readings := make([]float64, 0, h.settings.Samples)
+	for i := 0; i < h.settings.Samples; i++ {
+		raw, err := h.readRaw()
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, float64(raw))
+	}
+	raw := median(readings)
+	kg := (raw - h.settings.Tare) / h.settings.Scale
+
+	t := time.Now()
+	sample := measurement.NewDeviceSample(h.Name())
+	sample.AddDatapoint("raw", float32(raw), t)
+	sample.AddUnitDatapoint("kilograms", float32(kg), measurement.Kilograms, t)
+	if h.settings.EmptyWeight != 0 {
+		beer := kg - h.settings.EmptyWeight
+		if beer < 0 {
+			beer = 0
+		}
+		sample.AddUnitDatapoint("beer-kilograms", float32(beer), measurement.Kilograms, t)
+		sample.AddUnitDatapoint("pints", float32(beer/h.settings.Density/litersPerPint), measurement.Pints, t)
+	}
+	return []measurement.Sample{sample}, nil
+}
+
+// Name returns the name of this device
+func (h *HX711) Name() string {
+	return h.name
+}
+
+// readRaw waits for a conversion to be ready, then clocks out the 24 bit two's
+// complement value, followed by the pulses that pick the gain of the next one.
+// Holding the clock high for over 60us powers the HX711 down, so a badly
+// timed pause (e.g. garbage collection) can spoil a reading, which the
+// median of several samples protects against
+func (h *HX711) readRaw() (int32, error) {
+	// the HX711 pulls dout low when a conversion is ready
+	deadline := time.Now().Add(hx711ReadyTimeout)
+	for {
+		v, err := h.dout.Value()
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("timed out waiting for hx711 to be ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var raw uint32
+	for i := 0; i < 24; i++ {
+		bit, err := h.pulse()
+		if err != nil {
+			return 0, err
+		}
+		raw = raw<<1 | uint32(bit)
+	}
+	for i := 0; i < hx711GainPulses[h.settings.Gain]; i++ {
+		if _, err := h.pulse(); err != nil {
+			return 0, err
+		}
+	}
+	// sign extend from 24 bits
+	return int32(raw<<8) >> 8, nil
+}
+
+// clocks a single pulse on sck, returning the value of dout while sck is high
+func (h *HX711) pulse() (int, error) {
+	if err := h.sck.SetValue(1); err != nil {
+		return 0, err
+	}
+	bit, err := h.dout.Value()
+	if err != nil {
+		return 0, err
+	}
+	if err := h.sck.SetValue(0); err != nil {
+		return 0, err
+	}
+	return bit, nil
+}
+
+// returns the median of the given values, which must not be empty
+func median(values []float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,115 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHX711 simulates the two GPIO lines of an HX711, shifting out
+// a queue of 24 bit readings as the clock line is pulsed
+type fakeHX711 struct {
+	readings []int32
+	gain     int
+	bit      int
+	pulses   int
+	clock    int
+	done     bool
+}
+
+// the dout line
+func (f *fakeHX711) Value() (int, error) {
+	if f.bit == 0 || f.clock == 0 {
+		// ready (low) until the reading has been shifted out
+		return 0, nil
+	}
+	if f.bit > 24 {
+		// gain pulses
+		return 1, nil
+	}
+	raw := uint32(f.readings[0]) & 0xffffff
+	return int(raw>>uint(24-f.bit)) & 1, nil
+}
+
+// the sck line
+func (f *fakeHX711) SetValue(v int) error {
+	if v == 1 && f.clock == 0 {
+		if f.done {
+			// the first pulse of the next reading
+			f.readings = f.readings[1:]
+			f.bit = 0
+			f.done = false
+		}
+		f.bit++
+		f.pulses++
+	}
+	if v == 0 && f.bit == 24+hx711GainPulses[f.gain] {
+		f.done = true
+	}
+	f.clock = v
+	return nil
+}
+
+func (f *fakeHX711) Close() error { return nil }
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, float64(2), median([]float64{3, 1, 2}))
+	assert.Equal(t, float64(2.5), median([]float64{4, 1, 2, 3}))
+	assert.Equal(t, float64(7), median([]float64{7}))
+}
+
+func TestHX711Read(t *testing.T) {
+	f := &fakeHX711{
+		// the outlier is thrown away by the median
+		readings: []int32{120100, 120000, 5000000},
+		gain:     128,
+	}
+	h, err := NewHX711("keg", f, f, HX711Settings{
+		Samples:     3,
+		Tare:        20000,
+		Scale:       5000,
+		EmptyWeight: 4.5,
+	})
+	assert.Nil(t, err)
+	samples, err := h.Read()
+	assert.Nil(t, err)
+	// 24 data bits + 1 gain pulse per reading
+	assert.Equal(t, 75, f.pulses)
+
+	values := map[string]float32{}
+	for _, d := range samples[0].Datapoints() {
+		values[d.Name()] = d.Value()
+	}
+	assert.Equal(t, float32(120100), values["raw"])
+	assert.Equal(t, float32(20.02), values["kilograms"])
+	assert.Equal(t, float32(15.52), values["beer-kilograms"])
+	assert.InDelta(t, 32.47, values["pints"], 0.01)
+}
+
+func TestHX711Negative(t *testing.T) {
+	f := &fakeHX711{
+		readings: []int32{-5000},
+		gain:     64,
+	}
+	h, err := NewHX711("keg", f, f, HX711Settings{
+		Gain:  64,
+		Scale: 1000,
+	})
+	assert.Nil(t, err)
+	samples, err := h.Read()
+	assert.Nil(t, err)
+	// 24 data bits + 3 gain pulses
+	assert.Equal(t, 27, f.pulses)
+	datapoints := samples[0].Datapoints()
+	assert.Equal(t, 2, len(datapoints))
+	assert.Equal(t, float32(-5000), datapoints[0].Value())
+	assert.Equal(t, float32(-5), datapoints[1].Value())
+}
+
+func TestHX711Settings(t *testing.T) {
+	assert.Nil(t, HX711Settings{Scale: 1}.Validate())
+	assert.NotNil(t, HX711Settings{}.Validate())
+	assert.NotNil(t, HX711Settings{Scale: 1, Gain: 100}.Validate())
+	assert.NotNil(t, HX711Settings{Scale: 1, Samples: -1}.Validate())
+	assert.NotNil(t, HX711Settings{Scale: 1, Density: -1}.Validate())
+}
@@ -0,0 +1,118 @@
+package device
+
+// Contains an I2C transport for talking to devices through the
+// Linux i2c-dev interface (/dev/i2c-N)
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ioctl request to set the address of the device on the bus
+// that following reads and writes will talk to, from linux/i2c-dev.h
+const i2cSlaveIoctl = 0x0703
+
+// I2CBus is a connection to a single device on an I2C bus
+type I2CBus interface {
+	// Tx writes w to the device, then reads len(r) bytes back into r.
+	// Either may be empty
+	Tx(w, r []byte) error
+	Close() error
+}
+
+// I2CDev is an I2CBus talking to a device through a Linux i2c-dev
+// character device. The character device isn't opened until it's first used
+type I2CDev struct {
+	path    string
+	address uint16
+	f       *os.File
+	lock    *sync.Mutex
+}
+
+// NewI2CDev returns an I2CBus for the device at the given address
+// on the given i2c-dev character device (e.g. /dev/i2c-1)
+func NewI2CDev(path string, address uint16) *I2CDev {
+	return &I2CDev{
+		path:    path,
+		address: address,
+		lock:    &sync.Mutex{},
+	}
+}
+
+// I2CDevPath returns the path of the i2c-dev character device for a bus number
+func I2CDevPath(bus int) string {
+	return fmt.Sprintf("/dev/i2c-%d", bus)
+}
+
+// Tx writes w to the device, then reads len(r) bytes back into r
+func (d *I2CDev) Tx(w, r []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.open(); err != nil {
+		return err
+	}
+	if len(w) > 0 {
+		if _, err := d.f.Write(w); err != nil {
+			return d.fail(err)
+		}
+	}
+	if len(r) > 0 {
+		if _, err := d.f.Read(r); err != nil {
+			return d.fail(err)
+		}
+	}
+	return nil
+}
+
+// Close closes the character device, if it was opened
+func (d *I2CDev) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.f == nil {
+		return nil
+	}
+	err := d.f.Close()
+	d.f = nil
+	return err
+}
+
+// opens the character device and selects the device address, if not already done
+func (d *I2CDev) open() error {
+	if d.f != nil {
+		return nil
+	}
+	f, err := os.OpenFile(d.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlaveIoctl, uintptr(d.address)); errno != 0 {
+		f.Close()
+		return fmt.Errorf("error selecting i2c address 0x%02x on %s: %s", d.address, d.path, errno.Error())
+	}
+	d.f = f
+	return nil
+}
+
+// closes the character device after an error, so the next Tx starts afresh
+func (d *I2CDev) fail(err error) error {
+	d.f.Close()
+	d.f = nil
+	return fmt.Errorf("i2c error talking to 0x%02x on %s: %s", d.address, d.path, err.Error())
+}
+
+// reads n bytes starting at the given register, for the many
+// devices that auto-increment the register address on reads
+func readI2CRegisters(bus I2CBus, reg byte, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if err := bus.Tx([]byte{reg}, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// writes a single byte value to the given register
+func writeI2CRegister(bus I2CBus, reg, value byte) error {
+	return bus.Tx([]byte{reg, value}, nil)
+}
@@ -0,0 +1,59 @@
+package device
+
+import "fmt"
+
+// fakeRegisterBus is an I2CBus backed by a register fixture, for devices
+// addressed by writing a register number and then reading or writing from it.
+// Reads auto-increment through the registers like most real chips
+type fakeRegisterBus struct {
+	registers [256]byte
+	writes    map[byte][]byte
+}
+
+func newFakeRegisterBus(fixtures map[byte][]byte) *fakeRegisterBus {
+	fb := &fakeRegisterBus{
+		writes: make(map[byte][]byte),
+	}
+	for start, values := range fixtures {
+		copy(fb.registers[start:], values)
+	}
+	return fb
+}
+
+func (fb *fakeRegisterBus) Tx(w, r []byte) error {
+	if len(w) == 0 {
+		return fmt.Errorf("no register given")
+	}
+	reg := w[0]
+	if len(w) > 1 {
+		fb.writes[reg] = append(fb.writes[reg], w[1:]...)
+		copy(fb.registers[reg:], w[1:])
+	}
+	copy(r, fb.registers[reg:])
+	return nil
+}
+
+func (fb *fakeRegisterBus) Close() error { return nil }
+
+// fakeCommandBus is an I2CBus for devices driven by commands rather than registers.
+// Writes are recorded, and reads are answered from a queue of canned responses
+type fakeCommandBus struct {
+	commands  [][]byte
+	responses [][]byte
+}
+
+func (fb *fakeCommandBus) Tx(w, r []byte) error {
+	if len(w) > 0 {
+		fb.commands = append(fb.commands, w)
+	}
+	if len(r) > 0 {
+		if len(fb.responses) == 0 {
+			return fmt.Errorf("no response queued")
+		}
+		copy(r, fb.responses[0])
+		fb.responses = fb.responses[1:]
+	}
+	return nil
+}
+
+func (fb *fakeCommandBus) Close() error { return nil }
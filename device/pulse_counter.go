@@ -0,0 +1,65 @@
+package device
+
+// Contains a Reader implementation counting pulses, from things like an
+// optical airlock bubble counter or a hall effect flow meter
+
+import (
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// PulseCounter reports the number of pulses counted between each Read and the
+// rate they arrived at. If a pulses-per-liter factor is given (for flow meters)
+// the volume that flowed is reported too
+type PulseCounter struct {
+	name           string
+	source         PulseSource
+	pulsesPerLiter float64
+	lastPulses     uint64
+	lastRead       time.Time
+}
+
+// NewPulseCounter creates a new pulse counting device. Set pulsesPerLiter to
+// zero for counters that aren't measuring a flow
+func NewPulseCounter(name string, source PulseSource, pulsesPerLiter float64) *PulseCounter {
+	return &PulseCounter{
+		name:           name,
+		source:         source,
+		pulsesPerLiter: pulsesPerLiter,
+	}
+}
+
+// Read returns the pulses counted since the last Read. The first Read only
+// starts the count, so returns no samples
+func (p *PulseCounter) Read() ([]measurement.Sample, error) {
+	pulses, err := p.source.Pulses()
+	if err != nil {
+		return nil, err
+	}
+	t := time.Now()
+	if p.lastRead.IsZero() {
+		p.lastPulses = pulses
+		p.lastRead = t
+		return []measurement.Sample{}, nil
+	}
+	count := float64(pulses - p.lastPulses)
+	minutes := t.Sub(p.lastRead).Minutes()
+	p.lastPulses = pulses
+	p.lastRead = t
+
+	sample := measurement.NewDeviceSample(p.Name())
+	sample.AddDatapoint("pulses", float32(count), t)
+	sample.AddDatapoint("pulses-per-minute", float32(count/minutes), t)
+	if p.pulsesPerLiter > 0 {
+		liters := count / p.pulsesPerLiter
+		sample.AddUnitDatapoint("liters", float32(liters), measurement.Liters, t)
+		sample.AddUnitDatapoint("liters-per-minute", float32(liters/minutes), measurement.LitersPerMinute, t)
+	}
+	return []measurement.Sample{sample}, nil
+}
+
+// Name returns the name of this device
+func (p *PulseCounter) Name() string {
+	return p.name
+}
@@ -0,0 +1,84 @@
+package device
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPulseSource struct {
+	pulses uint64
+}
+
+func (m *mockPulseSource) Pulses() (uint64, error) { return m.pulses, nil }
+func (m *mockPulseSource) Close() error            { return nil }
+
+func TestPulseCounter(t *testing.T) {
+	source := &mockPulseSource{pulses: 100}
+	p := NewPulseCounter("flow-meter", source, 450)
+
+	// the first read just starts counting
+	samples, err := p.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+
+	// pretend the last read was a minute ago
+	p.lastRead = p.lastRead.Add(-time.Minute)
+	source.pulses = 1000
+	samples, err = p.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+	datapoints := samples[0].Datapoints()
+	assert.Equal(t, 4, len(datapoints))
+	assert.Equal(t, "pulses", datapoints[0].Name())
+	assert.Equal(t, float32(900), datapoints[0].Value())
+	assert.Equal(t, "pulses-per-minute", datapoints[1].Name())
+	assert.InDelta(t, 900, datapoints[1].Value(), 1)
+	assert.Equal(t, "liters", datapoints[2].Name())
+	assert.Equal(t, float32(2), datapoints[2].Value())
+	assert.Equal(t, "liters-per-minute", datapoints[3].Name())
+	assert.InDelta(t, 2, datapoints[3].Value(), 0.01)
+	assert.Equal(t, measurement.LitersPerMinute, datapoints[3].Unit())
+}
+
+func TestPulseCounterNoFlow(t *testing.T) {
+	source := &mockPulseSource{}
+	p := NewPulseCounter("airlock", source, 0)
+	p.Read()
+	source.pulses = 3
+	samples, err := p.Read()
+	assert.Nil(t, err)
+	// bubble counters have no volume
+	assert.Equal(t, 2, len(samples[0].Datapoints()))
+}
+
+func TestParseEdge(t *testing.T) {
+	e, err := ParseEdge("falling")
+	assert.Nil(t, err)
+	assert.Equal(t, FallingEdge, e)
+	_, err = ParseEdge("sideways")
+	assert.NotNil(t, err)
+}
+
+// builds a stream of kernel gpio events with the given timestamps (ns)
+func gpioEvents(timestamps ...uint64) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, ts := range timestamps {
+		binary.Write(&buf, binary.LittleEndian, ts)
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, uint32(0)) // padding
+	}
+	return &buf
+}
+
+func TestGPIOEdgeCounterDebounce(t *testing.T) {
+	c := NewGPIOEdgeCounter("/dev/gpiochip0", 17, RisingEdge, 5*time.Millisecond)
+	ms := uint64(time.Millisecond)
+	// the bounces 1ms after the first and third edges are ignored
+	c.countEvents(gpioEvents(100*ms, 101*ms, 200*ms, 300*ms, 301*ms, 310*ms))
+	assert.Equal(t, uint64(4), c.count)
+}
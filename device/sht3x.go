@@ -0,0 +1,89 @@
+package device
+
+// Contains a Reader implementation for the Sensirion SHT3x (SHT30/SHT31/SHT35)
+// temperature and humidity sensors, connected over I2C
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// SHT3xDefaultAddress is the I2C address of an SHT3x with ADDR pulled low.
+// With ADDR pulled high it is 0x45
+const SHT3xDefaultAddress = 0x44
+
+const (
+	// single shot measurement, high repeatability, no clock stretching
+	sht3xCmdMeasureMSB = 0x24
+	sht3xCmdMeasureLSB = 0x00
+	// a high repeatability measurement takes at most 15ms
+	sht3xMeasurementTime = 15 * time.Millisecond
+)
+
+// SHT3x reads temperature and humidity from an SHT3x sensor
+type SHT3x struct {
+	name string
+	bus  I2CBus
+}
+
+// NewSHT3x creates a new SHT3x device talking over the given I2C bus
+func NewSHT3x(name string, bus I2CBus) *SHT3x {
+	return &SHT3x{
+		name: name,
+		bus:  bus,
+	}
+}
+
+// Read triggers a single measurement and returns a sample
+// holding the temperature and relative humidity
+func (s *SHT3x) Read() ([]measurement.Sample, error) {
+	if err := s.bus.Tx([]byte{sht3xCmdMeasureMSB, sht3xCmdMeasureLSB}, nil); err != nil {
+		return nil, err
+	}
+	time.Sleep(sht3xMeasurementTime)
+	// temperature and humidity words, each followed by their CRC
+	raw := make([]byte, 6)
+	if err := s.bus.Tx(nil, raw); err != nil {
+		return nil, err
+	}
+	if sensirionCRC8(raw[0:2]) != raw[2] || sensirionCRC8(raw[3:5]) != raw[5] {
+		return nil, fmt.Errorf("crc mismatch in sht3x measurement")
+	}
+	rawT := float32(uint16(raw[0])<<8 | uint16(raw[1]))
+	rawH := float32(uint16(raw[3])<<8 | uint16(raw[4]))
+
+	// conversion formulas from section 4.13 of the datasheet
+	c := -45 + 175*rawT/65535
+	h := 100 * rawH / 65535
+
+	t := time.Now()
+	sample := measurement.NewDeviceSample(s.Name())
+	sample.AddUnitDatapoint("celsius", c, measurement.Celsius, t)
+	sample.AddUnitDatapoint("fahrenheit", celsiusToFahrenheit(c), measurement.Fahrenheit, t)
+	sample.AddUnitDatapoint("humidity", h, measurement.Percent, t)
+	return []measurement.Sample{sample}, nil
+}
+
+// Name returns the name of this device
+func (s *SHT3x) Name() string {
+	return s.name
+}
+
+// sensirionCRC8 computes the CRC used by Sensirion sensors
+// (polynomial x^8 + x^5 + x^4 + 1, initialized to 0xff)
+func sensirionCRC8(data []byte) byte {
+	crc := byte(0xff)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,38 @@
+package device
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSensirionCRC8(t *testing.T) {
+	// example from the datasheet
+	assert.Equal(t, byte(0x92), sensirionCRC8([]byte{0xbe, 0xef}))
+}
+
+func TestSHT3xRead(t *testing.T) {
+	bus := &fakeCommandBus{
+		responses: [][]byte{{0x60, 0x8c, 0xd3, 0x8c, 0xcc, 0x2c}},
+	}
+	s := NewSHT3x("chamber", bus)
+	samples, err := s.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, [][]byte{{0x24, 0x00}}, bus.commands)
+
+	datapoints := samples[0].Datapoints()
+	assert.Equal(t, "celsius", datapoints[0].Name())
+	assert.InDelta(t, 21.0, datapoints[0].Value(), 0.01)
+	assert.Equal(t, "humidity", datapoints[2].Name())
+	assert.InDelta(t, 55.0, datapoints[2].Value(), 0.01)
+}
+
+func TestSHT3xBadCRC(t *testing.T) {
+	bus := &fakeCommandBus{
+		responses: [][]byte{{0x60, 0x8c, 0xd4, 0x8c, 0xcc, 0x2c}},
+	}
+	s := NewSHT3x("chamber", bus)
+	_, err := s.Read()
+	assert.NotNil(t, err)
+}
@@ -2,16 +2,13 @@ package device
 
 import (
 	"bytes"
-	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-ble/ble"
-	"github.com/go-ble/ble/examples/lib/dev"
 
 	"github.com/nherson/brewski/measurement"
 )
@@ -29,21 +26,80 @@ var colorUUIDMap = map[string]string{
 	"A495BB80C5B14B44B5121370F02D74DE": "pink",
 }
 
+// TiltDecoderName is the name the Tilt Hydrometer advertisement decoder is registered under
+const TiltDecoderName = "tilt"
+
+func init() {
+	RegisterBLEDecoder(tiltDecoder{})
+}
+
+// Tilt Pros report gravity as SG*10000 rather than SG*1000. No classic Tilt
+// will ever report a raw gravity anywhere near this, so it is used to tell them apart
+const tiltProGravityThreshold = 5000
+
+// tiltDecoder decodes Tilt Hydrometer advertisements (iBeacons), identifying each
+// Tilt by its color. Temperature is in fahrenheit, and gravity is specific gravity.
+// The signal strength (rssi) and the iBeacon tx-power byte, which Tilts use to
+// report the age of their battery in weeks, are reported as well
+type tiltDecoder struct{}
+
+func (tiltDecoder) Name() string {
+	return TiltDecoderName
+}
+
+func (tiltDecoder) Decode(a ble.Advertisement) (*BLEReading, bool) {
+	color, isTilt := isTiltHydrometer(a)
+	if !isTilt {
+		return nil, false
+	}
+	temp, gravity := parseTiltData(a)
+	return &BLEReading{
+		ID:   color,
+		Tags: measurement.Tags{"color": color},
+		Values: []BLEValue{
+			{Name: "temperature", Value: temp},
+			{Name: "gravity", Value: gravity},
+			{Name: "rssi", Value: float32(a.RSSI())},
+			{Name: "tx-power", Value: float32(parseTiltTxPower(a))},
+		},
+	}, true
+}
+
+// IsTiltColor returns whether the given color is one that Tilt Hydrometers come in
+func IsTiltColor(color string) bool {
+	for _, c := range colorUUIDMap {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
+
+// TiltColorSettings overrides how a single color of tilt is reported.
+// The alias (usually the batch or fermenter) is added to the color's samples
+// as the 'alias' tag, and the calibrations replace the device wide offsets
+type TiltColorSettings struct {
+	Alias                  string
+	TemperatureCalibration Calibration
+	GravityCalibration     Calibration
+}
+
 // TiltHydrometer tracks hydrometer and temperature data from
 // Tilt Hydometers.  This single device instance will track every
-// device color
+// device color, unless specific colors have been set with SetColors
 type TiltHydrometer struct {
 	name               string
 	bluetooth          BluetoothScanner
 	data               recentData
 	tempCalibration    float32
 	gravityCalibration float32
+	colors             map[string]TiltColorSettings
 }
 
 // NewTiltHydrometer returns a new device capable of reading from a Tilt Hydrometer
 func NewTiltHydrometer(name string, gravityCalibration, tempCalibration float32) (*TiltHydrometer, error) {
 	// This will immediately start scanning and holding on to discovered advertisements
-	b, err := newBluetoothScanner()
+	b, err := NewBluetoothScanner()
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +112,32 @@ func NewTiltHydrometer(name string, gravityCalibration, tempCalibration float32)
 	}, nil
 }
 
+// SetColors limits the tilts read to the given colors, and applies each
+// color's settings to its samples. A nil or empty map reads every color
+// using the device wide calibration
+func (th *TiltHydrometer) SetColors(colors map[string]TiltColorSettings) error {
+	for color := range colors {
+		if !IsTiltColor(color) {
+			return fmt.Errorf("unknown tilt color '%s'", color)
+		}
+	}
+	th.colors = colors
+	return nil
+}
+
+// settings returns the settings to use for the given color, and whether
+// the color should be read at all
+func (th *TiltHydrometer) settings(color string) (TiltColorSettings, bool) {
+	if len(th.colors) == 0 {
+		return TiltColorSettings{
+			TemperatureCalibration: OffsetCalibration(th.tempCalibration),
+			GravityCalibration:     OffsetCalibration(th.gravityCalibration),
+		}, true
+	}
+	settings, found := th.colors[color]
+	return settings, found
+}
+
 type recentData map[string]*averagedData
 
 func newRecentData() recentData {
@@ -76,6 +158,7 @@ func newRecentData() recentData {
 func (rd recentData) clearRecentData() {
 	for _, avgData := range rd {
 		avgData.count = 0
+		avgData.signalCount = 0
 	}
 }
 
@@ -84,6 +167,9 @@ type averagedData struct {
 	temperature float32
 	count       int
 	seen        bool
+	rssi        float32
+	txPower     float32
+	signalCount int
 }
 
 // function to incorporate a new data point into this tilt's recent data set, using an averaging method
@@ -100,9 +186,18 @@ func (ad *averagedData) addData(gravity, temperature float32) {
 	}
 }
 
+// addSignal averages the signal strength and tx-power of a new advertisement into
+// this tilt's recent data set, separately from the readings themselves
+func (ad *averagedData) addSignal(rssi, txPower float32) {
+	ad.rssi = (ad.rssi*float32(ad.signalCount) + rssi) / float32(ad.signalCount+1)
+	ad.txPower = (ad.txPower*float32(ad.signalCount) + txPower) / float32(ad.signalCount+1)
+	ad.signalCount++
+}
+
 // Read reads any data that has been advertised by the tilt since last Read()
 // and returns that. If no advertisements have been made by any tilt devices since
-// last call to Read, this will return an empty sample with no Datapoints
+// last call to Read, this will return an empty sample with no Datapoints.
+// A sample reporting the health of the bluetooth scanner is included too
 func (th *TiltHydrometer) Read() ([]measurement.Sample, error) {
 	t := time.Now()
 	advertisements := th.bluetooth.GetAdvertisements()
@@ -112,14 +207,16 @@ func (th *TiltHydrometer) Read() ([]measurement.Sample, error) {
 	// If we have received multiple advertisements for the same device
 	// since the last Read(), the datapoints will be averaged together
 	for _, a := range advertisements {
-		var color string
-		var isTilt bool
-		if color, isTilt = isTiltHydrometer(a); !isTilt {
+		reading, isTilt := tiltDecoder{}.Decode(a)
+		if !isTilt {
 			continue
 		}
-		// parse out values for temp and gravity
-		temp, gravity := parseTiltData(a)
-		th.data[color].addData(gravity, temp)
+		temp, _ := reading.Value("temperature")
+		gravity, _ := reading.Value("gravity")
+		rssi, _ := reading.Value("rssi")
+		txPower, _ := reading.Value("tx-power")
+		th.data[reading.ID].addData(gravity, temp)
+		th.data[reading.ID].addSignal(rssi, txPower)
 	}
 	// Collect all the tilt data gathered and report it into the sample to return
 	for color, data := range th.data {
@@ -127,25 +224,55 @@ func (th *TiltHydrometer) Read() ([]measurement.Sample, error) {
 		if !data.seen {
 			continue
 		}
-		sample := measurement.NewDeviceSample("tilt")
+		// nor any that aren't ours
+		settings, read := th.settings(color)
+		if !read {
+			continue
+		}
+		sample := measurement.NewDeviceSample(th.name)
 		sample.AddTag("color", color)
-		sample.AddDatapoint("temperature", data.temperature+th.tempCalibration, t)
-		sample.AddDatapoint("gravity", data.gravity+th.gravityCalibration, t)
+		if settings.Alias != "" {
+			sample.AddTag("alias", settings.Alias)
+		}
+		sample.AddUnitDatapoint("temperature", settings.TemperatureCalibration.Apply(data.temperature), measurement.Fahrenheit, t)
+		sample.AddUnitDatapoint("gravity", settings.GravityCalibration.Apply(data.gravity), measurement.SpecificGravity, t)
+		sample.AddDatapoint("rssi", data.rssi, t)
+		sample.AddDatapoint("tx-power", data.txPower, t)
 		samples = append(samples, sample)
 	}
 	// Clear the recent data counts to prepare for the next read window
 	th.data.clearRecentData()
-	return samples, nil
+	// Report how well the bluetooth adapter is scanning
+	health, err := bluetoothHealthSample(th.name, th.bluetooth, t)
+	if health != nil {
+		samples = append(samples, health)
+	}
+	return samples, err
 }
 
+// parseTiltData returns the temperature (fahrenheit) and specific gravity from
+// a tilt advertisement. Tilt Pros send both values with an extra decimal place
 func parseTiltData(a ble.Advertisement) (float32, float32) {
 	md := a.ManufacturerData()
 	tempBytes := md[20:22]
 	gravityBytes := md[22:24]
-	temp := float32(binary.BigEndian.Uint16(tempBytes))
-	gravity := float32(binary.BigEndian.Uint16(gravityBytes)) / 1000
-	return temp, gravity
+	rawTemp := binary.BigEndian.Uint16(tempBytes)
+	rawGravity := binary.BigEndian.Uint16(gravityBytes)
+	if isTiltPro(rawGravity) {
+		return float32(rawTemp) / 10, float32(rawGravity) / 10000
+	}
+	return float32(rawTemp), float32(rawGravity) / 1000
+}
+
+func isTiltPro(rawGravity uint16) bool {
+	return rawGravity > tiltProGravityThreshold
+}
 
+// parseTiltTxPower returns the iBeacon tx-power byte of a tilt advertisement. In a
+// real iBeacon it is a signed power in dBm, but Tilts send the number of weeks since
+// their battery was changed in it instead, which is unsigned
+func parseTiltTxPower(a ble.Advertisement) uint8 {
+	return a.ManufacturerData()[24]
 }
 
 // determines if the bluetooth advertisement belongs to a tilt hydrometer
@@ -179,61 +306,3 @@ func isTiltHydrometer(a ble.Advertisement) (string, bool) {
 func (th *TiltHydrometer) Name() string {
 	return th.name
 }
-
-// BluetoothScanner is an interface to read data from a Bluetooth LE device
-type BluetoothScanner interface {
-	GetAdvertisements() []ble.Advertisement
-}
-
-type bluetoothScanner struct {
-	advertisements []ble.Advertisement
-	lock           *sync.Mutex
-}
-
-func newBluetoothScanner() (*bluetoothScanner, error) {
-	// Setup bluetooth scanning device
-	d, err := dev.NewDevice("default")
-	if err != nil {
-		return nil, err
-	}
-	ble.SetDefaultDevice(d)
-	// Scan for devices with no timeout
-	bs := &bluetoothScanner{
-		lock:           &sync.Mutex{},
-		advertisements: []ble.Advertisement{},
-	}
-	// the bluetoothScanner will blindly start gobbling up discovered advertisements
-	// and cache them away for consumption by callers of GetAdvertisements
-	go func() {
-		for {
-			// Just keep doing short term scans
-			// Use a refreshing scan with a timeout in an infinite loop because there are issues
-			// with long running calls to Scan() no longer seeing data
-			ctx := ble.WithSigHandler(context.WithTimeout(context.Background(), 1*time.Minute))
-			ble.Scan(ctx, true, bs.advHandler, nil)
-		}
-	}()
-	return bs, nil
-}
-
-func (bs *bluetoothScanner) GetAdvertisements() []ble.Advertisement {
-	bs.lock.Lock()
-	defer bs.lock.Unlock()
-	// make the array to return
-	toReturn := make([]ble.Advertisement, len(bs.advertisements))
-	copy(toReturn, bs.advertisements)
-	bs.advertisements = []ble.Advertisement{}
-	return toReturn
-}
-
-// this will be a noop since we can handle all this logic
-func (bs *bluetoothScanner) advHandler(a ble.Advertisement) {
-	// First, verify that this could possibly be a Tilt
-	// By ensuring that the message payload is 25 bytes (iBeacon), and
-	// the manufacturer data preamble is the right hex string (0x4c000215)
-
-	// Add the advertisement to the pool
-	bs.lock.Lock()
-	bs.advertisements = append(bs.advertisements, a)
-	bs.lock.Unlock()
-}
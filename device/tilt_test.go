@@ -104,7 +104,7 @@ func (ma *mockAdvertisement) OverflowService() []ble.UUID    { return nil }
 func (ma *mockAdvertisement) TxPowerLevel() int              { return 0 }
 func (ma *mockAdvertisement) Connectable() bool              { return false }
 func (ma *mockAdvertisement) SolicitedService() []ble.UUID   { return nil }
-func (ma *mockAdvertisement) RSSI() int                      { return 0 }
+func (ma *mockAdvertisement) RSSI() int                      { return -70 }
 func (ma *mockAdvertisement) Addr() ble.Addr                 { return nil }
 
 func TestCalibration(t *testing.T) {
@@ -125,9 +125,87 @@ func TestCalibration(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(samples))
 	datapoints := samples[0].Datapoints()
-	assert.Equal(t, 2, len(datapoints))
+	assert.Equal(t, 4, len(datapoints))
 	// temp calibrated down 2 points
 	assert.Equal(t, float32(65), datapoints[0].Value())
 	assert.Equal(t, float32(1.043), datapoints[1].Value())
+	// signal data is never calibrated, and the tx-power byte is unsigned battery weeks
+	assert.Equal(t, float32(-70), datapoints[2].Value())
+	assert.Equal(t, float32(199), datapoints[3].Value())
 
 }
+
+func TestTiltPro(t *testing.T) {
+	mb := &mockBluetooth{
+		gravityToReturn: uint16(10452),
+		tempToReturn:    uint16(503),
+	}
+
+	tilt := &TiltHydrometer{
+		name:      "test-tilt",
+		bluetooth: mb,
+		data:      newRecentData(),
+	}
+
+	samples, err := tilt.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+	datapoints := samples[0].Datapoints()
+	assert.Equal(t, float32(50.3), datapoints[0].Value())
+	assert.Equal(t, float32(1.0452), datapoints[1].Value())
+}
+
+func TestAverageSignal(t *testing.T) {
+	ad := &averagedData{}
+	ad.addSignal(float32(-70), float32(12))
+	ad.addSignal(float32(-80), float32(12))
+	assert.Equal(t, float32(-75), ad.rssi)
+	assert.Equal(t, float32(12), ad.txPower)
+	assert.Equal(t, 2, ad.signalCount)
+	assert.Equal(t, 0, ad.count)
+}
+
+func TestTiltColors(t *testing.T) {
+	mb := &mockBluetooth{
+		gravityToReturn: uint16(1040),
+		tempToReturn:    uint16(67),
+	}
+
+	tilt := &TiltHydrometer{
+		name:               "fermenters",
+		bluetooth:          mb,
+		data:               newRecentData(),
+		gravityCalibration: 0.003,
+		tempCalibration:    -2,
+	}
+
+	err := tilt.SetColors(map[string]TiltColorSettings{
+		"chartreuse": {},
+	})
+	assert.NotNil(t, err)
+
+	// the neighbor's red tilt is ignored
+	err = tilt.SetColors(map[string]TiltColorSettings{
+		"blue": {Alias: "stout"},
+	})
+	assert.Nil(t, err)
+	samples, err := tilt.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+
+	err = tilt.SetColors(map[string]TiltColorSettings{
+		"blue": {Alias: "stout"},
+		"red":  {Alias: "lager", GravityCalibration: OffsetCalibration(-0.002)},
+	})
+	assert.Nil(t, err)
+	samples, err = tilt.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, "fermenters", samples[0].DeviceName())
+	assert.Equal(t, "red", samples[0].Tags()["color"])
+	assert.Equal(t, "lager", samples[0].Tags()["alias"])
+	datapoints := samples[0].Datapoints()
+	// the color's calibration replaces the device's
+	assert.Equal(t, float32(67), datapoints[0].Value())
+	assert.Equal(t, float32(1.038), datapoints[1].Value())
+}
@@ -0,0 +1,68 @@
+package device
+
+// Contains a virtual device computing datapoints from other devices' readings
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/nherson/brewski/state"
+)
+
+// Virtual is a device whose datapoints are computed from expressions over the
+// latest values read from other devices, like the difference between the
+// temperatures of a fermenter and the room it's in
+type Virtual struct {
+	name        string
+	values      state.Values
+	expressions map[string]*state.Expression
+	names       []string // datapoint names, sorted
+	maxAge      time.Duration
+}
+
+// NewVirtual returns a virtual device computing each named datapoint from its
+// expression, over the latest values. Values older than maxAge (unless 0) are
+// considered stale, and datapoints needing them aren't computed
+func NewVirtual(name string, values state.Values, expressions map[string]*state.Expression, maxAge time.Duration) *Virtual {
+	names := []string{}
+	for n := range expressions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return &Virtual{
+		name:        name,
+		values:      values,
+		expressions: expressions,
+		names:       names,
+		maxAge:      maxAge,
+	}
+}
+
+// Read computes the datapoints. Datapoints that can't be computed (e.g. a device
+// hasn't been read yet) are left out, and an error returned for them
+func (v *Virtual) Read() ([]measurement.Sample, error) {
+	var errList *multierror.Error
+	t := time.Now()
+	sample := measurement.NewDeviceSample(v.Name())
+	for _, name := range v.names {
+		value, _, err := v.expressions[name].Evaluate(v.values, t, v.maxAge)
+		if err != nil {
+			errList = multierror.Append(errList, fmt.Errorf("error computing '%s': %s", name, err.Error()))
+			continue
+		}
+		sample.AddDatapoint(name, float32(value), t)
+	}
+	if len(sample.Datapoints()) == 0 {
+		return nil, errList.ErrorOrNil()
+	}
+	return []measurement.Sample{sample}, errList.ErrorOrNil()
+}
+
+// Name returns the name of this device
+func (v *Virtual) Name() string {
+	return v.name
+}
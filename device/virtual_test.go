@@ -0,0 +1,56 @@
+package device
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/nherson/brewski/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtual(t *testing.T) {
+	store := state.NewStore()
+	delta, err := state.ParseExpression("fermenter.celsius - ambient.celsius")
+	assert.Nil(t, err)
+	gravityPoints, err := state.ParseExpression("(tilts[color=red].gravity - 1) * 1000")
+	assert.Nil(t, err)
+	v := NewVirtual("derived", store, map[string]*state.Expression{
+		"fermenter-delta": delta,
+		"gravity-points":  gravityPoints,
+	}, time.Minute)
+	assert.Equal(t, "derived", v.Name())
+
+	// nothing read yet
+	samples, err := v.Read()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(samples))
+
+	for device, celsius := range map[string]float32{"fermenter": 19, "ambient": 22.5} {
+		s := measurement.NewDeviceSample(device)
+		s.AddDatapoint("celsius", celsius, time.Now())
+		assert.Nil(t, store.Handle(s))
+	}
+	// the tilt's reading is stale, so only the delta is computed
+	s := measurement.NewDeviceSample("tilts")
+	s.AddTag("color", "red")
+	s.AddDatapoint("gravity", 1.050, time.Now().Add(-time.Hour))
+	assert.Nil(t, store.Handle(s))
+	samples, err = v.Read()
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, len(samples))
+	assert.Equal(t, "derived", samples[0].DeviceName())
+	assert.Equal(t, 1, len(samples[0].Datapoints()))
+	assert.Equal(t, "fermenter-delta", samples[0].Datapoints()[0].Name())
+	assert.Equal(t, float32(-3.5), samples[0].Datapoints()[0].Value())
+
+	s = measurement.NewDeviceSample("tilts")
+	s.AddTag("color", "red")
+	s.AddDatapoint("gravity", 1.050, time.Now())
+	assert.Nil(t, store.Handle(s))
+	samples, err = v.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(samples[0].Datapoints()))
+	assert.Equal(t, "gravity-points", samples[0].Datapoints()[1].Name())
+	assert.InDelta(t, 50, samples[0].Datapoints()[1].Value(), 1e-3)
+}
@@ -3,25 +3,28 @@ package measurement
 import "time"
 
 // Datapoint holds a discrete datapoint with a single label
-// indicating what the value represents.  To be used embedded
-// in Sample
+// indicating what the value represents, and the unit it is
+// measured in.  To be used embedded in Sample
 type Datapoint interface {
 	Name() string
 	Value() float32
+	Unit() Unit
 	Time() time.Time
 }
 
 type datapoint struct {
 	name  string
 	value float32
+	unit  Unit
 	time  time.Time
 }
 
 // NewDatapoint returns a datapoint for the given data
-func newDatapoint(n string, v float32, t time.Time) *datapoint {
+func newDatapoint(n string, v float32, u Unit, t time.Time) *datapoint {
 	return &datapoint{
 		name:  n,
 		value: v,
+		unit:  u,
 		time:  t,
 	}
 }
@@ -34,6 +37,10 @@ func (d *datapoint) Value() float32 {
 	return d.value
 }
 
+func (d *datapoint) Unit() Unit {
+	return d.unit
+}
+
 func (d *datapoint) Time() time.Time {
 	return d.time
 }
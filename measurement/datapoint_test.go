@@ -12,9 +12,10 @@ func TestDatapoint(t *testing.T) {
 	assert.Nil(t, nil)
 
 	ts := time.Now()
-	d := newDatapoint("fieldName", 1.234, ts)
+	d := newDatapoint("fieldName", 1.234, Celsius, ts)
 
 	assert.Equal(t, "fieldName", d.Name())
 	assert.Equal(t, float32(1.234), d.Value())
+	assert.Equal(t, Celsius, d.Unit())
 	assert.Equal(t, ts, d.Time())
 }
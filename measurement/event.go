@@ -0,0 +1,27 @@
+package measurement
+
+import "time"
+
+// EventTag is the tag marking a sample as an event, like a fermentation
+// finishing, rather than a reading. Its value is the name of the event
+const EventTag = "event"
+
+// NewEvent returns an event sample for the series of the given sample: the same
+// device and tags, tagged with the event name and holding an 'event' datapoint of 1
+// (so outputs that need a value have one). More datapoints describing the event
+// can be added to it
+func NewEvent(s Sample, name string, t time.Time) *DeviceSample {
+	e := NewDeviceSample(s.DeviceName())
+	for k, v := range s.Tags() {
+		e.AddTag(k, v)
+	}
+	e.AddTag(EventTag, name)
+	e.AddDatapoint(EventTag, 1, t)
+	return e
+}
+
+// EventName returns the name of the event if the sample is one
+func EventName(s Sample) (string, bool) {
+	name, found := s.Tags()[EventTag]
+	return name, found
+}
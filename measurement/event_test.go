@@ -0,0 +1,28 @@
+package measurement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvent(t *testing.T) {
+	now := time.Now()
+	s := NewDeviceSample("fermenter")
+	s.AddTag("color", "red")
+	s.AddDatapoint("gravity", 1.010, now)
+	_, isEvent := EventName(s)
+	assert.False(t, isEvent)
+
+	e := NewEvent(s, "fermentation-complete", now)
+	e.AddDatapoint("gravity", 1.010, now)
+	name, isEvent := EventName(e)
+	assert.True(t, isEvent)
+	assert.Equal(t, "fermentation-complete", name)
+	assert.Equal(t, "fermenter", e.DeviceName())
+	assert.Equal(t, Tags{"color": "red", EventTag: "fermentation-complete"}, e.Tags())
+	assert.Equal(t, 2, len(e.Datapoints()))
+	// the original sample is untouched
+	assert.Equal(t, Tags{"color": "red"}, s.Tags())
+}
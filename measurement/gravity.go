@@ -0,0 +1,58 @@
+package measurement
+
+// Contains conversions between the units gravity is measured in, the brewing
+// metrics derived from the original and current gravity of a beer, and the
+// correction of gravity readings for the temperature of the sample
+
+// SGToPlato converts specific gravity to degrees Plato
+func SGToPlato(sg float64) float64 {
+	return -616.868 + 1111.14*sg - 630.272*sg*sg + 135.997*sg*sg*sg
+}
+
+// PlatoToSG converts degrees Plato to specific gravity
+func PlatoToSG(plato float64) float64 {
+	return 1 + plato/(258.6-(plato/258.2)*227.1)
+}
+
+// SGToBrix converts specific gravity to degrees Brix
+func SGToBrix(sg float64) float64 {
+	return ((182.4601*sg-775.6821)*sg+1262.7794)*sg - 669.5622
+}
+
+// ApparentAttenuation returns the percentage of the original gravity points
+// that have been fermented out, going by the current (apparent) gravity
+func ApparentAttenuation(og, sg float64) float64 {
+	if og <= 1 {
+		return 0
+	}
+	return 100 * (og - sg) / (og - 1)
+}
+
+// RealAttenuation returns the percentage of the original extract that has been
+// fermented, correcting the apparent extract for the alcohol in the beer
+func RealAttenuation(og, sg float64) float64 {
+	originalExtract := SGToPlato(og)
+	if originalExtract <= 0 {
+		return 0
+	}
+	realExtract := 0.1808*originalExtract + 0.8192*SGToPlato(sg)
+	return 100 * (originalExtract - realExtract) / originalExtract
+}
+
+// ABV returns the alcohol by volume (percent) of a beer fermented from
+// the original gravity down to the current gravity
+func ABV(og, sg float64) float64 {
+	return (og - sg) * 131.25
+}
+
+// CorrectGravity corrects a gravity reading taken at a temperature (°F) to the
+// gravity at the temperature the hydrometer is calibrated for (°F, usually 60 or
+// 68), going by the change in the density of water with temperature
+func CorrectGravity(sg, fahrenheit, calibrationFahrenheit float64) float64 {
+	return sg * waterDensity(fahrenheit) / waterDensity(calibrationFahrenheit)
+}
+
+// waterDensity approximates the relative density of water at a temperature (°F)
+func waterDensity(f float64) float64 {
+	return 1.00130346 - 0.000134722124*f + 0.00000204052596*f*f - 0.00000000232820948*f*f*f
+}
@@ -0,0 +1,30 @@
+package measurement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGravityConversions(t *testing.T) {
+	assert.InDelta(t, 0, SGToPlato(1.000), 0.01)
+	assert.InDelta(t, 12.4, SGToPlato(1.050), 0.05)
+	assert.InDelta(t, 1.050, PlatoToSG(12.4), 0.0005)
+	assert.InDelta(t, 12.4, SGToBrix(1.050), 0.1)
+	assert.InDelta(t, 20, SGToBrix(1.083), 0.1)
+}
+
+func TestBrewingMetrics(t *testing.T) {
+	assert.InDelta(t, 80, ApparentAttenuation(1.050, 1.010), 0.001)
+	assert.InDelta(t, 0, ApparentAttenuation(1.000, 1.000), 0.001)
+	assert.InDelta(t, 65.0, RealAttenuation(1.050, 1.010), 0.1)
+	assert.InDelta(t, 5.25, ABV(1.050, 1.010), 0.001)
+}
+
+func TestCorrectGravity(t *testing.T) {
+	assert.InDelta(t, 1.050, CorrectGravity(1.050, 60, 60), 1e-9)
+	assert.InDelta(t, 1.0524, CorrectGravity(1.050, 80, 60), 0.0001)
+	assert.InDelta(t, 1.0493, CorrectGravity(1.050, 50, 60), 0.0001)
+	// hydrometers calibrated at 68°F (20°C)
+	assert.InDelta(t, 1.0526, CorrectGravity(1.050, 86, 68), 0.0001)
+}
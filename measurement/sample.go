@@ -1,6 +1,10 @@
 package measurement
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
 
 // Tags is a mapping of key-value pairs further identifying a sample
 type Tags map[string]string
@@ -10,6 +14,7 @@ type Sample interface {
 	DeviceName() string
 	Datapoints() []Datapoint
 	AddDatapoint(string, float32, time.Time)
+	AddUnitDatapoint(string, float32, Unit, time.Time)
 	AddTag(string, string)
 	Tags() Tags
 }
@@ -42,9 +47,14 @@ func (ds *DeviceSample) Datapoints() []Datapoint {
 	return ds.datapoints
 }
 
-// AddDatapoint adds a datapoint to this DeviceSample
+// AddDatapoint adds a datapoint without a unit to this DeviceSample
 func (ds *DeviceSample) AddDatapoint(name string, value float32, time time.Time) {
-	d := newDatapoint(name, value, time)
+	ds.AddUnitDatapoint(name, value, NoUnit, time)
+}
+
+// AddUnitDatapoint adds a datapoint measured in a unit to this DeviceSample
+func (ds *DeviceSample) AddUnitDatapoint(name string, value float32, unit Unit, time time.Time) {
+	d := newDatapoint(name, value, unit, time)
 	ds.datapoints = append(ds.datapoints, d)
 }
 
@@ -57,3 +67,28 @@ func (ds *DeviceSample) AddTag(name, value string) {
 func (ds *DeviceSample) Tags() Tags {
 	return ds.tags
 }
+
+// CopySample returns a new sample with the same device name, tags and
+// datapoints as s, which can be changed without affecting s
+func CopySample(s Sample) *DeviceSample {
+	c := NewDeviceSample(s.DeviceName())
+	for k, v := range s.Tags() {
+		c.AddTag(k, v)
+	}
+	for _, d := range s.Datapoints() {
+		c.AddUnitDatapoint(d.Name(), d.Value(), d.Unit(), d.Time())
+	}
+	return c
+}
+
+// SeriesKey identifies the series a sample belongs to by its device and tags,
+// e.g. the samples from one color of tilt. Stateful processing (averages,
+// rates, etc) keeps its state per series
+func SeriesKey(s Sample) string {
+	tags := []string{}
+	for k, v := range s.Tags() {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	return s.DeviceName() + "," + strings.Join(tags, ",")
+}
@@ -33,5 +33,39 @@ func TestSample(t *testing.T) {
 	assert.Equal(t, d1Value, sample.Datapoints()[0].Value())
 	assert.Equal(t, d2Name, sample.Datapoints()[1].Name())
 	assert.Equal(t, d2Value, sample.Datapoints()[1].Value())
+	assert.Equal(t, NoUnit, sample.Datapoints()[1].Unit())
 
+	sample.AddUnitDatapoint("celsius", 19.5, Celsius, ts1)
+	assert.Equal(t, Celsius, sample.Datapoints()[2].Unit())
+}
+
+func TestCopySample(t *testing.T) {
+	now := time.Now()
+	sample := NewDeviceSample("tilt")
+	sample.AddTag("color", "red")
+	sample.AddUnitDatapoint("gravity", 1.050, SpecificGravity, now)
+
+	c := CopySample(sample)
+	c.AddTag("alias", "helles")
+	c.AddDatapoint("temperature", 66, now)
+	assert.Equal(t, "tilt", c.DeviceName())
+	assert.Equal(t, Tags{"color": "red", "alias": "helles"}, c.Tags())
+	assert.Equal(t, 2, len(c.Datapoints()))
+	assert.Equal(t, SpecificGravity, c.Datapoints()[0].Unit())
+	// the original is untouched
+	assert.Equal(t, Tags{"color": "red"}, sample.Tags())
+	assert.Equal(t, 1, len(sample.Datapoints()))
+}
+
+func TestSeriesKey(t *testing.T) {
+	a := NewDeviceSample("tilt")
+	a.AddTag("color", "red")
+	a.AddTag("alias", "helles")
+	b := NewDeviceSample("tilt")
+	b.AddTag("alias", "helles")
+	b.AddTag("color", "red")
+	c := NewDeviceSample("tilt")
+	c.AddTag("color", "blue")
+	assert.Equal(t, SeriesKey(a), SeriesKey(b))
+	assert.NotEqual(t, SeriesKey(a), SeriesKey(c))
 }
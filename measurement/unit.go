@@ -0,0 +1,142 @@
+package measurement
+
+// Contains the units datapoints can be measured in, and conversions between
+// units of the same quantity
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Unit is the unit a datapoint's value is measured in. Datapoints without a
+// unit (counts, signal strengths, etc) have NoUnit
+type Unit string
+
+// Quantity is what a unit measures, e.g. temperature. Values can only be
+// converted between units of the same quantity
+type Quantity string
+
+// The units and quantities known to brewski
+const (
+	NoUnit Unit = ""
+
+	Celsius    Unit = "celsius"
+	Fahrenheit Unit = "fahrenheit"
+
+	SpecificGravity Unit = "sg"
+	Plato           Unit = "plato"
+
+	Percent Unit = "percent"
+
+	Hectopascal Unit = "hpa"
+	PSI         Unit = "psi"
+
+	Liters  Unit = "liters"
+	Gallons Unit = "gallons"
+	Pints   Unit = "pints"
+
+	Kilograms Unit = "kilograms"
+	Pounds    Unit = "pounds"
+
+	LitersPerMinute  Unit = "liters-per-minute"
+	GallonsPerMinute Unit = "gallons-per-minute"
+
+	Temperature Quantity = "temperature"
+	Gravity     Quantity = "gravity"
+	Ratio       Quantity = "ratio"
+	Pressure    Quantity = "pressure"
+	Volume      Quantity = "volume"
+	Mass        Quantity = "mass"
+	Flow        Quantity = "flow"
+)
+
+// a unit's quantity, and how to convert its values to and from the base
+// unit of the quantity
+type unitInfo struct {
+	quantity Quantity
+	toBase   func(float64) float64
+	fromBase func(float64) float64
+}
+
+func identity(v float64) float64 { return v }
+
+// scaled returns the conversions of a unit that is a multiple of the base unit
+func scaled(quantity Quantity, perBase float64) unitInfo {
+	return unitInfo{
+		quantity: quantity,
+		toBase:   func(v float64) float64 { return v / perBase },
+		fromBase: func(v float64) float64 { return v * perBase },
+	}
+}
+
+// units holds every unit known, with the base unit of each quantity
+// (celsius, specific gravity, hectopascals, liters, kilograms and liters per minute) first
+var units = map[Unit]unitInfo{
+	Celsius: {quantity: Temperature, toBase: identity, fromBase: identity},
+	Fahrenheit: {
+		quantity: Temperature,
+		toBase:   func(f float64) float64 { return (f - 32) * 5 / 9 },
+		fromBase: func(c float64) float64 { return c*9/5 + 32 },
+	},
+
+	SpecificGravity: {quantity: Gravity, toBase: identity, fromBase: identity},
+	Plato:           {quantity: Gravity, toBase: PlatoToSG, fromBase: SGToPlato},
+
+	Percent: {quantity: Ratio, toBase: identity, fromBase: identity},
+
+	Hectopascal: {quantity: Pressure, toBase: identity, fromBase: identity},
+	PSI:         scaled(Pressure, 0.0145038),
+
+	Liters:  {quantity: Volume, toBase: identity, fromBase: identity},
+	Gallons: scaled(Volume, 1/3.78541),
+	Pints:   scaled(Volume, 1/0.473176473),
+
+	Kilograms: {quantity: Mass, toBase: identity, fromBase: identity},
+	Pounds:    scaled(Mass, 2.20462),
+
+	LitersPerMinute:  {quantity: Flow, toBase: identity, fromBase: identity},
+	GallonsPerMinute: scaled(Flow, 1/3.78541),
+}
+
+// LookupUnit returns the unit with the given name
+func LookupUnit(name string) (Unit, error) {
+	if _, found := units[Unit(name)]; !found {
+		return NoUnit, fmt.Errorf("unknown unit '%s', must be one of %v", name, UnitNames())
+	}
+	return Unit(name), nil
+}
+
+// UnitNames returns the names of the units known, sorted
+func UnitNames() []string {
+	names := []string{}
+	for u := range units {
+		names = append(names, string(u))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Quantity returns what the unit measures, or an empty quantity for NoUnit
+// and unknown units
+func (u Unit) Quantity() Quantity {
+	return units[u].quantity
+}
+
+// ConvertUnit converts a value from one unit to another of the same quantity
+func ConvertUnit(value float64, from, to Unit) (float64, error) {
+	if from == to {
+		return value, nil
+	}
+	fromInfo, found := units[from]
+	if !found {
+		return 0, fmt.Errorf("cannot convert from unknown unit '%s'", from)
+	}
+	toInfo, found := units[to]
+	if !found {
+		return 0, fmt.Errorf("cannot convert to unknown unit '%s'", to)
+	}
+	if fromInfo.quantity != toInfo.quantity {
+		return 0, fmt.Errorf("cannot convert %s (%s) to %s (%s)", from, fromInfo.quantity, to, toInfo.quantity)
+	}
+	return toInfo.fromBase(fromInfo.toBase(value)), nil
+}
@@ -0,0 +1,48 @@
+package measurement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnits(t *testing.T) {
+	u, err := LookupUnit("fahrenheit")
+	assert.Nil(t, err)
+	assert.Equal(t, Fahrenheit, u)
+	assert.Equal(t, Temperature, u.Quantity())
+	_, err = LookupUnit("furlongs")
+	assert.NotNil(t, err)
+	assert.Equal(t, Quantity(""), NoUnit.Quantity())
+	assert.Contains(t, UnitNames(), "plato")
+
+	for _, c := range []struct {
+		value    float64
+		from, to Unit
+		expected float64
+	}{
+		{20, Celsius, Fahrenheit, 68},
+		{212, Fahrenheit, Celsius, 100},
+		{1.050, SpecificGravity, Plato, 12.388},
+		{12.388, Plato, SpecificGravity, 1.050},
+		{1013.25, Hectopascal, PSI, 14.696},
+		{5, Gallons, Liters, 18.927},
+		{1, Liters, Pints, 2.1134},
+		{2, Pints, Gallons, 0.25},
+		{10, Kilograms, Pounds, 22.0462},
+		{10, LitersPerMinute, GallonsPerMinute, 2.6417},
+		{55, Percent, Percent, 55},
+	} {
+		v, err := ConvertUnit(c.value, c.from, c.to)
+		assert.Nil(t, err)
+		assert.InDelta(t, c.expected, v, 0.001, "%v %s to %s", c.value, c.from, c.to)
+	}
+
+	// only between units of the same quantity
+	_, err = ConvertUnit(20, Celsius, Pounds)
+	assert.NotNil(t, err)
+	_, err = ConvertUnit(20, NoUnit, Celsius)
+	assert.NotNil(t, err)
+	_, err = ConvertUnit(20, Celsius, "kelvin")
+	assert.NotNil(t, err)
+}
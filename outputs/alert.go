@@ -0,0 +1,95 @@
+package outputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// Alerter is implemented by outputs that let someone know about events,
+// like a fermentation getting stuck (see measurement.NewEvent)
+type Alerter interface {
+	Alert(event measurement.Sample) error
+}
+
+// AlertCallback is a callback passing events on to an alerter, ignoring other samples
+type AlertCallback struct {
+	alerter Alerter
+}
+
+// NewAlertCallback returns a callback sending events to the alerter
+func NewAlertCallback(a Alerter) *AlertCallback {
+	return &AlertCallback{alerter: a}
+}
+
+// Handle passes the sample to the alerter if it is an event
+func (ac *AlertCallback) Handle(s measurement.Sample) error {
+	if _, isEvent := measurement.EventName(s); !isEvent {
+		return nil
+	}
+	return ac.alerter.Alert(s)
+}
+
+// WebhookAlerter posts events as JSON to a URL, for chat or paging services
+// (usually through a small bridge) or home automation
+type WebhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// the JSON posted for an event
+type webhookEvent struct {
+	Event      string             `json:"event"`
+	Device     string             `json:"device"`
+	Time       time.Time          `json:"time"`
+	Tags       measurement.Tags   `json:"tags"`
+	Datapoints map[string]float32 `json:"datapoints"`
+	Units      map[string]string  `json:"units,omitempty"` // of the datapoints that have one
+}
+
+// NewWebhookAlerter returns an alerter posting events to the URL, giving up on
+// requests after the timeout
+func NewWebhookAlerter(url string, timeout time.Duration) *WebhookAlerter {
+	return &WebhookAlerter{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Alert posts the event to the webhook's URL
+func (wa *WebhookAlerter) Alert(event measurement.Sample) error {
+	name, _ := measurement.EventName(event)
+	e := webhookEvent{
+		Event:      name,
+		Device:     event.DeviceName(),
+		Tags:       event.Tags(),
+		Datapoints: make(map[string]float32),
+	}
+	for _, d := range event.Datapoints() {
+		e.Datapoints[d.Name()] = d.Value()
+		if d.Unit() != measurement.NoUnit {
+			if e.Units == nil {
+				e.Units = make(map[string]string)
+			}
+			e.Units[d.Name()] = string(d.Unit())
+		}
+		e.Time = d.Time()
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := wa.client.Post(wa.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting %s event to webhook: %s", name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s for %s event", resp.Status, name)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package outputs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookAlerter(t *testing.T) {
+	received := []webhookEvent{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e webhookEvent
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&e))
+		received = append(received, e)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	cb := NewAlertCallback(NewWebhookAlerter(server.URL, time.Second))
+	now := time.Date(2018, 5, 20, 0, 0, 0, 0, time.UTC)
+	s := measurement.NewDeviceSample("fermenters")
+	s.AddTag("color", "red")
+	s.AddDatapoint("gravity", 1.030, now)
+
+	// readings aren't alerted on
+	assert.Nil(t, cb.Handle(s))
+	assert.Equal(t, 0, len(received))
+
+	event := measurement.NewEvent(s, "fermentation-stuck", now)
+	event.AddUnitDatapoint("gravity", 1.030, measurement.SpecificGravity, now)
+	assert.Nil(t, cb.Handle(event))
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "fermentation-stuck", received[0].Event)
+	assert.Equal(t, "fermenters", received[0].Device)
+	assert.Equal(t, "red", received[0].Tags["color"])
+	assert.Equal(t, float32(1.030), received[0].Datapoints["gravity"])
+	assert.Equal(t, map[string]string{"gravity": "sg"}, received[0].Units)
+	assert.True(t, now.Equal(received[0].Time))
+
+	status = http.StatusInternalServerError
+	assert.NotNil(t, cb.Handle(event))
+}
@@ -32,6 +32,11 @@ func (l *LoggingCallback) Handle(s measurement.Sample) error {
 	for _, d := range s.Datapoints() {
 		sampleFields = append(sampleFields, zap.Float32(d.Name(), d.Value()))
 	}
+	// events are worth more attention than readings
+	if event, isEvent := measurement.EventName(s); isEvent {
+		l.logger.Warn(event, sampleFields...)
+		return nil
+	}
 	// if no data given in sample, report that instead
 	if len(sampleFields) == 1 {
 		l.logger.Info("no data from device")
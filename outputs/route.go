@@ -0,0 +1,33 @@
+package outputs
+
+import "github.com/nherson/brewski/measurement"
+
+// TagRouter is a callback which hands samples to a different callback
+// depending on the value of one of their tags. Samples that don't have
+// a route for their tag value are dropped
+type TagRouter struct {
+	tag    string
+	routes map[string]Callback
+}
+
+// NewTagRouter returns a TagRouter, routing on the given tag, with no routes
+func NewTagRouter(tag string) *TagRouter {
+	return &TagRouter{
+		tag:    tag,
+		routes: make(map[string]Callback),
+	}
+}
+
+// Route sends samples whose tag has the given value to the callback
+func (tr *TagRouter) Route(value string, cb Callback) {
+	tr.routes[value] = cb
+}
+
+// Handle passes the sample along to the callback routed for its tag value, if any
+func (tr *TagRouter) Handle(s measurement.Sample) error {
+	cb, found := tr.routes[s.Tags()[tr.tag]]
+	if !found {
+		return nil
+	}
+	return cb.Handle(s)
+}
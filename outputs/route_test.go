@@ -0,0 +1,39 @@
+package outputs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagRouter(t *testing.T) {
+	red := newMockCallback()
+	blue := newMockCallback()
+
+	router := NewTagRouter("color")
+	router.Route("red", red)
+	router.Route("blue", blue)
+
+	redSample := measurement.NewDeviceSample("tilt")
+	redSample.AddTag("color", "red")
+	redSample.AddDatapoint("gravity", 1.050, time.Now())
+	blueSample := measurement.NewDeviceSample("tilt")
+	blueSample.AddTag("color", "blue")
+	blueSample.AddDatapoint("gravity", 1.012, time.Now())
+	greenSample := measurement.NewDeviceSample("tilt")
+	greenSample.AddTag("color", "green")
+	greenSample.AddDatapoint("gravity", 1.030, time.Now())
+	untagged := measurement.NewDeviceSample("tilt")
+
+	assert.Nil(t, router.Handle(redSample))
+	assert.Nil(t, router.Handle(blueSample))
+	assert.Nil(t, router.Handle(greenSample))
+	assert.Nil(t, router.Handle(untagged))
+
+	assert.Equal(t, 1, len(red.ReceivedSamples()))
+	assert.Equal(t, "red", red.ReceivedSamples()[0].Tags()["color"])
+	assert.Equal(t, 1, len(blue.ReceivedSamples()))
+	assert.Equal(t, float32(1.012), blue.ReceivedSamples()[0].Datapoints()[0].Value())
+}
@@ -0,0 +1,150 @@
+package processors
+
+// Contains a processor downsampling samples into aggregates over time windows
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// the aggregates that can be computed over a window
+var aggregateFuncs = map[string]func(*aggregatedDatapoint) float32{
+	"min":   func(a *aggregatedDatapoint) float32 { return a.min },
+	"max":   func(a *aggregatedDatapoint) float32 { return a.max },
+	"mean":  func(a *aggregatedDatapoint) float32 { return float32(a.sum / float64(a.count)) },
+	"last":  func(a *aggregatedDatapoint) float32 { return a.last },
+	"count": func(a *aggregatedDatapoint) float32 { return float32(a.count) },
+}
+
+// AggregateNames returns the names of the aggregates that can be computed, sorted
+func AggregateNames() []string {
+	names := []string{}
+	for name := range aggregateFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Aggregate collects samples over time windows (e.g. a minute), separately for each
+// series (device and tags), and sends one sample per window in their place with
+// aggregates of each datapoint. With a single aggregate other than count, datapoints
+// keep their names; otherwise they are named after the aggregate too, e.g.
+// 'celsius-max' or 'celsius-count', as a count isn't a celsius. Windows line
+// up with the clock, their samples are timestamped with the window's start, and are
+// sent once a sample from a later window comes in. Events aren't aggregated
+type Aggregate struct {
+	window     time.Duration
+	aggregates []string
+	series     map[string]*aggregateWindow
+	lock       *sync.Mutex
+}
+
+// the samples of a series collected in the current window
+type aggregateWindow struct {
+	start      time.Time
+	sample     measurement.Sample // for its device name and tags
+	datapoints map[string]*aggregatedDatapoint
+	order      []string // datapoint names in the order first seen
+}
+
+// the running aggregates of a datapoint
+type aggregatedDatapoint struct {
+	min, max, last float32
+	sum            float64
+	count          int
+	unit           measurement.Unit
+}
+
+// NewAggregate returns a processor aggregating samples over the window. Aggregates are
+// any of min, max, mean, last and count, defaulting to mean
+func NewAggregate(window time.Duration, aggregates ...string) (*Aggregate, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("aggregation window must be above 0, got %s", window)
+	}
+	if len(aggregates) == 0 {
+		aggregates = []string{"mean"}
+	}
+	for _, a := range aggregates {
+		if _, found := aggregateFuncs[a]; !found {
+			return nil, fmt.Errorf("unknown aggregate '%s', choose from %v", a, AggregateNames())
+		}
+	}
+	return &Aggregate{
+		window:     window,
+		aggregates: aggregates,
+		series:     make(map[string]*aggregateWindow),
+		lock:       &sync.Mutex{},
+	}, nil
+}
+
+// Process adds the sample to its series' window, returning the aggregates of the
+// previous window if the sample starts a new one
+func (a *Aggregate) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	if _, isEvent := measurement.EventName(s); isEvent || len(s.Datapoints()) == 0 {
+		return []measurement.Sample{s}, nil
+	}
+	start := s.Datapoints()[0].Time().Truncate(a.window)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	key := measurement.SeriesKey(s)
+	samples := []measurement.Sample{}
+	w, found := a.series[key]
+	if found && !start.Equal(w.start) {
+		samples = append(samples, a.aggregated(w))
+	}
+	if !found || !start.Equal(w.start) {
+		w = &aggregateWindow{
+			start:      start,
+			sample:     s,
+			datapoints: make(map[string]*aggregatedDatapoint),
+		}
+		a.series[key] = w
+	}
+	for _, d := range s.Datapoints() {
+		v := d.Value()
+		agg, found := w.datapoints[d.Name()]
+		if !found {
+			agg = &aggregatedDatapoint{min: v, max: v, unit: d.Unit()}
+			w.datapoints[d.Name()] = agg
+			w.order = append(w.order, d.Name())
+		}
+		if v < agg.min {
+			agg.min = v
+		}
+		if v > agg.max {
+			agg.max = v
+		}
+		agg.last = v
+		agg.sum += float64(v)
+		agg.count++
+	}
+	return samples, nil
+}
+
+// aggregated returns the sample holding the window's aggregates
+func (a *Aggregate) aggregated(w *aggregateWindow) measurement.Sample {
+	s := measurement.NewDeviceSample(w.sample.DeviceName())
+	for k, v := range w.sample.Tags() {
+		s.AddTag(k, v)
+	}
+	for _, name := range w.order {
+		for _, aggregate := range a.aggregates {
+			datapointName := name
+			if len(a.aggregates) > 1 || aggregate == "count" {
+				datapointName = name + "-" + aggregate
+			}
+			unit := w.datapoints[name].unit
+			if aggregate == "count" {
+				unit = measurement.NoUnit
+			}
+			s.AddUnitDatapoint(datapointName, aggregateFuncs[aggregate](w.datapoints[name]), unit, w.start)
+		}
+	}
+	return s
+}
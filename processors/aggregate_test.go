@@ -0,0 +1,73 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	a, err := NewAggregate(time.Minute, "min", "max", "mean", "last", "count")
+	assert.Nil(t, err)
+	start := time.Date(2018, 5, 20, 0, 0, 0, 0, time.UTC)
+	probe := func(offset time.Duration, celsius float32) []measurement.Sample {
+		s := measurement.NewDeviceSample("probes")
+		s.AddTag("probe", "28-0000")
+		s.AddDatapoint("celsius", celsius, start.Add(offset))
+		out, err := a.Process(s)
+		assert.Nil(t, err)
+		return out
+	}
+
+	// readings every 20 seconds are collected until the next minute starts
+	assert.Equal(t, 0, len(probe(0, 19)))
+	assert.Equal(t, 0, len(probe(20*time.Second, 21)))
+	assert.Equal(t, 0, len(probe(40*time.Second, 20.5)))
+	out := probe(60*time.Second, 30)
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, "probes", out[0].DeviceName())
+	assert.Equal(t, "28-0000", out[0].Tags()["probe"])
+	assert.Equal(t, map[string]float32{
+		"celsius-min":   19,
+		"celsius-max":   21,
+		"celsius-mean":  20.166666,
+		"celsius-last":  20.5,
+		"celsius-count": 3,
+	}, values(out[0]))
+	assert.True(t, start.Equal(out[0].Datapoints()[0].Time()))
+
+	// a gap of several windows just sends the last one seen
+	out = probe(5*time.Minute, 18)
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, float32(30), values(out[0])["celsius-last"])
+
+	// events pass straight through
+	event := measurement.NewEvent(measurement.NewDeviceSample("probes"), "spike", start)
+	out, err = a.Process(event)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{event}, out)
+
+	// a single aggregate keeps datapoint names
+	a, err = NewAggregate(time.Minute)
+	assert.Nil(t, err)
+	probe(0, 19)
+	probe(30*time.Second, 21)
+	out = probe(time.Minute, 0)
+	assert.Equal(t, map[string]float32{"celsius": 20}, values(out[0]))
+
+	// unless it is a count, which isn't in the datapoint's unit
+	a, err = NewAggregate(time.Minute, "count")
+	assert.Nil(t, err)
+	probe(0, 19)
+	probe(30*time.Second, 21)
+	out = probe(time.Minute, 0)
+	assert.Equal(t, map[string]float32{"celsius-count": 2}, values(out[0]))
+	assert.Equal(t, measurement.NoUnit, out[0].Datapoints()[0].Unit())
+
+	_, err = NewAggregate(0)
+	assert.NotNil(t, err)
+	_, err = NewAggregate(time.Minute, "median")
+	assert.NotNil(t, err)
+}
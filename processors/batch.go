@@ -0,0 +1,111 @@
+package processors
+
+// Contains the tracking of the batches of beer a series of gravity readings comes
+// from, shared by the processors that need a batch's original gravity
+
+import "fmt"
+
+const (
+	defaultStableReadings = 5
+	// a gravity this far above the lowest gravity of a batch means the hydrometer has
+	// been moved into a new batch, whose original gravity is then detected again.
+	// Comparing against the original gravity would miss a new batch of lower gravity
+	newBatchRise = float32(0.005)
+)
+
+// OriginalGravitySettings configures how the original gravity of a batch is found.
+// If no original gravity is given, it is detected as the first stable gravity seen:
+// StableReadings readings in a row all within StableTolerance of each other. Note
+// that this is the first stable gravity since brewski started, so restarting it in
+// the middle of a fermentation takes the current gravity as the original one (until
+// the hydrometer is moved into a new batch); give the original gravity to avoid that
+type OriginalGravitySettings struct {
+	OriginalGravity float32
+	StableReadings  int     // defaults to 5
+	StableTolerance float32 // defaults to 0.001
+}
+
+// Validate returns an error if the settings don't make sense
+func (s OriginalGravitySettings) Validate() error {
+	if s.OriginalGravity != 0 && s.OriginalGravity <= 1 {
+		return fmt.Errorf("original gravity must be above 1.000, got %.3f", s.OriginalGravity)
+	}
+	if s.StableReadings < 0 {
+		return fmt.Errorf("stable readings cannot be negative")
+	}
+	if s.StableTolerance < 0 {
+		return fmt.Errorf("stable tolerance cannot be negative")
+	}
+	return nil
+}
+
+// withDefaults returns the settings with defaults for any left empty
+func (s OriginalGravitySettings) withDefaults() OriginalGravitySettings {
+	if s.StableReadings == 0 {
+		s.StableReadings = defaultStableReadings
+	}
+	if s.StableTolerance == 0 {
+		s.StableTolerance = defaultStableGravity
+	}
+	return s
+}
+
+// batchTracker follows the original gravity of the batch a single series of
+// gravity readings comes from, noticing when the hydrometer is moved into a new one
+type batchTracker struct {
+	settings        OriginalGravitySettings
+	originalGravity float32
+	lowest          float32 // the lowest gravity since the original gravity was detected
+	recent          []float32
+}
+
+func newBatchTracker(settings OriginalGravitySettings) *batchTracker {
+	return &batchTracker{
+		settings:        settings,
+		originalGravity: settings.OriginalGravity,
+	}
+}
+
+// add takes a gravity reading into account, returning whether it is the first
+// reading of a new batch. A configured original gravity never changes
+func (b *batchTracker) add(gravity float32) bool {
+	if b.settings.OriginalGravity != 0 {
+		return false
+	}
+	newBatch := false
+	if b.originalGravity != 0 {
+		if gravity < b.lowest+newBatchRise {
+			if gravity < b.lowest {
+				b.lowest = gravity
+			}
+			return false
+		}
+		// the hydrometer has been put into a new batch
+		b.originalGravity = 0
+		b.recent = nil
+		newBatch = true
+	}
+	b.recent = append(b.recent, gravity)
+	if len(b.recent) > b.settings.StableReadings {
+		b.recent = b.recent[1:]
+	}
+	if len(b.recent) < b.settings.StableReadings {
+		return newBatch
+	}
+	min, max, sum := b.recent[0], b.recent[0], float32(0)
+	for _, r := range b.recent {
+		if r < min {
+			min = r
+		}
+		if r > max {
+			max = r
+		}
+		sum += r
+	}
+	if max-min <= b.settings.StableTolerance {
+		b.originalGravity = sum / float32(len(b.recent))
+		b.lowest = min
+		b.recent = nil
+	}
+	return newBatch
+}
@@ -0,0 +1,45 @@
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchTracker(t *testing.T) {
+	b := newBatchTracker(OriginalGravitySettings{}.withDefaults())
+	for _, g := range hours(4, 1.050) {
+		assert.False(t, b.add(g))
+	}
+	assert.Equal(t, float32(0), b.originalGravity)
+	assert.False(t, b.add(1.050))
+	assert.InDelta(t, 1.050, b.originalGravity, 1e-6)
+
+	// small rises, e.g. from CO2 lifting the hydrometer, stay in the batch
+	assert.False(t, b.add(1.053))
+	assert.InDelta(t, 1.050, b.originalGravity, 1e-6)
+
+	// a big one means the hydrometer was moved into a new batch
+	assert.True(t, b.add(1.062))
+	assert.Equal(t, float32(0), b.originalGravity)
+	for _, g := range hours(4, 1.062) {
+		assert.False(t, b.add(g))
+	}
+	assert.InDelta(t, 1.062, b.originalGravity, 1e-6)
+
+	// even one of lower gravity, once the last one has fermented
+	for g := float32(1.060); g > 1.011; g -= 0.002 {
+		assert.False(t, b.add(g))
+	}
+	assert.InDelta(t, 1.062, b.originalGravity, 1e-6)
+	assert.True(t, b.add(1.048))
+	for _, g := range hours(5, 1.048) {
+		assert.False(t, b.add(g))
+	}
+	assert.InDelta(t, 1.048, b.originalGravity, 1e-6)
+
+	// a configured original gravity never changes
+	b = newBatchTracker(OriginalGravitySettings{OriginalGravity: 1.048}.withDefaults())
+	assert.False(t, b.add(1.070))
+	assert.Equal(t, float32(1.048), b.originalGravity)
+}
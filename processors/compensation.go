@@ -0,0 +1,136 @@
+package processors
+
+// Contains a processor correcting gravity readings for the temperature they were taken at
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/nherson/brewski/state"
+)
+
+const (
+	defaultTemperatureDatapoint = "temperature"
+	defaultReferenceFahrenheit  = 60.0
+	defaultReferenceCelsius     = 20.0
+	defaultTemperatureMaxAge    = 5 * time.Minute
+)
+
+// CompensationSettings configures a gravity temperature compensation processor.
+// Temperatures are taken from the same sample as the gravity (e.g. a tilt's
+// temperature), or, if a Device is given, from the latest value read from that
+// device (e.g. a probe in the fermenter)
+type CompensationSettings struct {
+	Datapoint   string  // the gravity datapoint, defaults to 'gravity'
+	Temperature string  // the temperature datapoint, defaults to 'temperature'
+	Unit        string  // 'fahrenheit' or 'celsius', for the reference and temperatures without a unit. Defaults to celsius for a 'celsius' datapoint, otherwise fahrenheit
+	Reference   float64 // the temperature the hydrometer is calibrated for, defaults to 60°F or 20°C
+	Corrected   string  // the corrected gravity datapoint, defaults to '<datapoint>-corrected'
+
+	Device string           // the device to read temperatures from, instead of the sample
+	Tags   measurement.Tags // selects among the device's series, e.g. color=red
+	Values state.Values     // where the device's latest values are looked up
+	MaxAge time.Duration    // how much older than the gravity the device's temperature may be, defaults to 5m
+}
+
+// Validate returns an error if the settings don't make sense
+func (s CompensationSettings) Validate() error {
+	if s.Unit != "" && s.Unit != "fahrenheit" && s.Unit != "celsius" {
+		return fmt.Errorf("unit '%s' must be 'fahrenheit' or 'celsius'", s.Unit)
+	}
+	if s.Device != "" && s.Values == nil {
+		return fmt.Errorf("values must be given to read temperatures from device '%s'", s.Device)
+	}
+	if s.MaxAge < 0 {
+		return fmt.Errorf("max age cannot be negative")
+	}
+	return nil
+}
+
+// GravityCompensation adds the gravity corrected to the hydrometer's reference
+// temperature alongside the raw gravity of each sample, since a warm or cold
+// beer reads lower or higher than it is (e.g. during a diacetyl rest)
+type GravityCompensation struct {
+	settings CompensationSettings
+}
+
+// NewGravityCompensation returns a gravity temperature compensation processor,
+// using defaults for any settings left empty
+func NewGravityCompensation(settings CompensationSettings) (*GravityCompensation, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Datapoint == "" {
+		settings.Datapoint = defaultGravityDatapoint
+	}
+	if settings.Temperature == "" {
+		settings.Temperature = defaultTemperatureDatapoint
+	}
+	if settings.Unit == "" {
+		settings.Unit = "fahrenheit"
+		if settings.Temperature == "celsius" {
+			settings.Unit = "celsius"
+		}
+	}
+	if settings.Reference == 0 {
+		settings.Reference = defaultReferenceFahrenheit
+		if settings.Unit == "celsius" {
+			settings.Reference = defaultReferenceCelsius
+		}
+	}
+	if settings.Corrected == "" {
+		settings.Corrected = settings.Datapoint + "-corrected"
+	}
+	if settings.MaxAge == 0 {
+		settings.MaxAge = defaultTemperatureMaxAge
+	}
+	return &GravityCompensation{settings: settings}, nil
+}
+
+// Process returns a copy of the sample with the corrected gravity added. Samples
+// without a gravity, and events, are passed on as they are, as are samples whose
+// temperature isn't known, along with an error
+func (gc *GravityCompensation) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	if _, isEvent := measurement.EventName(s); isEvent {
+		return []measurement.Sample{s}, nil
+	}
+	var gravity, temperature measurement.Datapoint
+	for _, d := range s.Datapoints() {
+		switch d.Name() {
+		case gc.settings.Datapoint:
+			gravity = d
+		case gc.settings.Temperature:
+			temperature = d
+		}
+	}
+	if gravity == nil {
+		return []measurement.Sample{s}, nil
+	}
+	if gc.settings.Device != "" {
+		var found bool
+		temperature, found = gc.settings.Values.Latest(gc.settings.Device, gc.settings.Temperature, gc.settings.Tags)
+		if !found {
+			return []measurement.Sample{s}, fmt.Errorf("no '%s' read from device '%s' to correct gravity with", gc.settings.Temperature, gc.settings.Device)
+		}
+		if gravity.Time().Sub(temperature.Time()) > gc.settings.MaxAge {
+			return []measurement.Sample{s}, fmt.Errorf("'%s' from device '%s' is too old to correct gravity with", gc.settings.Temperature, gc.settings.Device)
+		}
+	}
+	if temperature == nil {
+		return []measurement.Sample{s}, fmt.Errorf("sample from device '%s' has no '%s' to correct gravity with", s.DeviceName(), gc.settings.Temperature)
+	}
+
+	// temperatures are in their datapoint's unit, if it has one, otherwise in the
+	// configured unit, like the reference
+	unit := measurement.Unit(gc.settings.Unit)
+	reference, _ := measurement.ConvertUnit(gc.settings.Reference, unit, measurement.Fahrenheit)
+	if temperature.Unit().Quantity() == measurement.Temperature {
+		unit = temperature.Unit()
+	}
+	fahrenheit, _ := measurement.ConvertUnit(float64(temperature.Value()), unit, measurement.Fahrenheit)
+
+	corrected := measurement.CopySample(s)
+	corrected.AddUnitDatapoint(gc.settings.Corrected, float32(measurement.CorrectGravity(float64(gravity.Value()), fahrenheit, reference)), gravity.Unit(), gravity.Time())
+	return []measurement.Sample{corrected}, nil
+}
@@ -0,0 +1,97 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/nherson/brewski/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGravityCompensation(t *testing.T) {
+	// a tilt's own temperature, in °F, against the default 60°F reference
+	gc, err := NewGravityCompensation(CompensationSettings{})
+	assert.Nil(t, err)
+	s := newSample("tilt", map[string]float32{"temperature": 80, "gravity": 1.050})
+	out, err := gc.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out))
+	assert.InDelta(t, 1.05245, values(out[0])["gravity-corrected"], 1e-5)
+	assert.Equal(t, float32(1.050), values(out[0])["gravity"])
+	// the original is untouched
+	assert.Equal(t, 2, len(s.Datapoints()))
+
+	// at the reference temperature nothing changes
+	out, err = gc.Process(newSample("tilt", map[string]float32{"temperature": 60, "gravity": 1.050}))
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.050, values(out[0])["gravity-corrected"], 1e-6)
+
+	// samples without gravity and events pass through
+	s = newSample("tilt", map[string]float32{"temperature": 80})
+	out, err = gc.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{s}, out)
+	event := measurement.NewEvent(newSample("tilt", map[string]float32{"gravity": 1.010}), FermentationCompleteEvent, time.Now())
+	out, err = gc.Process(event)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{event}, out)
+
+	// without a temperature, the sample is passed on uncorrected
+	s = newSample("tilt", map[string]float32{"gravity": 1.050})
+	out, err = gc.Process(s)
+	assert.NotNil(t, err)
+	assert.Equal(t, []measurement.Sample{s}, out)
+}
+
+func TestGravityCompensationFromDevice(t *testing.T) {
+	store := state.NewStore()
+	gc, err := NewGravityCompensation(CompensationSettings{
+		Temperature: "celsius",
+		Corrected:   "corrected",
+		Device:      "fermenter-probe",
+		Values:      store,
+	})
+	assert.Nil(t, err)
+
+	s := newSample("tilt", map[string]float32{"temperature": 50, "gravity": 1.050})
+	out, err := gc.Process(s)
+	assert.NotNil(t, err)
+	assert.Equal(t, []measurement.Sample{s}, out)
+
+	probe := measurement.NewDeviceSample("fermenter-probe")
+	probe.AddDatapoint("celsius", 30, time.Now().Add(-time.Hour))
+	assert.Nil(t, store.Handle(probe))
+	_, err = gc.Process(s)
+	assert.NotNil(t, err)
+
+	// 30°C against the default 20°C reference, ignoring the tilt's own temperature
+	probe = measurement.NewDeviceSample("fermenter-probe")
+	probe.AddDatapoint("celsius", 30, time.Now())
+	assert.Nil(t, store.Handle(probe))
+	out, err = gc.Process(s)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.05260, values(out[0])["corrected"], 1e-5)
+
+	// a temperature's own unit is used over the configured one, here 86°F
+	probe = measurement.NewDeviceSample("fermenter-probe")
+	probe.AddUnitDatapoint("celsius", 86, measurement.Fahrenheit, time.Now())
+	assert.Nil(t, store.Handle(probe))
+	gravity := measurement.NewDeviceSample("tilt")
+	gravity.AddUnitDatapoint("gravity", 1.050, measurement.SpecificGravity, time.Now())
+	out, err = gc.Process(gravity)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.05260, values(out[0])["corrected"], 1e-5)
+	assert.Equal(t, measurement.SpecificGravity, out[0].Datapoints()[1].Unit())
+}
+
+func TestCompensationSettings(t *testing.T) {
+	for _, settings := range []CompensationSettings{
+		{Unit: "kelvin"},
+		{Device: "fermenter-probe"},
+		{MaxAge: -time.Minute},
+	} {
+		_, err := NewGravityCompensation(settings)
+		assert.NotNil(t, err)
+	}
+}
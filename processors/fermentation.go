@@ -0,0 +1,255 @@
+package processors
+
+// Contains a processor following the progress of fermentations from gravity readings
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+const (
+	// FermentationCompleteEvent is the name of the event sent when gravity
+	// has been stable long enough for a fermentation to be complete
+	FermentationCompleteEvent = "fermentation-complete"
+
+	defaultRateWindow       = 24 * time.Hour
+	defaultStableDuration   = 72 * time.Hour
+	defaultStableGravity    = float32(0.001)
+	defaultGravityDatapoint = "gravity"
+	// readings closer together than this are only kept once, which
+	// bounds the memory used by days of frequent readings
+	fermentationResolution = time.Minute
+	// the rate isn't estimated from readings spanning less than this
+	minRateSpan = time.Hour
+)
+
+// FermentationSettings configures a fermentation analyzer
+type FermentationSettings struct {
+	Datapoint       string        // the gravity datapoint, defaults to 'gravity'
+	RateWindow      time.Duration // how far back the rate is estimated from, defaults to 24h
+	StableDuration  time.Duration // how long gravity must be stable for, defaults to 72h
+	StableTolerance float32       // how much gravity may change while stable, defaults to 0.001
+	TerminalGravity float32       // the expected final gravity, if known
+	OriginalGravity float32       // the gravity at pitching, if known
+}
+
+// Validate returns an error if the settings don't make sense
+func (s FermentationSettings) Validate() error {
+	if s.RateWindow < 0 || s.StableDuration < 0 {
+		return fmt.Errorf("rate window and stable duration cannot be negative")
+	}
+	if s.StableTolerance < 0 {
+		return fmt.Errorf("stable tolerance cannot be negative")
+	}
+	if s.TerminalGravity != 0 && s.TerminalGravity < 0.98 {
+		return fmt.Errorf("terminal gravity %.3f is not a specific gravity", s.TerminalGravity)
+	}
+	return OriginalGravitySettings{OriginalGravity: s.OriginalGravity}.Validate()
+}
+
+// Fermentation follows gravity readings over time, separately for each series
+// (e.g. tilt color). Samples with a gravity get a 'gravity-points-per-day' datapoint,
+// how fast gravity dropped over the rate window (a point is 0.001), and, if a terminal
+// gravity is set, 'hours-to-terminal-gravity' at that rate. They also get a
+// 'fermentation-complete' datapoint: 1 once gravity stayed within the stable tolerance
+// for the stable duration, otherwise 0. Gravity must have dropped first, at least
+// 0.002 below the original gravity (given, or detected as for gravity metrics) or to
+// within 0.004 of the terminal gravity, so wort that never started fermenting isn't
+// complete. When a fermentation becomes complete, a 'fermentation-complete' event
+// holding the final gravity is sent along with the sample. A fermentation stays
+// complete, whatever gravity does next, until the hydrometer is moved into a new batch
+type Fermentation struct {
+	settings FermentationSettings
+	series   map[string]*fermentationSeries
+	lock     *sync.Mutex
+}
+
+// a reading kept for analysis
+type gravityReading struct {
+	time    time.Time
+	gravity float32
+}
+
+// the state of a single series of gravity readings
+type fermentationSeries struct {
+	readings []gravityReading
+	batch    *batchTracker
+	complete bool
+}
+
+// NewFermentation returns a fermentation analyzer, using defaults for any settings left empty
+func NewFermentation(settings FermentationSettings) (*Fermentation, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Datapoint == "" {
+		settings.Datapoint = defaultGravityDatapoint
+	}
+	if settings.RateWindow == 0 {
+		settings.RateWindow = defaultRateWindow
+	}
+	if settings.StableDuration == 0 {
+		settings.StableDuration = defaultStableDuration
+	}
+	if settings.StableTolerance == 0 {
+		settings.StableTolerance = defaultStableGravity
+	}
+	return &Fermentation{
+		settings: settings,
+		series:   make(map[string]*fermentationSeries),
+		lock:     &sync.Mutex{},
+	}, nil
+}
+
+// Process returns a copy of the sample with the fermentation's progress added,
+// and an event if the fermentation just became complete. Samples without a
+// gravity, and events, are passed on as they are
+func (f *Fermentation) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	// events carry the gravity they were sent at, which isn't a new reading
+	if _, isEvent := measurement.EventName(s); isEvent {
+		return []measurement.Sample{s}, nil
+	}
+	var gravity measurement.Datapoint
+	for _, d := range s.Datapoints() {
+		if d.Name() == f.settings.Datapoint {
+			gravity = d
+			break
+		}
+	}
+	if gravity == nil {
+		return []measurement.Sample{s}, nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key := measurement.SeriesKey(s)
+	series, found := f.series[key]
+	if !found {
+		series = &fermentationSeries{batch: newBatchTracker(OriginalGravitySettings{
+			OriginalGravity: f.settings.OriginalGravity,
+			StableTolerance: f.settings.StableTolerance,
+		}.withDefaults())}
+		f.series[key] = series
+	}
+	if series.batch.add(gravity.Value()) {
+		series.complete = false
+	}
+	series.add(gravityReading{time: gravity.Time(), gravity: gravity.Value()}, f.keepFor())
+
+	processed := measurement.CopySample(s)
+	t := gravity.Time()
+	if pointsPerDay, ok := series.pointsPerDay(t.Add(-f.settings.RateWindow)); ok {
+		processed.AddDatapoint("gravity-points-per-day", pointsPerDay, t)
+		if f.settings.TerminalGravity != 0 && pointsPerDay > 0 {
+			remaining := (gravity.Value() - f.settings.TerminalGravity) * 1000
+			if remaining < 0 {
+				remaining = 0
+			}
+			processed.AddDatapoint("hours-to-terminal-gravity", remaining/pointsPerDay*24, t)
+		}
+	}
+
+	wasComplete := series.complete
+	if !series.complete && f.dropped(series, gravity.Value()) {
+		series.complete = series.stable(t.Add(-f.settings.StableDuration), f.settings.StableTolerance)
+	}
+	complete := float32(0)
+	if series.complete {
+		complete = 1
+	}
+	processed.AddDatapoint("fermentation-complete", complete, t)
+	samples := []measurement.Sample{processed}
+	if series.complete && !wasComplete {
+		event := measurement.NewEvent(s, FermentationCompleteEvent, t)
+		event.AddUnitDatapoint(f.settings.Datapoint, gravity.Value(), gravity.Unit(), t)
+		samples = append(samples, event)
+	}
+	return samples, nil
+}
+
+// keepFor returns how long readings are needed for
+func (f *Fermentation) keepFor() time.Duration {
+	if f.settings.RateWindow > f.settings.StableDuration {
+		return f.settings.RateWindow
+	}
+	return f.settings.StableDuration
+}
+
+// dropped returns whether the gravity has dropped far enough for the fermentation
+// to have started, going by the batch's original gravity or the terminal gravity
+func (f *Fermentation) dropped(series *fermentationSeries, gravity float32) bool {
+	og := series.batch.originalGravity
+	if og != 0 && og-gravity >= defaultLagDrop-1e-6 {
+		return true
+	}
+	return f.settings.TerminalGravity != 0 && gravity-f.settings.TerminalGravity <= defaultStallMargin+1e-6
+}
+
+// add keeps the reading, unless one was kept very recently, and forgets readings
+// older than needed. The last reading from before then is kept, to know that
+// readings go back far enough
+func (fs *fermentationSeries) add(r gravityReading, keepFor time.Duration) {
+	if n := len(fs.readings); n > 0 && r.time.Sub(fs.readings[n-1].time) < fermentationResolution {
+		return
+	}
+	fs.readings = append(fs.readings, r)
+	oldest := r.time.Add(-keepFor)
+	i := 0
+	for i < len(fs.readings)-1 && !fs.readings[i+1].time.After(oldest) {
+		i++
+	}
+	fs.readings = fs.readings[i:]
+}
+
+// pointsPerDay returns how fast gravity has dropped since the given time, from a
+// least squares fit of the readings, or false if they don't span enough time
+func (fs *fermentationSeries) pointsPerDay(since time.Time) (float32, bool) {
+	readings := []gravityReading{}
+	for _, r := range fs.readings {
+		if !r.time.Before(since) {
+			readings = append(readings, r)
+		}
+	}
+	if len(readings) < 2 || readings[len(readings)-1].time.Sub(readings[0].time) < minRateSpan {
+		return 0, false
+	}
+	var meanX, meanY float64
+	for _, r := range readings {
+		meanX += r.time.Sub(readings[0].time).Hours() / 24
+		meanY += float64(r.gravity)
+	}
+	meanX /= float64(len(readings))
+	meanY /= float64(len(readings))
+	var cov, variance float64
+	for _, r := range readings {
+		dx := r.time.Sub(readings[0].time).Hours()/24 - meanX
+		cov += dx * (float64(r.gravity) - meanY)
+		variance += dx * dx
+	}
+	return float32(-cov / variance * 1000), true
+}
+
+// stable returns whether there are readings going back to the given time, and
+// they all stayed within the tolerance
+func (fs *fermentationSeries) stable(since time.Time, tolerance float32) bool {
+	if len(fs.readings) == 0 || fs.readings[0].time.After(since) {
+		return false
+	}
+	min, max := fs.readings[len(fs.readings)-1].gravity, fs.readings[len(fs.readings)-1].gravity
+	for _, r := range fs.readings {
+		if r.time.Before(since) {
+			continue
+		}
+		if r.gravity < min {
+			min = r.gravity
+		}
+		if r.gravity > max {
+			max = r.gravity
+		}
+	}
+	// allow for float32 rounding, so 1.011 and 1.010 are within 0.001
+	return max-min <= tolerance+1e-6
+}
@@ -0,0 +1,155 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFermentation(t *testing.T) {
+	f, err := NewFermentation(FermentationSettings{
+		StableDuration:  48 * time.Hour,
+		TerminalGravity: 1.010,
+		OriginalGravity: 1.050,
+	})
+	assert.Nil(t, err)
+
+	start := time.Date(2018, 5, 20, 0, 0, 0, 0, time.UTC)
+	gravity := float32(1.050)
+	events := 0
+	var last measurement.Sample
+	// hourly readings, dropping 12 points a day for 3 days, then stable for 3 days
+	for hour := 0; hour <= 6*24; hour++ {
+		if hour > 0 && hour <= 3*24 {
+			gravity -= 0.0005
+		}
+		s := measurement.NewDeviceSample("fermenters")
+		s.AddTag("color", "red")
+		s.AddDatapoint("gravity", gravity, start.Add(time.Duration(hour)*time.Hour))
+		out, err := f.Process(s)
+		assert.Nil(t, err)
+		last = out[0]
+		progress := values(out[0])
+
+		switch hour {
+		case 0:
+			// too early to tell
+			_, found := progress["gravity-points-per-day"]
+			assert.False(t, found)
+		case 2 * 24:
+			assert.InDelta(t, 12, progress["gravity-points-per-day"], 0.01)
+			// 1.026 - 1.010 at 12 points a day
+			assert.InDelta(t, 32, progress["hours-to-terminal-gravity"], 0.1)
+			assert.Equal(t, float32(0), progress["fermentation-complete"])
+		case 3*24 + 45:
+			// the last of the drop, 1.015 at hour 70, is within the tolerance
+			// of the final gravity, so gravity is stable from then on
+			assert.Equal(t, float32(0), progress["fermentation-complete"])
+		}
+
+		for _, sample := range out[1:] {
+			name, isEvent := measurement.EventName(sample)
+			assert.True(t, isEvent)
+			assert.Equal(t, FermentationCompleteEvent, name)
+			assert.Equal(t, "red", sample.Tags()["color"])
+			assert.InDelta(t, 1.014, values(sample)["gravity"], 1e-4)
+			assert.Equal(t, 3*24+46, hour)
+			events++
+		}
+	}
+	// the event is only sent once
+	assert.Equal(t, 1, events)
+	assert.Equal(t, float32(1), values(last)["fermentation-complete"])
+	assert.InDelta(t, 0, values(last)["gravity-points-per-day"], 0.01)
+
+	// samples without gravity pass through untouched
+	s := measurement.NewDeviceSample("fermenters")
+	s.AddDatapoint("temperature", 66, start)
+	out, err := f.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{s}, out)
+
+	// as do events, though they have a gravity
+	event := measurement.NewEvent(last, FermentationCompleteEvent, start)
+	event.AddDatapoint("gravity", 1.030, start)
+	out, err = f.Process(event)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{event}, out)
+
+	_, err = NewFermentation(FermentationSettings{TerminalGravity: 0.5})
+	assert.NotNil(t, err)
+	_, err = NewFermentation(FermentationSettings{OriginalGravity: 0.5})
+	assert.NotNil(t, err)
+}
+
+// returns hourly readings dropping a point an hour between the gravities
+func dropping(from, to float32) []float32 {
+	gs := []float32{}
+	for g := from; g > to+1e-4; g -= 0.001 {
+		gs = append(gs, g)
+	}
+	return gs
+}
+
+func TestFermentationNeedsDrop(t *testing.T) {
+	f, err := NewFermentation(FermentationSettings{StableDuration: 24 * time.Hour})
+	assert.Nil(t, err)
+
+	// wort sitting at its original gravity, then fermenting down to 1.030, where
+	// it jitters for a while, then a new batch that ferments down to 1.040
+	gravities := hours(72, 1.050)
+	gravities = append(gravities, dropping(1.050, 1.030)...)
+	gravities = append(gravities, hours(30, 1.030)...)
+	for i := 0; i < 5; i++ {
+		gravities = append(gravities, 1.033, 1.030)
+	}
+	gravities = append(gravities, hours(30, 1.030)...)
+	newBatch := len(gravities)
+	gravities = append(gravities, hours(10, 1.060)...)
+	gravities = append(gravities, dropping(1.060, 1.040)...)
+	gravities = append(gravities, hours(30, 1.040)...)
+
+	start := time.Date(2018, 5, 20, 0, 0, 0, 0, time.UTC)
+	completes := []float32{}
+	events := []float32{}
+	for hour, g := range gravities {
+		s := measurement.NewDeviceSample("fermenters")
+		s.AddDatapoint("gravity", g, start.Add(time.Duration(hour)*time.Hour))
+		out, err := f.Process(s)
+		assert.Nil(t, err)
+		completes = append(completes, values(out[0])["fermentation-complete"])
+		for _, e := range out[1:] {
+			events = append(events, values(e)["gravity"])
+		}
+	}
+
+	// stable at the original gravity isn't complete
+	for _, c := range completes[:72] {
+		assert.Equal(t, float32(0), c)
+	}
+	// completion is sent once for each batch, whatever gravity does in between
+	if assert.Len(t, events, 2) {
+		assert.InDelta(t, 1.030, events[0], 1e-4)
+		assert.InDelta(t, 1.040, events[1], 1e-4)
+	}
+	assert.Equal(t, float32(1), completes[newBatch-1])
+	assert.Equal(t, float32(0), completes[newBatch])
+	assert.Equal(t, float32(1), completes[len(completes)-1])
+
+	// first seen already finished, near the terminal gravity, but not well above it
+	for g, want := range map[float32]int{1.012: 1, 1.020: 0} {
+		f, err = NewFermentation(FermentationSettings{StableDuration: 24 * time.Hour, TerminalGravity: 1.010})
+		assert.Nil(t, err)
+		sent := 0
+		for hour := 0; hour < 30; hour++ {
+			s := measurement.NewDeviceSample("fermenters")
+			s.AddDatapoint("gravity", g, start.Add(time.Duration(hour)*time.Hour))
+			out, err := f.Process(s)
+			assert.Nil(t, err)
+			sent += len(out) - 1
+		}
+		assert.Equal(t, want, sent, "gravity %.3f", g)
+	}
+}
@@ -0,0 +1,90 @@
+package processors
+
+// Contains a processor deriving brewing metrics from gravity readings
+
+import (
+	"sync"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// GravityMetricsSettings configures a gravity metrics processor
+type GravityMetricsSettings struct {
+	Datapoint string // the gravity datapoint, defaults to 'gravity'
+	OriginalGravitySettings
+}
+
+// Validate returns an error if the settings don't make sense
+func (s GravityMetricsSettings) Validate() error {
+	return s.OriginalGravitySettings.Validate()
+}
+
+// GravityMetrics derives brewing metrics from gravity readings. Every sample with a
+// gravity gets 'plato' and 'brix' datapoints, and once the batch's original gravity
+// is known, 'original-gravity', 'apparent-attenuation', 'real-attenuation' and 'abv'
+// (percents). Each series of samples (same device and tags, e.g. a tilt color) is
+// tracked separately
+type GravityMetrics struct {
+	settings GravityMetricsSettings
+	series   map[string]*batchTracker
+	lock     *sync.Mutex
+}
+
+// NewGravityMetrics returns a gravity metrics processor, using defaults for any
+// settings left empty
+func NewGravityMetrics(settings GravityMetricsSettings) (*GravityMetrics, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Datapoint == "" {
+		settings.Datapoint = defaultGravityDatapoint
+	}
+	settings.OriginalGravitySettings = settings.OriginalGravitySettings.withDefaults()
+	return &GravityMetrics{
+		settings: settings,
+		series:   make(map[string]*batchTracker),
+		lock:     &sync.Mutex{},
+	}, nil
+}
+
+// Process returns a copy of the sample with the metrics added. Samples without
+// a gravity, and events, are passed on as they are
+func (gm *GravityMetrics) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	if _, isEvent := measurement.EventName(s); isEvent {
+		return []measurement.Sample{s}, nil
+	}
+	var gravity measurement.Datapoint
+	for _, d := range s.Datapoints() {
+		if d.Name() == gm.settings.Datapoint {
+			gravity = d
+			break
+		}
+	}
+	if gravity == nil {
+		return []measurement.Sample{s}, nil
+	}
+
+	gm.lock.Lock()
+	key := measurement.SeriesKey(s)
+	batch, found := gm.series[key]
+	if !found {
+		batch = newBatchTracker(gm.settings.OriginalGravitySettings)
+		gm.series[key] = batch
+	}
+	batch.add(gravity.Value())
+	og := batch.originalGravity
+	gm.lock.Unlock()
+
+	processed := measurement.CopySample(s)
+	t := gravity.Time()
+	sg := float64(gravity.Value())
+	processed.AddUnitDatapoint("plato", float32(measurement.SGToPlato(sg)), measurement.Plato, t)
+	processed.AddDatapoint("brix", float32(measurement.SGToBrix(sg)), t)
+	if og != 0 {
+		processed.AddUnitDatapoint("original-gravity", og, measurement.SpecificGravity, t)
+		processed.AddUnitDatapoint("apparent-attenuation", float32(measurement.ApparentAttenuation(float64(og), sg)), measurement.Percent, t)
+		processed.AddUnitDatapoint("real-attenuation", float32(measurement.RealAttenuation(float64(og), sg)), measurement.Percent, t)
+		processed.AddUnitDatapoint("abv", float32(measurement.ABV(float64(og), sg)), measurement.Percent, t)
+	}
+	return []measurement.Sample{processed}, nil
+}
@@ -0,0 +1,84 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+// runs gravities of a tilt color through the processor, returning the processed values
+func runMetrics(t *testing.T, p Processor, color string, gravities ...float32) []map[string]float32 {
+	processed := []map[string]float32{}
+	for _, g := range gravities {
+		s := newSample("tilt", map[string]float32{"temperature": 66, "gravity": g})
+		s.AddTag("color", color)
+		out, err := p.Process(s)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(out))
+		processed = append(processed, values(out[0]))
+	}
+	return processed
+}
+
+func TestGravityMetricsConfiguredOG(t *testing.T) {
+	gm, err := NewGravityMetrics(GravityMetricsSettings{OriginalGravitySettings: OriginalGravitySettings{OriginalGravity: 1.050}})
+	assert.Nil(t, err)
+	v := runMetrics(t, gm, "red", 1.010)[0]
+	assert.InDelta(t, 2.56, v["plato"], 0.01)
+	assert.InDelta(t, 2.56, v["brix"], 0.1)
+	assert.Equal(t, float32(1.050), v["original-gravity"])
+	assert.InDelta(t, 80, v["apparent-attenuation"], 0.01)
+	assert.InDelta(t, 65.0, v["real-attenuation"], 0.1)
+	assert.InDelta(t, 5.25, v["abv"], 0.01)
+
+	// samples without a gravity and events are passed along untouched
+	s := newSample("probe", map[string]float32{"celsius": 19})
+	out, err := gm.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{s}, out)
+	event := measurement.NewEvent(newSample("tilt", map[string]float32{"gravity": 1.010}), FermentationCompleteEvent, time.Now())
+	out, err = gm.Process(event)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{event}, out)
+}
+
+func TestGravityMetricsDetectedOG(t *testing.T) {
+	gm, err := NewGravityMetrics(GravityMetricsSettings{OriginalGravitySettings: OriginalGravitySettings{StableReadings: 3}})
+	assert.Nil(t, err)
+
+	// settling down after being dropped in
+	v := runMetrics(t, gm, "red", 1.030, 1.056, 1.052, 1.0525, 1.052)
+	_, hasOG := v[3]["original-gravity"]
+	assert.False(t, hasOG)
+	assert.InDelta(t, 1.0522, v[4]["original-gravity"], 0.0001)
+
+	// colors are tracked separately
+	_, hasOG = runMetrics(t, gm, "blue", 1.040)[0]["original-gravity"]
+	assert.False(t, hasOG)
+
+	// fermenting away
+	assert.InDelta(t, 1.0522, runMetrics(t, gm, "red", 1.020)[0]["original-gravity"], 0.0001)
+
+	// moved into a new batch
+	v = runMetrics(t, gm, "red", 1.064, 1.064, 1.064)
+	assert.InDelta(t, 1.064, v[2]["original-gravity"], 0.0001)
+
+	// and, once that one finished, into a lighter one
+	v = runMetrics(t, gm, "red", 1.040, 1.020, 1.012, 1.048, 1.048, 1.048)
+	assert.InDelta(t, 1.064, v[2]["original-gravity"], 0.0001)
+	_, hasOG = v[3]["original-gravity"]
+	assert.False(t, hasOG)
+	assert.InDelta(t, 1.048, v[5]["original-gravity"], 0.0001)
+	assert.InDelta(t, 0, v[5]["abv"], 0.01)
+}
+
+func TestGravityMetricsSettings(t *testing.T) {
+	_, err := NewGravityMetrics(GravityMetricsSettings{})
+	assert.Nil(t, err)
+	assert.Nil(t, OriginalGravitySettings{OriginalGravity: 1.048}.Validate())
+	assert.NotNil(t, OriginalGravitySettings{OriginalGravity: 0.998}.Validate())
+	assert.NotNil(t, OriginalGravitySettings{StableReadings: -1}.Validate())
+	assert.NotNil(t, OriginalGravitySettings{StableTolerance: -0.001}.Validate())
+}
@@ -0,0 +1,60 @@
+package processors
+
+// Contains the Processor interface, for transforming samples on their way from
+// devices to outputs, and a Pipeline callback running samples through them
+
+import (
+	multierror "github.com/hashicorp/go-multierror"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/nherson/brewski/outputs"
+)
+
+// Processor transforms, enriches, filters or drops samples. Process returns the
+// samples to pass on in place of the given one: none to drop it, or more than one
+// to add samples (e.g. events). Processors must not change the samples given to
+// them, since they may be shared with other outputs; use measurement.CopySample
+type Processor interface {
+	Process(measurement.Sample) ([]measurement.Sample, error)
+}
+
+// Pipeline is a callback that runs samples through a list of processors, in order,
+// handing whatever comes out of the last one to another callback
+type Pipeline struct {
+	processors []Processor
+	next       outputs.Callback
+}
+
+// NewPipeline returns a pipeline running samples through the processors before
+// handing them to next
+func NewPipeline(next outputs.Callback, processors ...Processor) *Pipeline {
+	return &Pipeline{
+		processors: processors,
+		next:       next,
+	}
+}
+
+// Handle runs the sample through the processors and passes on the results.
+// A processor returning an error doesn't stop the sample; whatever it
+// returned alongside the error carries on through the pipeline
+func (p *Pipeline) Handle(s measurement.Sample) error {
+	var errList *multierror.Error
+	samples := []measurement.Sample{s}
+	for _, processor := range p.processors {
+		processed := []measurement.Sample{}
+		for _, sample := range samples {
+			results, err := processor.Process(sample)
+			if err != nil {
+				errList = multierror.Append(errList, err)
+			}
+			processed = append(processed, results...)
+		}
+		samples = processed
+	}
+	for _, sample := range samples {
+		if err := p.next.Handle(sample); err != nil {
+			errList = multierror.Append(errList, err)
+		}
+	}
+	return errList.ErrorOrNil()
+}
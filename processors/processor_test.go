@@ -0,0 +1,78 @@
+package processors
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockCallback just stashes samples passed to it
+type mockCallback struct {
+	samples []measurement.Sample
+}
+
+func (mc *mockCallback) Handle(s measurement.Sample) error {
+	mc.samples = append(mc.samples, s)
+	return nil
+}
+
+// duplicates every sample, failing on every other one
+type duplicate struct {
+	count int
+}
+
+func (d *duplicate) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	d.count++
+	if d.count%2 == 0 {
+		return []measurement.Sample{s}, errors.New("half as good")
+	}
+	return []measurement.Sample{s, s}, nil
+}
+
+// drops samples from the given device
+type dropDevice string
+
+func (dd dropDevice) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	if s.DeviceName() == string(dd) {
+		return nil, nil
+	}
+	return []measurement.Sample{s}, nil
+}
+
+func newSample(device string, datapoints map[string]float32) measurement.Sample {
+	s := measurement.NewDeviceSample(device)
+	for name, value := range datapoints {
+		s.AddDatapoint(name, value, time.Now())
+	}
+	return s
+}
+
+func values(s measurement.Sample) map[string]float32 {
+	v := make(map[string]float32)
+	for _, d := range s.Datapoints() {
+		v[d.Name()] = d.Value()
+	}
+	return v
+}
+
+func TestPipeline(t *testing.T) {
+	mock := &mockCallback{}
+	p := NewPipeline(mock, &duplicate{}, dropDevice("noisy"))
+
+	// duplicated, then passed
+	assert.Nil(t, p.Handle(newSample("probe", nil)))
+	assert.Equal(t, 2, len(mock.samples))
+	// the error is returned, but the sample still makes it through
+	assert.NotNil(t, p.Handle(newSample("probe", nil)))
+	assert.Equal(t, 3, len(mock.samples))
+	// dropped
+	assert.Nil(t, p.Handle(newSample("noisy", nil)))
+	assert.Equal(t, 3, len(mock.samples))
+
+	// no processors just passes samples along
+	assert.Nil(t, NewPipeline(mock).Handle(newSample("noisy", nil)))
+	assert.Equal(t, 4, len(mock.samples))
+}
@@ -0,0 +1,270 @@
+package processors
+
+// Contains processors for smoothing noisy datapoints and rejecting outliers.
+// Each keeps its state per series of samples (see measurement.SeriesKey) and
+// datapoint name, so one processor can be shared by several devices
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// scale factor making the median absolute deviation a consistent
+// estimator of the standard deviation for normally distributed data
+const madScale = 1.4826
+
+// datapointSet is a set of datapoint names, where an empty set holds every name
+type datapointSet map[string]bool
+
+func newDatapointSet(datapoints []string) datapointSet {
+	set := make(datapointSet)
+	for _, d := range datapoints {
+		set[d] = true
+	}
+	return set
+}
+
+func (ds datapointSet) has(name string) bool {
+	return len(ds) == 0 || ds[name]
+}
+
+// windows holds the most recent values of each series' datapoints
+type windows struct {
+	size   int
+	values map[string][]float64
+	lock   *sync.Mutex
+}
+
+func newWindows(size int) *windows {
+	return &windows{
+		size:   size,
+		values: make(map[string][]float64),
+		lock:   &sync.Mutex{},
+	}
+}
+
+// push adds the value to the window of the key, returning a copy of the window
+// before the value was added
+func (w *windows) push(key string, v float64) []float64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	previous := w.values[key]
+	window := append([]float64{}, previous...)
+	previous = append(previous, v)
+	if len(previous) > w.size {
+		previous = previous[1:]
+	}
+	w.values[key] = previous
+	return window
+}
+
+// returns the key of a datapoint within a sample's series
+func datapointKey(s measurement.Sample, d measurement.Datapoint) string {
+	return measurement.SeriesKey(s) + "/" + d.Name()
+}
+
+// median returns the median of the values, which must not be empty
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Median replaces datapoint values with the median of the last few values,
+// which smooths jitter and removes single spikes without lagging as much as a mean
+type Median struct {
+	datapoints datapointSet
+	windows    *windows
+}
+
+// NewMedian returns a processor replacing the named datapoints (or all of them,
+// if none are named) with the median of their last window values
+func NewMedian(window int, datapoints ...string) (*Median, error) {
+	if window < 2 {
+		return nil, fmt.Errorf("median window must be at least 2, got %d", window)
+	}
+	return &Median{
+		datapoints: newDatapointSet(datapoints),
+		windows:    newWindows(window),
+	}, nil
+}
+
+// Process returns a copy of the sample with the datapoints' medians
+func (m *Median) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	return []measurement.Sample{mapDatapoints(s, func(d measurement.Datapoint) (float32, bool) {
+		if !m.datapoints.has(d.Name()) {
+			return d.Value(), true
+		}
+		v := float64(d.Value())
+		window := append(m.windows.push(datapointKey(s, d), v), v)
+		if len(window) > m.windows.size {
+			window = window[1:]
+		}
+		return float32(median(window)), true
+	})}, nil
+}
+
+// EMA replaces datapoint values with their exponential moving average
+type EMA struct {
+	datapoints datapointSet
+	alpha      float64
+	averages   map[string]float64
+	lock       *sync.Mutex
+}
+
+// NewEMA returns a processor replacing the named datapoints (or all of them, if
+// none are named) with their exponential moving average. Alpha, between 0 and 1,
+// is the weight of each new value: the smaller it is, the smoother the average
+func NewEMA(alpha float64, datapoints ...string) (*EMA, error) {
+	if alpha <= 0 || alpha > 1 {
+		return nil, fmt.Errorf("ema alpha must be above 0 and at most 1, got %v", alpha)
+	}
+	return &EMA{
+		datapoints: newDatapointSet(datapoints),
+		alpha:      alpha,
+		averages:   make(map[string]float64),
+		lock:       &sync.Mutex{},
+	}, nil
+}
+
+// Process returns a copy of the sample with the datapoints' averages
+func (e *EMA) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return []measurement.Sample{mapDatapoints(s, func(d measurement.Datapoint) (float32, bool) {
+		if !e.datapoints.has(d.Name()) {
+			return d.Value(), true
+		}
+		key := datapointKey(s, d)
+		v := float64(d.Value())
+		if average, found := e.averages[key]; found {
+			v = e.alpha*v + (1-e.alpha)*average
+		}
+		e.averages[key] = v
+		return float32(v), true
+	})}, nil
+}
+
+// HampelSettings configures a Hampel outlier filter. A value is an outlier if it
+// is more than Threshold scaled median absolute deviations (an estimate of the
+// standard deviation) from the median of the Window values before it, and at
+// least MinDeviation from it. Outliers are replaced by that median, or dropped
+type HampelSettings struct {
+	Window       int     // defaults to 7
+	Threshold    float64 // defaults to 3
+	MinDeviation float64 // defaults to 0
+	Drop         bool
+}
+
+// Hampel rejects outliers, like the occasional spike of a DS18B20
+type Hampel struct {
+	datapoints datapointSet
+	settings   HampelSettings
+	windows    *windows
+}
+
+// NewHampel returns a processor rejecting outliers of the named datapoints
+// (or all of them, if none are named)
+func NewHampel(settings HampelSettings, datapoints ...string) (*Hampel, error) {
+	if settings.Window == 0 {
+		settings.Window = 7
+	}
+	if settings.Threshold == 0 {
+		settings.Threshold = 3
+	}
+	if settings.Window < 3 {
+		return nil, fmt.Errorf("hampel window must be at least 3, got %d", settings.Window)
+	}
+	if settings.Threshold < 0 || settings.MinDeviation < 0 {
+		return nil, fmt.Errorf("hampel threshold and min deviation cannot be negative")
+	}
+	return &Hampel{
+		datapoints: newDatapointSet(datapoints),
+		settings:   settings,
+		windows:    newWindows(settings.Window),
+	}, nil
+}
+
+// Process returns a copy of the sample with outliers replaced or dropped.
+// Outliers still go into the window, so a lasting change in value is
+// accepted once it makes up half of the window
+func (h *Hampel) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	return nonEmpty(mapDatapoints(s, func(d measurement.Datapoint) (float32, bool) {
+		if !h.datapoints.has(d.Name()) {
+			return d.Value(), true
+		}
+		v := float64(d.Value())
+		window := h.windows.push(datapointKey(s, d), v)
+		// not enough values seen yet to tell
+		if len(window) < 3 {
+			return d.Value(), true
+		}
+		m := median(window)
+		deviations := []float64{}
+		for _, w := range window {
+			deviations = append(deviations, math.Abs(w-m))
+		}
+		deviation := math.Abs(v - m)
+		if deviation <= h.settings.Threshold*madScale*median(deviations) || deviation < h.settings.MinDeviation {
+			return d.Value(), true
+		}
+		if h.settings.Drop {
+			return 0, false
+		}
+		return float32(m), true
+	})), nil
+}
+
+// RateGate drops datapoint values that changed faster than physically
+// plausible since the last value let through
+type RateGate struct {
+	datapoints datapointSet
+	maxRate    float64
+	last       map[string]measurement.Datapoint
+	lock       *sync.Mutex
+}
+
+// NewRateGate returns a processor dropping values of the named datapoints (or all
+// of them, if none are named) that changed by more than maxRate per minute since
+// the last value let through. Since the time since that value keeps growing, a
+// real step change is let through after a while
+func NewRateGate(maxRate float64, datapoints ...string) (*RateGate, error) {
+	if maxRate <= 0 {
+		return nil, fmt.Errorf("rate gate max rate must be above 0, got %v", maxRate)
+	}
+	return &RateGate{
+		datapoints: newDatapointSet(datapoints),
+		maxRate:    maxRate,
+		last:       make(map[string]measurement.Datapoint),
+		lock:       &sync.Mutex{},
+	}, nil
+}
+
+// Process returns a copy of the sample without the datapoints changing too fast
+func (r *RateGate) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return nonEmpty(mapDatapoints(s, func(d measurement.Datapoint) (float32, bool) {
+		if !r.datapoints.has(d.Name()) {
+			return d.Value(), true
+		}
+		key := datapointKey(s, d)
+		if last, found := r.last[key]; found {
+			minutes := d.Time().Sub(last.Time()).Minutes()
+			change := math.Abs(float64(d.Value() - last.Value()))
+			if change > 0 && (minutes <= 0 || change/minutes > r.maxRate) {
+				return 0, false
+			}
+		}
+		r.last[key] = d
+		return d.Value(), true
+	})), nil
+}
@@ -0,0 +1,104 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+// runs values of a 'gravity' datapoint from a red tilt through the processor, a
+// minute apart, returning what comes out (dropped values are left out)
+func runValues(t *testing.T, p Processor, vs ...float32) []float32 {
+	start := time.Date(2018, 5, 20, 0, 0, 0, 0, time.UTC)
+	out := []float32{}
+	for i, v := range vs {
+		s := measurement.NewDeviceSample("tilt")
+		s.AddTag("color", "red")
+		s.AddDatapoint("gravity", v, start.Add(time.Duration(i)*time.Minute))
+		s.AddDatapoint("temperature", 66, start.Add(time.Duration(i)*time.Minute))
+		results, err := p.Process(s)
+		assert.Nil(t, err)
+		for _, r := range results {
+			for _, d := range r.Datapoints() {
+				if d.Name() == "gravity" {
+					out = append(out, d.Value())
+				}
+			}
+		}
+	}
+	return out
+}
+
+// checks the values that came out, since InDeltaSlice ignores extra values
+func assertValues(t *testing.T, expected []float32, actual []float32) {
+	if assert.Equal(t, len(expected), len(actual), "%v", actual) {
+		assert.InDeltaSlice(t, expected, actual, 1e-6)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	m, err := NewMedian(3, "gravity")
+	assert.Nil(t, err)
+	out := runValues(t, m, 1.050, 1.052, 1.090, 1.048, 1.050)
+	assertValues(t, []float32{1.050, 1.051, 1.052, 1.052, 1.050}, out)
+
+	// series are kept separately
+	s := measurement.NewDeviceSample("tilt")
+	s.AddTag("color", "blue")
+	s.AddDatapoint("gravity", 1.010, time.Now())
+	results, err := m.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(1.010), results[0].Datapoints()[0].Value())
+
+	_, err = NewMedian(1)
+	assert.NotNil(t, err)
+}
+
+func TestEMA(t *testing.T) {
+	e, err := NewEMA(0.5, "gravity")
+	assert.Nil(t, err)
+	out := runValues(t, e, 1.050, 1.054, 1.046)
+	assertValues(t, []float32{1.050, 1.052, 1.049}, out)
+
+	_, err = NewEMA(0)
+	assert.NotNil(t, err)
+	_, err = NewEMA(1.5)
+	assert.NotNil(t, err)
+}
+
+func TestHampel(t *testing.T) {
+	h, err := NewHampel(HampelSettings{Window: 5}, "gravity")
+	assert.Nil(t, err)
+	out := runValues(t, h, 1.050, 1.051, 1.049, 1.050, 1.051, 1.090, 1.050)
+	// the spike is replaced by the median of the values before it
+	assertValues(t, []float32{1.050, 1.051, 1.049, 1.050, 1.051, 1.050, 1.050}, out)
+
+	h, err = NewHampel(HampelSettings{Window: 5, Drop: true}, "gravity")
+	assert.Nil(t, err)
+	out = runValues(t, h, 1.050, 1.051, 1.049, 1.050, 1.051, 1.090, 1.050)
+	assertValues(t, []float32{1.050, 1.051, 1.049, 1.050, 1.051, 1.050}, out)
+
+	// small changes in a steady series aren't outliers with a min deviation
+	h, err = NewHampel(HampelSettings{Window: 5, MinDeviation: 0.002}, "gravity")
+	assert.Nil(t, err)
+	out = runValues(t, h, 1.050, 1.050, 1.050, 1.049)
+	assertValues(t, []float32{1.050, 1.050, 1.050, 1.049}, out)
+
+	_, err = NewHampel(HampelSettings{Window: 2})
+	assert.NotNil(t, err)
+	_, err = NewHampel(HampelSettings{Threshold: -1})
+	assert.NotNil(t, err)
+}
+
+func TestRateGate(t *testing.T) {
+	r, err := NewRateGate(0.005, "gravity")
+	assert.Nil(t, err)
+	// the jump to 1.090 is dropped until enough time has passed for it to be plausible
+	out := runValues(t, r, 1.050, 1.052, 1.090, 1.051, 1.090, 1.090, 1.090, 1.090, 1.090, 1.090, 1.090, 1.090, 1.090)
+	assertValues(t, []float32{1.050, 1.052, 1.051, 1.090, 1.090}, out)
+
+	_, err = NewRateGate(0)
+	assert.NotNil(t, err)
+}
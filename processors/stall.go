@@ -0,0 +1,208 @@
+package processors
+
+// Contains a processor watching for fermentations that don't start or get stuck
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+const (
+	// LagTooLongEvent is the name of the event sent when gravity hasn't
+	// started dropping long after pitching
+	LagTooLongEvent = "lag-too-long"
+	// FermentationStuckEvent is the name of the event sent when gravity stopped
+	// dropping well above the expected final gravity
+	FermentationStuckEvent = "fermentation-stuck"
+
+	defaultLagTime     = 48 * time.Hour
+	defaultLagDrop     = float32(0.002)
+	defaultStallTime   = 48 * time.Hour
+	defaultStallMargin = float32(0.004)
+)
+
+// StallSettings configures a stall detector. A batch is pitched when gravity rises
+// well above the lowest gravity of the previous one (the hydrometer was moved into
+// a new batch), whose original gravity is then detected as its first stable gravity,
+// or, if an original gravity is given, when its first gravity is seen. A series first
+// seen without an original gravity is taken as pitched then too, once its original
+// gravity is detected, unless gravity was already falling (it is in the middle of a
+// fermentation, e.g. after a restart) or is within StallMargin of the TerminalGravity
+// (it is finished). The lag is too long if gravity hasn't dropped by LagDrop below the
+// original gravity within LagTime of pitching. Fermentation is stuck if, once started,
+// gravity stays within StallTolerance for StallTime while still more than StallMargin
+// above the TerminalGravity (if no terminal gravity is given, stuck fermentations
+// aren't detected)
+type StallSettings struct {
+	Datapoint       string        // the gravity datapoint, defaults to 'gravity'
+	OriginalGravity float32       // the gravity at pitching, if known
+	LagTime         time.Duration // defaults to 48h
+	LagDrop         float32       // defaults to 0.002
+	StallTime       time.Duration // defaults to 48h
+	StallTolerance  float32       // defaults to 0.001
+	StallMargin     float32       // defaults to 0.004
+	TerminalGravity float32
+}
+
+// Validate returns an error if the settings don't make sense
+func (s StallSettings) Validate() error {
+	if s.LagTime < 0 || s.StallTime < 0 {
+		return fmt.Errorf("lag time and stall time cannot be negative")
+	}
+	if s.LagDrop < 0 || s.StallTolerance < 0 || s.StallMargin < 0 {
+		return fmt.Errorf("lag drop, stall tolerance and stall margin cannot be negative")
+	}
+	if s.TerminalGravity != 0 && s.TerminalGravity < 0.98 {
+		return fmt.Errorf("terminal gravity %.3f is not a specific gravity", s.TerminalGravity)
+	}
+	return OriginalGravitySettings{OriginalGravity: s.OriginalGravity}.Validate()
+}
+
+// Stall watches gravity readings, separately for each series (e.g. tilt color),
+// sending a 'lag-too-long' event if fermentation doesn't start in time, and a
+// 'fermentation-stuck' event if it stops early. Each is sent once per batch,
+// though a stuck fermentation that starts again can get stuck again
+type Stall struct {
+	settings StallSettings
+	series   map[string]*stallSeries
+	lock     *sync.Mutex
+}
+
+// the state of a single series of gravity readings. pitched is zero if the
+// series was first seen after its batch was pitched. A series first seen without
+// an original gravity is unsure until it is known whether it was just pitched
+type stallSeries struct {
+	pitched      time.Time
+	batch        *batchTracker
+	unsure       bool
+	firstGravity float32
+	started      bool
+	lagAlerted   bool
+	stuckAlerted bool
+	recent       fermentationSeries
+}
+
+// NewStall returns a stall detector, using defaults for any settings left empty
+func NewStall(settings StallSettings) (*Stall, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Datapoint == "" {
+		settings.Datapoint = defaultGravityDatapoint
+	}
+	if settings.LagTime == 0 {
+		settings.LagTime = defaultLagTime
+	}
+	if settings.LagDrop == 0 {
+		settings.LagDrop = defaultLagDrop
+	}
+	if settings.StallTime == 0 {
+		settings.StallTime = defaultStallTime
+	}
+	if settings.StallTolerance == 0 {
+		settings.StallTolerance = defaultStableGravity
+	}
+	if settings.StallMargin == 0 {
+		settings.StallMargin = defaultStallMargin
+	}
+	return &Stall{
+		settings: settings,
+		series:   make(map[string]*stallSeries),
+		lock:     &sync.Mutex{},
+	}, nil
+}
+
+// Process passes the sample on, along with an event if the lag is too long or
+// fermentation is stuck. Events are passed on as they are
+func (st *Stall) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	// events carry the gravity they were sent at, which isn't a new reading
+	if _, isEvent := measurement.EventName(s); isEvent {
+		return []measurement.Sample{s}, nil
+	}
+	var gravity measurement.Datapoint
+	for _, d := range s.Datapoints() {
+		if d.Name() == st.settings.Datapoint {
+			gravity = d
+			break
+		}
+	}
+	samples := []measurement.Sample{s}
+	if gravity == nil {
+		return samples, nil
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	key := measurement.SeriesKey(s)
+	series, found := st.series[key]
+	t, g := gravity.Time(), gravity.Value()
+	if !found {
+		batch := newBatchTracker(OriginalGravitySettings{
+			OriginalGravity: st.settings.OriginalGravity,
+			StableTolerance: st.settings.StallTolerance,
+		}.withDefaults())
+		series = &stallSeries{pitched: t, batch: batch}
+		if st.settings.OriginalGravity == 0 {
+			series.unsure = true
+			series.firstGravity = g
+		}
+		st.series[key] = series
+	}
+	if series.batch.add(g) {
+		// the hydrometer was moved into a new batch
+		*series = stallSeries{pitched: t, batch: series.batch}
+	}
+	series.recent.add(gravityReading{time: t, gravity: g}, st.settings.StallTime)
+
+	if series.unsure {
+		og := series.batch.originalGravity
+		switch {
+		case series.firstGravity-g >= st.settings.LagDrop-1e-6:
+			// already fermenting when first seen, so the pitch wasn't seen
+			series.unsure, series.started, series.pitched = false, true, time.Time{}
+		case og != 0 && st.settings.TerminalGravity != 0 && og-st.settings.TerminalGravity <= st.settings.StallMargin+1e-6:
+			// already finished when first seen
+			series.unsure, series.started, series.pitched = false, true, time.Time{}
+		case og != 0:
+			// stable at its original gravity, so pitched when first seen
+			series.unsure = false
+		default:
+			return samples, nil
+		}
+	}
+
+	if !series.started {
+		og := series.batch.originalGravity
+		if og != 0 && og-g >= st.settings.LagDrop-1e-6 {
+			series.started = true
+		} else if !series.lagAlerted && t.Sub(series.pitched) >= st.settings.LagTime {
+			series.lagAlerted = true
+			event := measurement.NewEvent(s, LagTooLongEvent, t)
+			event.AddUnitDatapoint(st.settings.Datapoint, g, gravity.Unit(), t)
+			event.AddDatapoint("hours-since-pitch", float32(t.Sub(series.pitched).Hours()), t)
+			samples = append(samples, event)
+		}
+		return samples, nil
+	}
+
+	if st.settings.TerminalGravity == 0 {
+		return samples, nil
+	}
+	stalled := series.recent.stable(t.Add(-st.settings.StallTime), st.settings.StallTolerance)
+	if !stalled {
+		series.stuckAlerted = false
+	} else if !series.stuckAlerted && g-st.settings.TerminalGravity > st.settings.StallMargin {
+		series.stuckAlerted = true
+		event := measurement.NewEvent(s, FermentationStuckEvent, t)
+		event.AddUnitDatapoint(st.settings.Datapoint, g, gravity.Unit(), t)
+		// without seeing the pitch, a detected original gravity is only where gravity was first stable
+		if og := series.batch.originalGravity; og != 0 && !series.pitched.IsZero() {
+			event.AddUnitDatapoint("apparent-attenuation", float32(measurement.ApparentAttenuation(float64(og), float64(g))), measurement.Percent, t)
+		}
+		samples = append(samples, event)
+	}
+	return samples, nil
+}
@@ -0,0 +1,133 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+// runs hourly gravities through the processor, returning the events sent by hour
+func runEvents(t *testing.T, p Processor, gravities ...float32) map[int]measurement.Sample {
+	start := time.Date(2018, 5, 20, 0, 0, 0, 0, time.UTC)
+	events := make(map[int]measurement.Sample)
+	for hour, g := range gravities {
+		s := measurement.NewDeviceSample("fermenters")
+		s.AddTag("color", "red")
+		s.AddDatapoint("gravity", g, start.Add(time.Duration(hour)*time.Hour))
+		out, err := p.Process(s)
+		assert.Nil(t, err)
+		assert.Equal(t, s, out[0])
+		for _, e := range out[1:] {
+			events[hour] = e
+		}
+	}
+	return events
+}
+
+// returns count hourly readings of the same gravity
+func hours(count int, gravity float32) []float32 {
+	gs := []float32{}
+	for i := 0; i < count; i++ {
+		gs = append(gs, gravity)
+	}
+	return gs
+}
+
+func TestStallLag(t *testing.T) {
+	// pitched when first seen, with a known original gravity
+	st, err := NewStall(StallSettings{LagTime: 24 * time.Hour, OriginalGravity: 1.050})
+	assert.Nil(t, err)
+	// rising a little at first doesn't count as dropping
+	gravities := append([]float32{1.050}, hours(30, 1.051)...)
+	events := runEvents(t, st, gravities...)
+	assert.Equal(t, 1, len(events))
+	name, _ := measurement.EventName(events[24])
+	assert.Equal(t, LagTooLongEvent, name)
+	assert.InDelta(t, 24, values(events[24])["hours-since-pitch"], 1e-6)
+
+	// starting in time
+	st, err = NewStall(StallSettings{LagTime: 24 * time.Hour, OriginalGravity: 1.050})
+	assert.Nil(t, err)
+	gravities = append(hours(12, 1.050), hours(20, 1.047)...)
+	assert.Equal(t, 0, len(runEvents(t, st, gravities...)))
+
+	// pitched when the hydrometer is moved from a finished batch into a new one
+	st, err = NewStall(StallSettings{LagTime: 24 * time.Hour})
+	assert.Nil(t, err)
+	gravities = append(hours(10, 1.010), hours(30, 1.052)...)
+	events = runEvents(t, st, gravities...)
+	assert.Equal(t, 1, len(events))
+	name, _ = measurement.EventName(events[34])
+	assert.Equal(t, LagTooLongEvent, name)
+	assert.InDelta(t, 24, values(events[34])["hours-since-pitch"], 1e-6)
+
+	// a series first seen stable at its original gravity was just pitched
+	st, err = NewStall(StallSettings{})
+	assert.Nil(t, err)
+	events = runEvents(t, st, hours(96, 1.050)...)
+	assert.Equal(t, 1, len(events))
+	name, _ = measurement.EventName(events[48])
+	assert.Equal(t, LagTooLongEvent, name)
+	assert.InDelta(t, 48, values(events[48])["hours-since-pitch"], 1e-6)
+
+	// but not one first seen already falling (e.g. after a restart)
+	st, err = NewStall(StallSettings{LagTime: 24 * time.Hour})
+	assert.Nil(t, err)
+	gravities = []float32{1.030, 1.029, 1.028}
+	assert.Equal(t, 0, len(runEvents(t, st, append(gravities, hours(48, 1.028)...)...)))
+
+	// nor one first seen stable near its terminal gravity, as it is finished
+	st, err = NewStall(StallSettings{LagTime: 24 * time.Hour, StallTime: 24 * time.Hour, TerminalGravity: 1.010})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(runEvents(t, st, hours(72, 1.012)...)))
+}
+
+func TestStallStuck(t *testing.T) {
+	st, err := NewStall(StallSettings{StallTime: 24 * time.Hour, TerminalGravity: 1.010, OriginalGravity: 1.050})
+	assert.Nil(t, err)
+	gravities := []float32{1.050}
+	for g := float32(1.049); g > 1.0295; g -= 0.001 {
+		gravities = append(gravities, g)
+	}
+	// stuck at 1.030 for two days
+	gravities = append(gravities, hours(48, 1.030)...)
+	events := runEvents(t, st, gravities...)
+	assert.Equal(t, 1, len(events))
+	// gravity reached 1.031 at hour 19, and stayed within 0.001 of it for a day
+	name, _ := measurement.EventName(events[43])
+	assert.Equal(t, FermentationStuckEvent, name)
+	assert.InDelta(t, 40, values(events[43])["apparent-attenuation"], 0.1)
+
+	// a series first seen falling is still caught getting stuck, though its
+	// original gravity, and so its attenuation, isn't known
+	st, err = NewStall(StallSettings{StallTime: 24 * time.Hour, TerminalGravity: 1.010})
+	assert.Nil(t, err)
+	gravities = append([]float32{1.033, 1.032, 1.031}, hours(48, 1.030)...)
+	events = runEvents(t, st, gravities...)
+	assert.Equal(t, 1, len(events))
+	// gravity reached 1.031 at hour 2, and stayed within 0.001 of it for a day
+	name, _ = measurement.EventName(events[26])
+	assert.Equal(t, FermentationStuckEvent, name)
+	_, found := values(events[26])["apparent-attenuation"]
+	assert.False(t, found)
+
+	// finishing near the terminal gravity isn't stuck
+	st, err = NewStall(StallSettings{StallTime: 24 * time.Hour, TerminalGravity: 1.010})
+	assert.Nil(t, err)
+	gravities = append(hours(5, 1.050), 1.030)
+	gravities = append(gravities, hours(48, 1.012)...)
+	assert.Equal(t, 0, len(runEvents(t, st, gravities...)))
+
+	// events are passed on untouched, and their gravity isn't a reading
+	event := measurement.NewEvent(measurement.NewDeviceSample("fermenters"), FermentationCompleteEvent, time.Now())
+	event.AddDatapoint("gravity", 1.080, time.Now())
+	out, err := st.Process(event)
+	assert.Nil(t, err)
+	assert.Equal(t, []measurement.Sample{event}, out)
+	assert.Equal(t, 1, len(st.series))
+
+	_, err = NewStall(StallSettings{LagDrop: -1})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,255 @@
+package processors
+
+// Contains simple, stateless processors: renaming datapoints, adding tags,
+// converting units, clamping values and filtering datapoints
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// Rename renames datapoints, leaving any not in its mapping alone
+type Rename struct {
+	names map[string]string
+}
+
+// NewRename returns a processor renaming datapoints from the keys of the
+// mapping to its values
+func NewRename(names map[string]string) *Rename {
+	return &Rename{names: names}
+}
+
+// Process returns a copy of the sample with its datapoints renamed
+func (r *Rename) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	renamed := measurement.NewDeviceSample(s.DeviceName())
+	for k, v := range s.Tags() {
+		renamed.AddTag(k, v)
+	}
+	for _, d := range s.Datapoints() {
+		name := d.Name()
+		if newName, found := r.names[name]; found {
+			name = newName
+		}
+		renamed.AddUnitDatapoint(name, d.Value(), d.Unit(), d.Time())
+	}
+	return []measurement.Sample{renamed}, nil
+}
+
+// StaticTags adds the same tags to every sample, e.g. the brewery or batch.
+// Tags the sample already has are overwritten
+type StaticTags struct {
+	tags measurement.Tags
+}
+
+// NewStaticTags returns a processor adding the tags to every sample
+func NewStaticTags(tags measurement.Tags) *StaticTags {
+	return &StaticTags{tags: tags}
+}
+
+// Process returns a copy of the sample with the tags added
+func (st *StaticTags) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	tagged := measurement.CopySample(s)
+	for k, v := range st.tags {
+		tagged.AddTag(k, v)
+	}
+	return []measurement.Sample{tagged}, nil
+}
+
+// Conversion converts a value from one unit to another
+type Conversion func(float64) float64
+
+// a conversion that can be looked up by name, and the unit of its results
+type namedConversion struct {
+	conversion Conversion
+	unit       measurement.Unit
+}
+
+// unitConversion returns the named conversion between two units of the same quantity
+func unitConversion(from, to measurement.Unit) namedConversion {
+	return namedConversion{
+		conversion: func(v float64) float64 {
+			converted, _ := measurement.ConvertUnit(v, from, to)
+			return converted
+		},
+		unit: to,
+	}
+}
+
+// conversions holds the conversions that can be looked up by name
+var conversions = map[string]namedConversion{
+	"celsius-to-fahrenheit": unitConversion(measurement.Celsius, measurement.Fahrenheit),
+	"fahrenheit-to-celsius": unitConversion(measurement.Fahrenheit, measurement.Celsius),
+	"sg-to-plato":           unitConversion(measurement.SpecificGravity, measurement.Plato),
+	"plato-to-sg":           unitConversion(measurement.Plato, measurement.SpecificGravity),
+	"sg-to-brix":            {conversion: measurement.SGToBrix},
+	"kilograms-to-pounds":   unitConversion(measurement.Kilograms, measurement.Pounds),
+	"pounds-to-kilograms":   unitConversion(measurement.Pounds, measurement.Kilograms),
+	"liters-to-gallons":     unitConversion(measurement.Liters, measurement.Gallons),
+	"gallons-to-liters":     unitConversion(measurement.Gallons, measurement.Liters),
+	"hpa-to-psi":            unitConversion(measurement.Hectopascal, measurement.PSI),
+}
+
+// LookupConversion returns the conversion with the given name, and the unit
+// of the values it converts to
+func LookupConversion(name string) (Conversion, measurement.Unit, error) {
+	c, found := conversions[name]
+	if !found {
+		return nil, measurement.NoUnit, fmt.Errorf("unknown conversion '%s', choose from %v", name, ConversionNames())
+	}
+	return c.conversion, c.unit, nil
+}
+
+// ConversionNames returns the names of the conversions that can be looked up, sorted
+func ConversionNames() []string {
+	names := []string{}
+	for name := range conversions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LinearConversion returns a conversion multiplying by scale, then adding offset
+func LinearConversion(scale, offset float64) Conversion {
+	return func(v float64) float64 { return v*scale + offset }
+}
+
+// Convert converts the values of the given datapoints, in place
+type Convert struct {
+	datapoints map[string]bool
+	conversion Conversion
+	unit       measurement.Unit
+}
+
+// NewConvert returns a processor converting the named datapoints with the conversion.
+// Converted datapoints are measured in the given unit, or have no unit if it's empty
+func NewConvert(conversion Conversion, unit measurement.Unit, datapoints ...string) *Convert {
+	c := &Convert{
+		datapoints: make(map[string]bool),
+		conversion: conversion,
+		unit:       unit,
+	}
+	for _, d := range datapoints {
+		c.datapoints[d] = true
+	}
+	return c
+}
+
+// Process returns a copy of the sample with the datapoints converted
+func (c *Convert) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	converted := measurement.NewDeviceSample(s.DeviceName())
+	for k, v := range s.Tags() {
+		converted.AddTag(k, v)
+	}
+	for _, d := range s.Datapoints() {
+		if !c.datapoints[d.Name()] {
+			converted.AddUnitDatapoint(d.Name(), d.Value(), d.Unit(), d.Time())
+			continue
+		}
+		converted.AddUnitDatapoint(d.Name(), float32(c.conversion(float64(d.Value()))), c.unit, d.Time())
+	}
+	return []measurement.Sample{converted}, nil
+}
+
+// Clamp keeps datapoint values within a range, either by clamping them to the
+// nearest end of the range or by dropping values outside it
+type Clamp struct {
+	datapoints map[string]bool
+	min        float32
+	max        float32
+	drop       bool
+}
+
+// NewClamp returns a processor keeping the named datapoints (or all of them, if none
+// are named) between min and max. Out of range values are dropped if drop is set
+func NewClamp(min, max float32, drop bool, datapoints ...string) (*Clamp, error) {
+	if min > max {
+		return nil, fmt.Errorf("clamp min %v is greater than max %v", min, max)
+	}
+	c := &Clamp{
+		datapoints: make(map[string]bool),
+		min:        min,
+		max:        max,
+		drop:       drop,
+	}
+	for _, d := range datapoints {
+		c.datapoints[d] = true
+	}
+	return c, nil
+}
+
+// Process returns a copy of the sample with its values clamped
+func (c *Clamp) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	return []measurement.Sample{mapDatapoints(s, func(d measurement.Datapoint) (float32, bool) {
+		if len(c.datapoints) > 0 && !c.datapoints[d.Name()] {
+			return d.Value(), true
+		}
+		v := d.Value()
+		if v >= c.min && v <= c.max {
+			return v, true
+		}
+		if c.drop {
+			return 0, false
+		}
+		return float32(math.Max(float64(c.min), math.Min(float64(c.max), float64(v)))), true
+	})}, nil
+}
+
+// Filter keeps or drops datapoints by name. Samples left without any
+// datapoints are dropped entirely
+type Filter struct {
+	keep map[string]bool
+	drop map[string]bool
+}
+
+// NewFilter returns a processor keeping only the datapoints in keep (or all of
+// them, if keep is empty) and then dropping any in drop
+func NewFilter(keep, drop []string) *Filter {
+	f := &Filter{
+		keep: make(map[string]bool),
+		drop: make(map[string]bool),
+	}
+	for _, d := range keep {
+		f.keep[d] = true
+	}
+	for _, d := range drop {
+		f.drop[d] = true
+	}
+	return f
+}
+
+// Process returns a copy of the sample holding only the wanted datapoints
+func (f *Filter) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	return nonEmpty(mapDatapoints(s, func(d measurement.Datapoint) (float32, bool) {
+		if len(f.keep) > 0 && !f.keep[d.Name()] {
+			return 0, false
+		}
+		return d.Value(), !f.drop[d.Name()]
+	})), nil
+}
+
+// mapDatapoints returns a copy of the sample with each datapoint's value replaced
+// by the result of fn, keeping its unit, leaving out the datapoints fn returns false for
+func mapDatapoints(s measurement.Sample, fn func(measurement.Datapoint) (float32, bool)) *measurement.DeviceSample {
+	mapped := measurement.NewDeviceSample(s.DeviceName())
+	for k, v := range s.Tags() {
+		mapped.AddTag(k, v)
+	}
+	for _, d := range s.Datapoints() {
+		if v, keep := fn(d); keep {
+			mapped.AddUnitDatapoint(d.Name(), v, d.Unit(), d.Time())
+		}
+	}
+	return mapped
+}
+
+// nonEmpty returns the sample to pass on, or none if it has no datapoints left
+func nonEmpty(s measurement.Sample) []measurement.Sample {
+	if len(s.Datapoints()) == 0 {
+		return nil
+	}
+	return []measurement.Sample{s}
+}
@@ -0,0 +1,86 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRename(t *testing.T) {
+	s := newSample("tilt", map[string]float32{"temperature": 66, "gravity": 1.050})
+	s.AddTag("color", "red")
+	out, err := NewRename(map[string]string{"temperature": "fahrenheit"}).Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"fahrenheit": 66, "gravity": 1.050}, values(out[0]))
+	assert.Equal(t, "red", out[0].Tags()["color"])
+	// the original is untouched
+	assert.Equal(t, map[string]float32{"temperature": 66, "gravity": 1.050}, values(s))
+}
+
+func TestStaticTags(t *testing.T) {
+	s := newSample("tilt", map[string]float32{"gravity": 1.050})
+	s.AddTag("color", "red")
+	out, err := NewStaticTags(measurement.Tags{"batch": "42", "color": "blue"}).Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, measurement.Tags{"batch": "42", "color": "blue"}, out[0].Tags())
+	assert.Equal(t, measurement.Tags{"color": "red"}, s.Tags())
+}
+
+func TestConvert(t *testing.T) {
+	toCelsius, unit, err := LookupConversion("fahrenheit-to-celsius")
+	assert.Nil(t, err)
+	assert.Equal(t, measurement.Celsius, unit)
+	s := measurement.NewDeviceSample("tilt")
+	s.AddUnitDatapoint("temperature", 68, measurement.Fahrenheit, time.Now())
+	s.AddUnitDatapoint("gravity", 1.050, measurement.SpecificGravity, time.Now())
+	out, err := NewConvert(toCelsius, unit, "temperature").Process(s)
+	assert.Nil(t, err)
+	assert.InDelta(t, 20, values(out[0])["temperature"], 1e-4)
+	assert.Equal(t, measurement.Celsius, out[0].Datapoints()[0].Unit())
+	assert.Equal(t, float32(1.050), values(out[0])["gravity"])
+	assert.Equal(t, measurement.SpecificGravity, out[0].Datapoints()[1].Unit())
+
+	out, err = NewConvert(LinearConversion(1000, -1000), measurement.NoUnit, "gravity").Process(s)
+	assert.Nil(t, err)
+	assert.InDelta(t, 50, values(out[0])["gravity"], 1e-3)
+	assert.Equal(t, measurement.NoUnit, out[0].Datapoints()[1].Unit())
+
+	_, _, err = LookupConversion("furlongs-to-parsecs")
+	assert.NotNil(t, err)
+}
+
+func TestClamp(t *testing.T) {
+	s := newSample("probe", map[string]float32{"celsius": 85, "read-errors": 3})
+	c, err := NewClamp(-10, 40, false, "celsius")
+	assert.Nil(t, err)
+	out, err := c.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"celsius": 40, "read-errors": 3}, values(out[0]))
+
+	c, err = NewClamp(-10, 40, true)
+	assert.Nil(t, err)
+	out, err = c.Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"read-errors": 3}, values(out[0]))
+
+	_, err = NewClamp(40, -10, false)
+	assert.NotNil(t, err)
+}
+
+func TestFilter(t *testing.T) {
+	s := newSample("probe", map[string]float32{"celsius": 19, "fahrenheit": 66.2, "read-errors": 0})
+	out, err := NewFilter(nil, []string{"fahrenheit"}).Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"celsius": 19, "read-errors": 0}, values(out[0]))
+
+	out, err = NewFilter([]string{"celsius"}, nil).Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"celsius": 19}, values(out[0]))
+
+	// nothing left, so the whole sample is dropped
+	out, err = NewFilter([]string{"gravity"}, nil).Process(s)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(out))
+}
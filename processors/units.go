@@ -0,0 +1,109 @@
+package processors
+
+// Contains a processor converting datapoints to the units they're preferred in
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// DisplayUnits converts datapoints to the unit preferred for their quantity, e.g.
+// every temperature to fahrenheit. A flow follows the preferred volume, when there is
+// such a flow unit (gallons-per-minute for gallons), unless a flow unit is preferred.
+// Datapoints whose name mentions their unit are renamed after the preferred one,
+// like a scale's 'beer-kilograms' to 'beer-pounds' or an aggregated 'celsius-max' to
+// 'fahrenheit-max', and dropped if the sample already has that datapoint (like a
+// probe's 'fahrenheit' next to its 'celsius'). A datapoint named after its unit is
+// dropped too when the sample has a datapoint of its quantity whose name mentions
+// no unit, since that one already shows it in the preferred unit (like a tilt's
+// 'plato', next to its 'gravity'). Datapoints without a unit, or in a quantity
+// without a preference, are left alone
+type DisplayUnits struct {
+	preferred map[measurement.Quantity]measurement.Unit
+}
+
+// NewDisplayUnits returns a processor converting datapoints to the preferred units,
+// at most one per quantity
+func NewDisplayUnits(units ...measurement.Unit) (*DisplayUnits, error) {
+	du := &DisplayUnits{preferred: make(map[measurement.Quantity]measurement.Unit)}
+	for _, u := range units {
+		q := u.Quantity()
+		if q == "" {
+			return nil, fmt.Errorf("unknown unit '%s'", u)
+		}
+		if other, found := du.preferred[q]; found && other != u {
+			return nil, fmt.Errorf("only one unit can be preferred for %s, not both %s and %s", q, other, u)
+		}
+		du.preferred[q] = u
+	}
+	if volume, found := du.preferred[measurement.Volume]; found {
+		if _, found := du.preferred[measurement.Flow]; !found {
+			if flow, err := measurement.LookupUnit(string(volume) + "-per-minute"); err == nil {
+				du.preferred[measurement.Flow] = flow
+			}
+		}
+	}
+	return du, nil
+}
+
+// Process returns a copy of the sample with its datapoints in the preferred units
+func (du *DisplayUnits) Process(s measurement.Sample) ([]measurement.Sample, error) {
+	names := make(map[string]bool)
+	// the quantities of the sample that a datapoint not named after a unit holds
+	unnamed := make(map[measurement.Quantity]bool)
+	for _, d := range s.Datapoints() {
+		names[d.Name()] = true
+		if !mentionsUnit(d.Name()) {
+			unnamed[d.Unit().Quantity()] = true
+		}
+	}
+	converted := measurement.NewDeviceSample(s.DeviceName())
+	for k, v := range s.Tags() {
+		converted.AddTag(k, v)
+	}
+	for _, d := range s.Datapoints() {
+		quantity := d.Unit().Quantity()
+		preferred, found := du.preferred[quantity]
+		if !found {
+			converted.AddUnitDatapoint(d.Name(), d.Value(), d.Unit(), d.Time())
+			continue
+		}
+		if d.Name() == string(d.Unit()) && unnamed[quantity] {
+			continue
+		}
+		if preferred == d.Unit() {
+			converted.AddUnitDatapoint(d.Name(), d.Value(), d.Unit(), d.Time())
+			continue
+		}
+		name := renameUnit(d.Name(), d.Unit(), preferred)
+		if name != d.Name() && names[name] {
+			continue
+		}
+		v, err := measurement.ConvertUnit(float64(d.Value()), d.Unit(), preferred)
+		if err != nil {
+			return []measurement.Sample{s}, err
+		}
+		converted.AddUnitDatapoint(name, float32(v), preferred, d.Time())
+	}
+	return []measurement.Sample{converted}, nil
+}
+
+// mentionsUnit returns whether a datapoint's name has a unit as one of its
+// dash separated words, like 'beer-kilograms'
+func mentionsUnit(name string) bool {
+	for _, u := range measurement.UnitNames() {
+		if strings.Contains("-"+name+"-", "-"+u+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// renameUnit returns the name with the words of one unit replaced by another,
+// or the name as it is if it doesn't mention the unit
+func renameUnit(name string, from, to measurement.Unit) string {
+	renamed := strings.Replace("-"+name+"-", "-"+string(from)+"-", "-"+string(to)+"-", 1)
+	return strings.TrimSuffix(strings.TrimPrefix(renamed, "-"), "-")
+}
@@ -0,0 +1,137 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisplayUnits(t *testing.T) {
+	du, err := NewDisplayUnits(measurement.Celsius, measurement.Plato)
+	assert.Nil(t, err)
+	now := time.Now()
+
+	// a tilt's temperature is converted, keeping its name
+	tilt := measurement.NewDeviceSample("tilt")
+	tilt.AddTag("color", "red")
+	tilt.AddUnitDatapoint("temperature", 68, measurement.Fahrenheit, now)
+	tilt.AddUnitDatapoint("gravity", 1.050, measurement.SpecificGravity, now)
+	tilt.AddDatapoint("rssi", -70, now)
+	out, err := du.Process(tilt)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, "red", out[0].Tags()["color"])
+	assert.InDelta(t, 20, values(out[0])["temperature"], 1e-4)
+	assert.InDelta(t, 12.388, values(out[0])["gravity"], 1e-3)
+	assert.Equal(t, float32(-70), values(out[0])["rssi"])
+	assert.Equal(t, measurement.Celsius, out[0].Datapoints()[0].Unit())
+	assert.Equal(t, measurement.Plato, out[0].Datapoints()[1].Unit())
+	assert.Equal(t, measurement.NoUnit, out[0].Datapoints()[2].Unit())
+	// the original is untouched
+	assert.Equal(t, float32(68), values(tilt)["temperature"])
+
+	// a probe's datapoints named after their units are only sent once
+	probe := measurement.NewDeviceSample("probe")
+	probe.AddUnitDatapoint("celsius", 20, measurement.Celsius, now)
+	probe.AddUnitDatapoint("fahrenheit", 68, measurement.Fahrenheit, now)
+	out, err = du.Process(probe)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"celsius": 20}, values(out[0]))
+	du, err = NewDisplayUnits(measurement.Fahrenheit)
+	assert.Nil(t, err)
+	out, err = du.Process(probe)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"fahrenheit": 68}, values(out[0]))
+
+	// and renamed when it's the only one
+	probe = measurement.NewDeviceSample("probe")
+	probe.AddUnitDatapoint("celsius", 20, measurement.Celsius, now)
+	out, err = du.Process(probe)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"fahrenheit": 68}, values(out[0]))
+
+	// an aggregated datapoint keeps what it aggregates in its name
+	probe = measurement.NewDeviceSample("probe")
+	probe.AddUnitDatapoint("celsius-max", 20, measurement.Celsius, now)
+	out, err = du.Process(probe)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float32{"fahrenheit-max": 68}, values(out[0]))
+
+	_, err = NewDisplayUnits(measurement.Celsius, measurement.Fahrenheit)
+	assert.NotNil(t, err)
+	_, err = NewDisplayUnits("kelvin")
+	assert.NotNil(t, err)
+}
+
+func TestDisplayUnitsScaleAndFlow(t *testing.T) {
+	du, err := NewDisplayUnits(measurement.Pounds, measurement.Gallons)
+	assert.Nil(t, err)
+	now := time.Now()
+
+	// an hx711's weights are renamed after the unit they're now in
+	scale := measurement.NewDeviceSample("keg-scale")
+	scale.AddDatapoint("raw", 84000, now)
+	scale.AddUnitDatapoint("kilograms", 10, measurement.Kilograms, now)
+	scale.AddUnitDatapoint("beer-kilograms", 5, measurement.Kilograms, now)
+	scale.AddUnitDatapoint("pints", 8, measurement.Pints, now)
+	out, err := du.Process(scale)
+	assert.Nil(t, err)
+	v := values(out[0])
+	assert.Equal(t, 4, len(v))
+	assert.Equal(t, float32(84000), v["raw"])
+	assert.InDelta(t, 22.0462, v["pounds"], 1e-3)
+	assert.InDelta(t, 11.0231, v["beer-pounds"], 1e-3)
+	assert.InDelta(t, 1, v["gallons"], 1e-3)
+
+	// a flow follows the volume
+	flow := measurement.NewDeviceSample("airlock")
+	flow.AddUnitDatapoint("liters", 3.78541, measurement.Liters, now)
+	flow.AddUnitDatapoint("liters-per-minute", 0.378541, measurement.LitersPerMinute, now)
+	out, err = du.Process(flow)
+	assert.Nil(t, err)
+	v = values(out[0])
+	assert.Equal(t, 2, len(v))
+	assert.InDelta(t, 1, v["gallons"], 1e-4)
+	assert.InDelta(t, 0.1, v["gallons-per-minute"], 1e-4)
+	assert.Equal(t, measurement.GallonsPerMinute, out[0].Datapoints()[1].Unit())
+
+	// unless a flow unit is preferred
+	du, err = NewDisplayUnits(measurement.Gallons, measurement.LitersPerMinute)
+	assert.Nil(t, err)
+	out, err = du.Process(flow)
+	assert.Nil(t, err)
+	assert.InDelta(t, 0.378541, values(out[0])["liters-per-minute"], 1e-6)
+}
+
+func TestDisplayUnitsGravity(t *testing.T) {
+	now := time.Now()
+	tilt := measurement.NewDeviceSample("tilt")
+	tilt.AddUnitDatapoint("gravity", 1.010, measurement.SpecificGravity, now)
+	tilt.AddUnitDatapoint("plato", 2.56, measurement.Plato, now)
+	tilt.AddDatapoint("brix", 2.57, now)
+	tilt.AddUnitDatapoint("original-gravity", 1.050, measurement.SpecificGravity, now)
+
+	// gravities are shown in plato, which makes the 'plato' datapoint redundant
+	du, err := NewDisplayUnits(measurement.Plato)
+	assert.Nil(t, err)
+	out, err := du.Process(tilt)
+	assert.Nil(t, err)
+	v := values(out[0])
+	assert.Equal(t, 3, len(v))
+	assert.InDelta(t, 2.56, v["gravity"], 0.01)
+	assert.InDelta(t, 12.388, v["original-gravity"], 1e-3)
+	assert.Equal(t, float32(2.57), v["brix"])
+
+	// and preferring specific gravity doesn't turn it into an 'sg' datapoint
+	du, err = NewDisplayUnits(measurement.SpecificGravity)
+	assert.Nil(t, err)
+	out, err = du.Process(tilt)
+	assert.Nil(t, err)
+	v = values(out[0])
+	assert.Equal(t, 3, len(v))
+	assert.Equal(t, float32(1.010), v["gravity"])
+	_, found := v["sg"]
+	assert.False(t, found)
+}
@@ -0,0 +1,439 @@
+package state
+
+// Contains a small arithmetic expression language over datapoints in a Store
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// Values looks up the latest value of a datapoint, as a Store does
+type Values interface {
+	Latest(device, datapoint string, tags measurement.Tags) (measurement.Datapoint, bool)
+}
+
+// Expression is a parsed arithmetic expression over the latest values of datapoints.
+// It supports numbers, + - * / and parentheses, the functions avg, min, max and abs,
+// and references to datapoints as device.datapoint, with tags selecting among a
+// device's series in brackets, e.g. tilts[color=red].gravity. Since device and
+// datapoint names may contain dashes, operators must be surrounded by spaces
+type Expression struct {
+	text string
+	root node
+}
+
+// Reference is a datapoint referenced by an expression
+type Reference struct {
+	Device    string
+	Datapoint string
+	Tags      measurement.Tags
+}
+
+// String returns the reference as it is written in expressions
+func (r Reference) String() string {
+	if len(r.Tags) == 0 {
+		return r.Device + "." + r.Datapoint
+	}
+	tags := []string{}
+	for k, v := range r.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	return fmt.Sprintf("%s[%s].%s", r.Device, strings.Join(tags, ","), r.Datapoint)
+}
+
+// ParseExpression parses the expression, returning an error if it is invalid
+func ParseExpression(text string) (*Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%s': %s", text, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.expression()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression '%s': %s", text, err)
+	}
+	return &Expression{text: text, root: root}, nil
+}
+
+// String returns the text the expression was parsed from
+func (e *Expression) String() string {
+	return e.text
+}
+
+// References returns the datapoints the expression refers to
+func (e *Expression) References() []Reference {
+	return e.root.references(nil)
+}
+
+// Evaluate computes the expression from the latest values, also returning the time
+// of the oldest value used. Values older than maxAge (unless 0) are an error
+func (e *Expression) Evaluate(values Values, now time.Time, maxAge time.Duration) (float64, time.Time, error) {
+	ev := &evaluation{values: values, now: now, maxAge: maxAge}
+	v, err := e.root.evaluate(ev)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, time.Time{}, fmt.Errorf("expression '%s' is not a number", e.text)
+	}
+	return v, ev.oldest, nil
+}
+
+// the state of evaluating an expression
+type evaluation struct {
+	values Values
+	now    time.Time
+	maxAge time.Duration
+	oldest time.Time
+}
+
+// a node of a parsed expression
+type node interface {
+	evaluate(*evaluation) (float64, error)
+	references([]Reference) []Reference
+}
+
+type number float64
+
+func (n number) evaluate(*evaluation) (float64, error)   { return float64(n), nil }
+func (n number) references(refs []Reference) []Reference { return refs }
+
+func (r Reference) evaluate(ev *evaluation) (float64, error) {
+	d, found := ev.values.Latest(r.Device, r.Datapoint, r.Tags)
+	if !found {
+		return 0, fmt.Errorf("no value for %s", r)
+	}
+	if ev.maxAge != 0 && ev.now.Sub(d.Time()) > ev.maxAge {
+		return 0, fmt.Errorf("value for %s is stale, read at %s", r, d.Time().Format(time.RFC3339))
+	}
+	if ev.oldest.IsZero() || d.Time().Before(ev.oldest) {
+		ev.oldest = d.Time()
+	}
+	return float64(d.Value()), nil
+}
+
+func (r Reference) references(refs []Reference) []Reference { return append(refs, r) }
+
+type negation struct {
+	operand node
+}
+
+func (n negation) evaluate(ev *evaluation) (float64, error) {
+	v, err := n.operand.evaluate(ev)
+	return -v, err
+}
+
+func (n negation) references(refs []Reference) []Reference { return n.operand.references(refs) }
+
+type binary struct {
+	op          string
+	left, right node
+}
+
+func (b binary) evaluate(ev *evaluation) (float64, error) {
+	l, err := b.left.evaluate(ev)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.evaluate(ev)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	default:
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	}
+}
+
+func (b binary) references(refs []Reference) []Reference {
+	return b.right.references(b.left.references(refs))
+}
+
+// the functions that can be called, and how many arguments they take
+var functions = map[string]struct {
+	minArgs int
+	maxArgs int // 0 is no limit
+	fn      func([]float64) float64
+}{
+	"avg": {1, 0, func(args []float64) float64 {
+		sum := 0.0
+		for _, a := range args {
+			sum += a
+		}
+		return sum / float64(len(args))
+	}},
+	"min": {1, 0, func(args []float64) float64 {
+		m := args[0]
+		for _, a := range args {
+			m = math.Min(m, a)
+		}
+		return m
+	}},
+	"max": {1, 0, func(args []float64) float64 {
+		m := args[0]
+		for _, a := range args {
+			m = math.Max(m, a)
+		}
+		return m
+	}},
+	"abs": {1, 1, func(args []float64) float64 { return math.Abs(args[0]) }},
+}
+
+type call struct {
+	name string
+	args []node
+}
+
+func (c call) evaluate(ev *evaluation) (float64, error) {
+	args := []float64{}
+	for _, a := range c.args {
+		v, err := a.evaluate(ev)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, v)
+	}
+	return functions[c.name].fn(args), nil
+}
+
+func (c call) references(refs []Reference) []Reference {
+	for _, a := range c.args {
+		refs = a.references(refs)
+	}
+	return refs
+}
+
+// TOKENIZING
+
+type token struct {
+	kind string // number, name, or the operator itself
+	text string
+}
+
+func tokenize(text string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/(),", r):
+			tokens = append(tokens, token{kind: string(r), text: string(r)})
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: "number", text: string(runes[start:i])})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (isNameRune(runes[i]) || runes[i] == '[') {
+				// tags in brackets may hold anything but the closing bracket
+				if runes[i] == '[' {
+					for i < len(runes) && runes[i] != ']' {
+						i++
+					}
+					if i == len(runes) {
+						return nil, fmt.Errorf("missing ']'")
+					}
+				}
+				i++
+			}
+			tokens = append(tokens, token{kind: "name", text: string(runes[start:i])})
+		default:
+			return nil, fmt.Errorf("unexpected '%c'", r)
+		}
+	}
+	return tokens, nil
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.", r)
+}
+
+// PARSING
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos].kind
+}
+
+func (p *parser) expect(kind string) error {
+	if p.peek() != kind {
+		if p.pos >= len(p.tokens) {
+			return fmt.Errorf("expected '%s' at the end", kind)
+		}
+		return fmt.Errorf("expected '%s', got '%s'", kind, p.tokens[p.pos].text)
+	}
+	p.pos++
+	return nil
+}
+
+// expression := term (('+' | '-') term)*
+func (p *parser) expression() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.tokens[p.pos].kind
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term := unary (('*' | '/') unary)*
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.tokens[p.pos].kind
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *parser) unary() (node, error) {
+	if p.peek() == "-" {
+		p.pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negation{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+// primary := number | reference | name '(' expression (',' expression)* ')' | '(' expression ')'
+func (p *parser) primary() (node, error) {
+	switch p.peek() {
+	case "number":
+		text := p.tokens[p.pos].text
+		p.pos++
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", text)
+		}
+		return number(v), nil
+	case "(":
+		p.pos++
+		e, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case "name":
+		text := p.tokens[p.pos].text
+		p.pos++
+		if p.peek() == "(" {
+			return p.call(text)
+		}
+		return parseReference(text)
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	default:
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos].text)
+	}
+}
+
+func (p *parser) call(name string) (node, error) {
+	f, found := functions[name]
+	if !found {
+		return nil, fmt.Errorf("unknown function '%s'", name)
+	}
+	p.pos++ // the '('
+	c := call{name: name}
+	for {
+		arg, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+		if p.peek() != "," {
+			break
+		}
+		p.pos++
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(c.args) < f.minArgs || (f.maxArgs != 0 && len(c.args) > f.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments for %s", name)
+	}
+	return c, nil
+}
+
+// parses device.datapoint or device[tag=value,...].datapoint
+func parseReference(text string) (node, error) {
+	r := Reference{Tags: make(measurement.Tags)}
+	rest := text
+	if open := strings.IndexRune(text, '['); open >= 0 {
+		end := strings.IndexRune(text, ']')
+		r.Device = text[:open]
+		for _, pair := range strings.Split(text[open+1:end], ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid tag '%s' in '%s', expected tag=value", pair, text)
+			}
+			r.Tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		rest = text[end+1:]
+		if !strings.HasPrefix(rest, ".") {
+			return nil, fmt.Errorf("expected '.datapoint' after the tags in '%s'", text)
+		}
+		r.Datapoint = rest[1:]
+	} else {
+		dot := strings.LastIndex(text, ".")
+		if dot < 0 {
+			return nil, fmt.Errorf("'%s' is not a device.datapoint reference (are there spaces around operators?)", text)
+		}
+		r.Device, r.Datapoint = text[:dot], text[dot+1:]
+	}
+	if r.Device == "" || r.Datapoint == "" {
+		return nil, fmt.Errorf("'%s' is not a device.datapoint reference", text)
+	}
+	return r, nil
+}
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpression(t *testing.T) {
+	st := NewStore()
+	now := time.Date(2018, 5, 20, 12, 0, 0, 0, time.UTC)
+	add := func(device, datapoint string, value float32, at time.Time, tags ...string) {
+		s := measurement.NewDeviceSample(device)
+		for i := 0; i+1 < len(tags); i += 2 {
+			s.AddTag(tags[i], tags[i+1])
+		}
+		s.AddDatapoint(datapoint, value, at)
+		assert.Nil(t, st.Handle(s))
+	}
+	add("the-one-in-the-fermentor", "celsius", 19.5, now)
+	add("the-one-for-ambient-temps", "celsius", 23, now.Add(-time.Minute))
+	add("probe-3", "celsius", 20.5, now)
+	add("tilts", "gravity", 1.020, now, "color", "red")
+	add("tilts", "gravity", 1.030, now.Add(-time.Hour), "color", "blue")
+
+	for text, expected := range map[string]float64{
+		"the-one-in-the-fermentor.celsius - the-one-for-ambient-temps.celsius":                      -3.5,
+		"avg(the-one-in-the-fermentor.celsius, the-one-for-ambient-temps.celsius, probe-3.celsius)": 21,
+		"(tilts[color=red].gravity - 1) * 1000":                                                     20,
+		"max(tilts[color=red].gravity, tilts[color=blue].gravity)":                                  1.030,
+		"-probe-3.celsius / 2 + abs(-1)":                                                            -9.25,
+		"2 * 3 + 4":                                                                                 10,
+		"min(1, 2.5)":                                                                               1,
+	} {
+		e, err := ParseExpression(text)
+		if !assert.Nil(t, err, text) {
+			continue
+		}
+		v, _, err := e.Evaluate(st, now, 0)
+		assert.Nil(t, err, text)
+		assert.InDelta(t, expected, v, 1e-4, text)
+	}
+
+	e, err := ParseExpression("tilts[color=red].gravity - tilts[color=blue].gravity")
+	assert.Nil(t, err)
+	assert.Equal(t, []Reference{
+		{Device: "tilts", Datapoint: "gravity", Tags: measurement.Tags{"color": "red"}},
+		{Device: "tilts", Datapoint: "gravity", Tags: measurement.Tags{"color": "blue"}},
+	}, e.References())
+	// the oldest value used is returned, and too old values are an error
+	_, oldest, err := e.Evaluate(st, now, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(-time.Hour), oldest)
+	_, _, err = e.Evaluate(st, now, 10*time.Minute)
+	assert.NotNil(t, err)
+
+	// evaluation errors
+	for _, text := range []string{"nope.celsius", "probe-3.celsius / 0"} {
+		e, err := ParseExpression(text)
+		assert.Nil(t, err, text)
+		_, _, err = e.Evaluate(st, now, 0)
+		assert.NotNil(t, err, text)
+	}
+
+	// parse errors
+	for _, text := range []string{
+		"",
+		"probe-3",
+		"(1 + 2",
+		"1 +",
+		"median(1, 2)",
+		"abs(1, 2)",
+		"tilts[color].gravity",
+		"tilts[color=red.gravity",
+		"1 $ 2",
+		"1 2",
+	} {
+		_, err := ParseExpression(text)
+		assert.NotNil(t, err, text)
+	}
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// ServeHTTP responds with the latest values in the store as a JSON list. The
+// 'device' and 'datapoint' query parameters narrow them down, 'stale-after' (a
+// duration like 5m) only returns values older than that, to find devices that
+// stopped reporting, and any other parameters are tags the series must have.
+// Tags named device, datapoint or stale-after therefore can't be filtered on
+func (st *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	var maxAge time.Duration
+	tags := make(measurement.Tags)
+	for k := range query {
+		switch k {
+		case "device", "datapoint":
+		case "stale-after":
+			d, err := time.ParseDuration(query.Get(k))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid stale-after: %s", err), http.StatusBadRequest)
+				return
+			}
+			maxAge = d
+		default:
+			tags[k] = query.Get(k)
+		}
+	}
+
+	values := st.Query(query.Get("device"), query.Get("datapoint"), tags)
+	if maxAge != 0 {
+		values = stale(values, time.Now(), maxAge)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
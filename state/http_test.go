@@ -0,0 +1,55 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeHTTP(t *testing.T) {
+	st := NewStore()
+	now := time.Now().UTC().Truncate(time.Second)
+	red := measurement.NewDeviceSample("tilts")
+	red.AddTag("color", "red")
+	red.AddDatapoint("gravity", 1.050, now)
+	assert.Nil(t, st.Handle(red))
+	probe := measurement.NewDeviceSample("probe")
+	probe.AddDatapoint("celsius", 19.5, now.Add(-time.Hour))
+	assert.Nil(t, st.Handle(probe))
+
+	get := func(url string) ([]Value, int) {
+		w := httptest.NewRecorder()
+		st.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		if w.Code != http.StatusOK {
+			return nil, w.Code
+		}
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		values := []Value{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &values))
+		return values, w.Code
+	}
+
+	values, _ := get("/state")
+	assert.Equal(t, 2, len(values))
+	values, _ = get("/state?color=red")
+	assert.Equal(t, []Value{{Device: "tilts", Tags: measurement.Tags{"color": "red"}, Datapoint: "gravity", Value: 1.050, Time: now}}, values)
+	values, _ = get("/state?device=probe&datapoint=celsius")
+	assert.Equal(t, 1, len(values))
+	assert.Equal(t, float32(19.5), values[0].Value)
+	values, _ = get("/state?stale-after=10m")
+	assert.Equal(t, 1, len(values))
+	assert.Equal(t, "probe", values[0].Device)
+	values, _ = get("/state?device=nope")
+	assert.Equal(t, 0, len(values))
+
+	_, code := get("/state?stale-after=soon")
+	assert.Equal(t, http.StatusBadRequest, code)
+	w := httptest.NewRecorder()
+	st.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/state", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
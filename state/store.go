@@ -0,0 +1,177 @@
+package state
+
+// Contains a store of the latest datapoints read from each device, for
+// computing values across devices
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+)
+
+// Default is the store of the latest values read by every device in the process
+var Default = NewStore()
+
+// Store keeps the latest value of every datapoint of every series (device and tags)
+// it is handed. It implements outputs.Callback, so it can be registered as an output
+type Store struct {
+	devices map[string]map[string]*series
+	lock    *sync.RWMutex
+}
+
+// the latest datapoints of a series
+type series struct {
+	tags       measurement.Tags
+	datapoints map[string]measurement.Datapoint
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{
+		devices: make(map[string]map[string]*series),
+		lock:    &sync.RWMutex{},
+	}
+}
+
+// Handle keeps the sample's datapoints as the latest of its series. Events aren't kept
+func (st *Store) Handle(s measurement.Sample) error {
+	if _, isEvent := measurement.EventName(s); isEvent {
+		return nil
+	}
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	device, found := st.devices[s.DeviceName()]
+	if !found {
+		device = make(map[string]*series)
+		st.devices[s.DeviceName()] = device
+	}
+	key := measurement.SeriesKey(s)
+	ser, found := device[key]
+	if !found {
+		ser = &series{
+			tags:       make(measurement.Tags),
+			datapoints: make(map[string]measurement.Datapoint),
+		}
+		for k, v := range s.Tags() {
+			ser.tags[k] = v
+		}
+		device[key] = ser
+	}
+	for _, d := range s.Datapoints() {
+		ser.datapoints[d.Name()] = d
+	}
+	return nil
+}
+
+// Latest returns the most recent value of the device's datapoint, from any of its
+// series having the given tags (e.g. color=red for a tilt), or false if there is none
+func (st *Store) Latest(device, datapoint string, tags measurement.Tags) (measurement.Datapoint, bool) {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	var latest measurement.Datapoint
+	for _, ser := range st.devices[device] {
+		if !ser.has(tags) {
+			continue
+		}
+		d, found := ser.datapoints[datapoint]
+		if found && (latest == nil || d.Time().After(latest.Time())) {
+			latest = d
+		}
+	}
+	return latest, latest != nil
+}
+
+// Value is the latest value of a datapoint of a series
+type Value struct {
+	Device    string           `json:"device"`
+	Tags      measurement.Tags `json:"tags"`
+	Datapoint string           `json:"datapoint"`
+	Value     float32          `json:"value"`
+	Unit      measurement.Unit `json:"unit,omitempty"`
+	Time      time.Time        `json:"time"`
+
+	series string // the key of the series, for sorting
+}
+
+// Snapshot returns the latest value of every datapoint of every series, sorted
+// by device, series and datapoint
+func (st *Store) Snapshot() []Value {
+	return st.Query("", "", nil)
+}
+
+// Query returns the latest values of the device's datapoint from its series having
+// the given tags, like Snapshot. An empty device or datapoint matches any
+func (st *Store) Query(device, datapoint string, tags measurement.Tags) []Value {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := []Value{}
+	for deviceName, deviceSeries := range st.devices {
+		if device != "" && deviceName != device {
+			continue
+		}
+		for key, ser := range deviceSeries {
+			if !ser.has(tags) {
+				continue
+			}
+			for name, d := range ser.datapoints {
+				if datapoint != "" && name != datapoint {
+					continue
+				}
+				values = append(values, Value{
+					Device:    deviceName,
+					Tags:      ser.copyTags(),
+					Datapoint: name,
+					Value:     d.Value(),
+					Unit:      d.Unit(),
+					Time:      d.Time(),
+					series:    key,
+				})
+			}
+		}
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].series != values[j].series {
+			return values[i].series < values[j].series
+		}
+		return values[i].Datapoint < values[j].Datapoint
+	})
+	return values
+}
+
+// Stale returns the latest values that are older than maxAge, e.g. from a device
+// that stopped being read, sorted like Snapshot
+func (st *Store) Stale(now time.Time, maxAge time.Duration) []Value {
+	return stale(st.Snapshot(), now, maxAge)
+}
+
+// stale returns the values that are older than maxAge, keeping their order
+func stale(values []Value, now time.Time, maxAge time.Duration) []Value {
+	old := []Value{}
+	for _, v := range values {
+		if now.Sub(v.Time) > maxAge {
+			old = append(old, v)
+		}
+	}
+	return old
+}
+
+// has returns whether the series has all the given tags
+func (ser *series) has(tags measurement.Tags) bool {
+	for k, v := range tags {
+		if ser.tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// copyTags returns a copy of the series' tags, safe to hand out
+func (ser *series) copyTags() measurement.Tags {
+	tags := make(measurement.Tags)
+	for k, v := range ser.tags {
+		tags[k] = v
+	}
+	return tags
+}
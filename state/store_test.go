@@ -0,0 +1,91 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nherson/brewski/measurement"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	st := NewStore()
+	now := time.Now()
+
+	red := measurement.NewDeviceSample("tilts")
+	red.AddTag("color", "red")
+	red.AddDatapoint("gravity", 1.050, now)
+	red.AddDatapoint("temperature", 66, now)
+	assert.Nil(t, st.Handle(red))
+	blue := measurement.NewDeviceSample("tilts")
+	blue.AddTag("color", "blue")
+	blue.AddDatapoint("gravity", 1.040, now.Add(time.Second))
+	assert.Nil(t, st.Handle(blue))
+
+	d, found := st.Latest("tilts", "gravity", measurement.Tags{"color": "red"})
+	assert.True(t, found)
+	assert.Equal(t, float32(1.050), d.Value())
+	// without tags, the most recent of any series
+	d, found = st.Latest("tilts", "gravity", nil)
+	assert.True(t, found)
+	assert.Equal(t, float32(1.040), d.Value())
+	d, found = st.Latest("tilts", "temperature", nil)
+	assert.True(t, found)
+	assert.Equal(t, float32(66), d.Value())
+
+	_, found = st.Latest("tilts", "gravity", measurement.Tags{"color": "green"})
+	assert.False(t, found)
+	_, found = st.Latest("probes", "celsius", nil)
+	assert.False(t, found)
+
+	// newer values replace older ones, and events are ignored
+	red = measurement.NewDeviceSample("tilts")
+	red.AddTag("color", "red")
+	red.AddDatapoint("gravity", 1.048, now.Add(time.Minute))
+	assert.Nil(t, st.Handle(red))
+	assert.Nil(t, st.Handle(measurement.NewEvent(red, "fermentation-stuck", now)))
+	d, _ = st.Latest("tilts", "gravity", measurement.Tags{"color": "red"})
+	assert.Equal(t, float32(1.048), d.Value())
+	_, found = st.Latest("tilts", measurement.EventTag, nil)
+	assert.False(t, found)
+}
+
+func TestStoreQuery(t *testing.T) {
+	st := NewStore()
+	now := time.Date(2018, 5, 20, 12, 0, 0, 0, time.UTC)
+
+	red := measurement.NewDeviceSample("tilts")
+	red.AddTag("color", "red")
+	red.AddDatapoint("temperature", 66, now)
+	red.AddDatapoint("gravity", 1.050, now)
+	assert.Nil(t, st.Handle(red))
+	blue := measurement.NewDeviceSample("tilts")
+	blue.AddTag("color", "blue")
+	blue.AddDatapoint("gravity", 1.040, now.Add(-time.Hour))
+	assert.Nil(t, st.Handle(blue))
+	probe := measurement.NewDeviceSample("probe")
+	probe.AddDatapoint("celsius", 19.5, now)
+	assert.Nil(t, st.Handle(probe))
+
+	values := st.Snapshot()
+	assert.Equal(t, 4, len(values))
+	assert.Equal(t, Value{Device: "probe", Tags: measurement.Tags{}, Datapoint: "celsius", Value: 19.5, Time: now, series: measurement.SeriesKey(probe)}, values[0])
+	assert.Equal(t, "blue", values[1].Tags["color"])
+	assert.Equal(t, "gravity", values[2].Datapoint)
+	assert.Equal(t, "red", values[2].Tags["color"])
+	assert.Equal(t, "temperature", values[3].Datapoint)
+
+	// handed out tags are copies
+	values[3].Tags["color"] = "green"
+	assert.Equal(t, 3, len(st.Query("tilts", "", nil)))
+	assert.Equal(t, 2, len(st.Query("tilts", "", measurement.Tags{"color": "red"})))
+	assert.Equal(t, 2, len(st.Query("tilts", "gravity", nil)))
+	assert.Equal(t, 4, len(st.Query("", "", measurement.Tags{})))
+	assert.Equal(t, 0, len(st.Query("tilts", "", measurement.Tags{"color": "green"})))
+	assert.Equal(t, 0, len(st.Query("nope", "", nil)))
+
+	stale := st.Stale(now, 10*time.Minute)
+	assert.Equal(t, 1, len(stale))
+	assert.Equal(t, float32(1.040), stale[0].Value)
+	assert.Equal(t, 0, len(st.Stale(now, 2*time.Hour)))
+}